@@ -1,269 +1,519 @@
 package main
 
 import (
+	"context"
 	"database/sql"
+	"encoding/json"
 	"fmt"
 	"html/template"
 	"net/http"
 	"os"
+	"strings"
 	"time"
+	// The httpd chroot has no zoneinfo, so tz needs the embedded copy
+	_ "time/tzdata"
 
+	"github.com/industrial-linguistics/happy-api/internal/api"
+	"github.com/industrial-linguistics/happy-api/internal/chart"
+	"github.com/industrial-linguistics/happy-api/internal/dashboard"
+	"github.com/industrial-linguistics/happy-api/internal/monitor"
 	_ "github.com/mattn/go-sqlite3"
 )
 
 const dbPath = "/vhosts/happy.industrial-linguistics.com/data/positive-social.db"
 
-type liveUser struct {
-	Name       string
-	LastSeen   time.Time
-	Endpoint   string
-	TotalCount int
-	ErrorCount int
-}
-
-type endpointCount struct {
-	Endpoint string
-	Count    int
-}
-
-type studentProgress struct {
-	Name          string
-	TotalRequests int
-	FirstSeen     time.Time
-	LastSeen      time.Time
-	Sessions      int
-}
-
-type inactiveStudent struct {
-	Name     string
-	LastSeen time.Time
-}
-
 type pageData struct {
 	GeneratedAt       time.Time
-	LiveUsers         []liveUser
+	Query             dashboard.Query
+	LiveWindow        monitor.Range
+	LiveLabel         string
+	SummaryWindow     monitor.Range
+	SummaryLabel      string
+	StudentsWindow    monitor.Range
+	StudentsLabel     string
+	InactiveLabel     string
+	LiveUsers         []monitor.LiveUser
 	SummaryTotal      int
 	SummaryStudents   int
-	SummaryEndpoints  []endpointCount
+	SummaryEndpoints  []monitor.EndpointCount
 	SummaryErrorRate  float64
 	SummaryErrorCount int
-	StudentProgress   []studentProgress
-	InactiveStudents  []inactiveStudent
+	Deprecated        []monitor.AliasUsage
+	StudentProgress   []monitor.StudentProgress
+	InactiveStudents  []monitor.InactiveStudent
+	ExerciseSession   string
+	RosterSession     string
+	RosterProblems    []monitor.RosterStudent
+	RosterExpected    int
+	Milestones        []monitor.Milestone
+	ExerciseProgress  []monitor.MilestoneProgress
+	Activity          []monitor.ActivityEntry // oldest first
+	LastID            int64
+	PerMinute         []monitor.MinuteBucket
+	RequestChart      chart.Chart
+	ErrorRateChart    chart.Chart
+	Latency           monitor.Latency
+	LatencyChart      chart.Chart
+}
+
+// studentData is the per-student detail page.
+type studentData struct {
+	GeneratedAt time.Time
+	Query       dashboard.Query
+	Window      monitor.Range
+	Label       string
+	Requests    []monitor.ActivityEntry // newest first
+	Total       int
+	Errors      int
+	Received    []monitor.UserMessage
+	Sent        int
+	Milestones  []monitor.Milestone
+	Progress    *monitor.MilestoneProgress
 }
 
+// studentHistoryLimit caps the requests listed on the student page.
+const studentHistoryLimit = 500
+
 func main() {
+	script := os.Getenv("SCRIPT_NAME")
+	asJSON := strings.HasSuffix(script, ".json") || api.PreferredMediaType(os.Getenv("HTTP_ACCEPT"), "text/html", "application/json") == "application/json"
+	fail := sendError
+	if asJSON {
+		fail = sendJSONError
+	}
+
+	q, err := dashboard.ParseQuery(strings.TrimSuffix(script, ".json"), os.Getenv("QUERY_STRING"), time.Now())
+	if err != nil {
+		fail(http.StatusBadRequest, err.Error())
+		return
+	}
+
 	db, err := sql.Open("sqlite3", dbPath)
 	if err != nil {
-		sendError(http.StatusInternalServerError, fmt.Sprintf("failed to open database: %v", err))
+		fail(http.StatusInternalServerError, fmt.Sprintf("failed to open database: %v", err))
 		return
 	}
 	defer db.Close()
 
-	data, err := gatherPageData(db)
-	if err != nil {
-		sendError(http.StatusInternalServerError, err.Error())
+	// The live page's polls only need what it redraws
+	if asJSON && q.After >= 0 && q.Student == "" {
+		update, err := dashboard.LoadUpdate(context.Background(), db, q)
+		if err != nil {
+			fail(http.StatusInternalServerError, err.Error())
+			return
+		}
+		sendJSON(http.StatusOK, update)
 		return
 	}
 
-	if err := pageTemplate.Execute(os.Stdout, data); err != nil {
+	var (
+		tmpl      *template.Template
+		data, doc interface{}
+	)
+	if q.Student != "" {
+		student, err := gatherStudentData(db, q)
+		if err != nil {
+			fail(http.StatusInternalServerError, err.Error())
+			return
+		}
+		tmpl, data, doc = studentTemplate, student, newStudentJSON(student)
+	} else {
+		page, err := gatherPageData(db, q)
+		if err != nil {
+			fail(http.StatusInternalServerError, err.Error())
+			return
+		}
+		tmpl, data, doc = pageTemplate, page, newDashboardJSON(page)
+	}
+
+	if asJSON {
+		sendJSON(http.StatusOK, doc)
+		return
+	}
+	if err := tmpl.Execute(os.Stdout, data); err != nil {
 		sendError(http.StatusInternalServerError, fmt.Sprintf("failed to render template: %v", err))
 		return
 	}
 }
 
-func gatherPageData(db *sql.DB) (pageData, error) {
-	liveUsers, err := loadLiveUsers(db)
+func gatherPageData(db *sql.DB, q dashboard.Query) (pageData, error) {
+	ctx := context.Background()
+
+	liveWindow, summaryWindow, studentsWindow := q.Window(time.Hour), q.Window(2*time.Hour), q.Window(4*time.Hour)
+
+	liveUsers, err := monitor.LiveUsers(ctx, db, liveWindow)
 	if err != nil {
 		return pageData{}, fmt.Errorf("failed to load live users: %w", err)
 	}
 
-	totalRequests, uniqueStudents, endpointCounts, errorRate, errorCount, err := loadSummary(db)
+	summary, err := monitor.LoadSummary(ctx, db, summaryWindow)
 	if err != nil {
 		return pageData{}, fmt.Errorf("failed to load summary: %w", err)
 	}
 
-	students, err := loadStudentProgress(db)
+	students, err := monitor.LoadStudentProgress(ctx, db, studentsWindow)
 	if err != nil {
 		return pageData{}, fmt.Errorf("failed to load student progress: %w", err)
 	}
 
-	inactive, err := loadInactiveStudents(db)
+	// Anyone seen in the window, or ever without one, who has since gone
+	// quiet
+	inactiveRange := monitor.Range{Since: q.Since, Until: q.Until, Session: q.Session}
+	inactive, err := monitor.LoadInactiveStudents(ctx, db, inactiveRange, q.End().Add(-q.InactiveAfter))
 	if err != nil {
 		return pageData{}, fmt.Errorf("failed to load inactive students: %w", err)
 	}
 
-	return pageData{
-		GeneratedAt:       time.Now(),
-		LiveUsers:         liveUsers,
-		SummaryTotal:      totalRequests,
-		SummaryStudents:   uniqueStudents,
-		SummaryEndpoints:  endpointCounts,
-		SummaryErrorRate:  errorRate,
-		SummaryErrorCount: errorCount,
-		StudentProgress:   students,
-		InactiveStudents:  inactive,
-	}, nil
-}
-
-func loadLiveUsers(db *sql.DB) ([]liveUser, error) {
-	rows, err := db.Query(`
-        SELECT
-            a.name,
-            a.timestamp as last_seen,
-            a.endpoint,
-            stats.total_count,
-            stats.error_count
-        FROM activity_log a
-        INNER JOIN (
-            SELECT
-                name,
-                MAX(timestamp) as max_timestamp,
-                COUNT(*) as total_count,
-                SUM(CASE WHEN response_code >= 400 THEN 1 ELSE 0 END) as error_count
-            FROM activity_log
-            WHERE name IS NOT NULL AND name != ''
-              AND timestamp >= datetime('now', '-1 hour')
-            GROUP BY name
-        ) stats ON a.name = stats.name AND a.timestamp = stats.max_timestamp
-        WHERE a.name IS NOT NULL AND a.name != ''
-        ORDER BY a.timestamp DESC
-    `)
+	rosterSession, roster, err := loadRoster(ctx, db, q.Session)
 	if err != nil {
-		return nil, err
+		return pageData{}, fmt.Errorf("failed to load roster: %w", err)
 	}
-	defer rows.Close()
 
-	var users []liveUser
-	for rows.Next() {
-		var u liveUser
-		if err := rows.Scan(&u.Name, &u.LastSeen, &u.Endpoint, &u.TotalCount, &u.ErrorCount); err != nil {
-			return nil, err
+	var rosterProblems []monitor.RosterStudent
+	for _, s := range roster {
+		if s.Status != monitor.RosterOK {
+			rosterProblems = append(rosterProblems, s)
 		}
-		users = append(users, u)
 	}
 
-	if err := rows.Err(); err != nil {
-		return nil, err
+	perMinute, err := monitor.RequestsPerMinute(ctx, db, summaryWindow)
+	if err != nil {
+		return pageData{}, fmt.Errorf("failed to load requests per minute: %w", err)
 	}
 
-	return users, nil
-}
-
-func loadSummary(db *sql.DB) (totalRequests int, uniqueStudents int, endpointCounts []endpointCount, errorRate float64, errorCount int, err error) {
-	whereClause := "WHERE timestamp >= datetime('now', '-2 hours')"
-
-	if err = db.QueryRow("SELECT COUNT(*) FROM activity_log " + whereClause).Scan(&totalRequests); err != nil {
-		return
+	latency, err := monitor.LoadLatency(ctx, db, summaryWindow)
+	if err != nil {
+		return pageData{}, fmt.Errorf("failed to load latency: %w", err)
 	}
 
-	if err = db.QueryRow(`
-        SELECT COUNT(DISTINCT name)
-        FROM activity_log
-        ` + whereClause + ` AND name IS NOT NULL
-    `).Scan(&uniqueStudents); err != nil {
-		return
+	deprecated, err := monitor.LoadAliasUsage(ctx, db, summaryWindow)
+	if err != nil {
+		return pageData{}, fmt.Errorf("failed to load deprecated route usage: %w", err)
 	}
 
-	rows, err := db.Query(`
-        SELECT endpoint, COUNT(*) as count
-        FROM activity_log
-        ` + whereClause + `
-        GROUP BY endpoint
-        ORDER BY count DESC
-    `)
+	feed, err := dashboard.LoadFeed(ctx, db, q)
 	if err != nil {
-		return
+		return pageData{}, err
 	}
-	defer rows.Close()
 
-	for rows.Next() {
-		var ec endpointCount
-		if err = rows.Scan(&ec.Endpoint, &ec.Count); err != nil {
-			return
-		}
-		endpointCounts = append(endpointCounts, ec)
+	// Exercise progress follows the chosen session, or the roster's when
+	// there is one
+	exerciseSession := q.Session
+	if exerciseSession == "" {
+		exerciseSession = rosterSession
 	}
-	if err = rows.Err(); err != nil {
-		return
+	exerciseRange := monitor.Range{Since: q.Since, Until: q.Until}
+	if exerciseSession == "" && q.Since.IsZero() {
+		exerciseRange = studentsWindow
+	}
+	exercises, err := monitor.ExerciseProgress(ctx, db,
+		monitor.DefaultMilestones, exerciseSession, exerciseRange)
+	if err != nil {
+		return pageData{}, fmt.Errorf("failed to load exercise progress: %w", err)
 	}
 
-	if err = db.QueryRow(`
-        SELECT COUNT(*) FROM activity_log
-        ` + whereClause + ` AND response_code >= 400
-    `).Scan(&errorCount); err != nil {
-		return
+	return pageData{
+		GeneratedAt:       time.Now(),
+		Query:             q,
+		LiveWindow:        liveWindow,
+		LiveLabel:         q.WindowLabel(time.Hour),
+		SummaryWindow:     summaryWindow,
+		SummaryLabel:      q.WindowLabel(2 * time.Hour),
+		StudentsWindow:    studentsWindow,
+		StudentsLabel:     q.WindowLabel(4 * time.Hour),
+		InactiveLabel:     dashboard.DescribeDuration(q.InactiveAfter),
+		LiveUsers:         liveUsers,
+		SummaryTotal:      summary.TotalRequests,
+		SummaryStudents:   summary.Students,
+		SummaryEndpoints:  summary.Endpoints,
+		SummaryErrorRate:  summary.ErrorRate,
+		SummaryErrorCount: summary.ErrorCount,
+		Deprecated:        deprecated,
+		StudentProgress:   students,
+		InactiveStudents:  inactive,
+		ExerciseSession:   exerciseSession,
+		RosterSession:     rosterSession,
+		RosterProblems:    rosterProblems,
+		RosterExpected:    len(roster),
+		Milestones:        monitor.DefaultMilestones,
+		ExerciseProgress:  exercises,
+		Activity:          feed.Requests,
+		LastID:            feed.LastID,
+		PerMinute:         perMinute,
+		RequestChart:      chart.Requests(perMinute, q.Loc),
+		ErrorRateChart:    chart.ErrorRate(perMinute, q.Loc),
+		Latency:           latency,
+		LatencyChart:      chart.Latency(latency),
+	}, nil
+}
+
+// gatherStudentData loads one student's requests, received messages and
+// milestones. With a session and no since, the whole session is shown;
+// otherwise the same 4 hours as the student progress table.
+func gatherStudentData(db *sql.DB, q dashboard.Query) (studentData, error) {
+	ctx := context.Background()
+
+	r, label := q.Window(4*time.Hour), q.WindowLabel(4*time.Hour)
+	if q.Session != "" && q.Since.IsZero() {
+		r, label = monitor.Range{Until: q.Until, Session: q.Session}, "session "+q.Session
 	}
 
-	if totalRequests > 0 {
-		errorRate = float64(errorCount) / float64(totalRequests) * 100
+	entries, err := monitor.LoadActivity(ctx, db, r, q.Student)
+	if err != nil {
+		return studentData{}, fmt.Errorf("failed to load requests: %w", err)
 	}
 
-	return
-}
+	data := studentData{
+		GeneratedAt: time.Now(),
+		Query:       q,
+		Window:      r,
+		Label:       label,
+		Total:       len(entries),
+		Milestones:  monitor.DefaultMilestones,
+	}
+	for i := len(entries) - 1; i >= 0; i-- {
+		if entries[i].ResponseCode >= 400 {
+			data.Errors++
+		}
+		if len(data.Requests) < studentHistoryLimit {
+			data.Requests = append(data.Requests, entries[i])
+		}
+	}
+
+	messages, err := monitor.LoadUserMessages(ctx, db, r, q.Student)
+	if err != nil {
+		return studentData{}, fmt.Errorf("failed to load messages: %w", err)
+	}
+	for _, m := range messages {
+		if m.To == q.Student {
+			data.Received = append(data.Received, m)
+		}
+		if m.From == q.Student {
+			data.Sent++
+		}
+	}
 
-func loadStudentProgress(db *sql.DB) ([]studentProgress, error) {
-	rows, err := db.Query(`
-        SELECT
-            name,
-            COUNT(*) as total_requests,
-            MIN(timestamp) as first_seen,
-            MAX(timestamp) as last_seen,
-            COUNT(DISTINCT session_id) as sessions
-        FROM activity_log
-        WHERE name IS NOT NULL
-          AND timestamp >= datetime('now', '-4 hours')
-        GROUP BY name
-        ORDER BY total_requests DESC
-    `)
+	progress, err := monitor.ExerciseProgress(ctx, db, data.Milestones, q.Session, r)
 	if err != nil {
-		return nil, err
+		return studentData{}, fmt.Errorf("failed to load exercise progress: %w", err)
 	}
-	defer rows.Close()
+	for i := range progress {
+		if strings.EqualFold(progress[i].Name, q.Student) {
+			data.Progress = &progress[i]
+			break
+		}
+	}
+
+	return data, nil
+}
 
-	var students []studentProgress
-	for rows.Next() {
-		var s studentProgress
-		if err := rows.Scan(&s.Name, &s.TotalRequests, &s.FirstSeen, &s.LastSeen, &s.Sessions); err != nil {
-			return nil, err
+// loadRoster reports on the session's roster, or the most recently
+// imported one when session is empty. The session is empty when there is
+// no roster.
+func loadRoster(ctx context.Context, db *sql.DB, session string) (string, []monitor.RosterStudent, error) {
+	if session == "" {
+		latest, err := monitor.LatestRosterSession(ctx, db)
+		if err != nil || latest == "" {
+			return "", nil, err
 		}
-		students = append(students, s)
+		session = latest
 	}
 
-	if err := rows.Err(); err != nil {
-		return nil, err
+	students, err := monitor.RosterReport(ctx, db, session, monitor.DefaultRosterOptions, time.Now())
+	if err != nil || len(students) == 0 {
+		return "", nil, err
 	}
+	return session, students, nil
+}
 
-	return students, nil
+// dashboardJSON is the dashboard as served to scripts and widgets. The
+// fields are documented under "Dashboard JSON" in README.md; add to them
+// rather than renaming, since instructors' scripts read them.
+type dashboardJSON struct {
+	GeneratedAt time.Time          `json:"generated_at"`
+	Filters     filtersJSON        `json:"filters"`
+	Live        liveJSON           `json:"live"`
+	Summary     summaryJSON        `json:"summary"`
+	Students    studentsJSON       `json:"students"`
+	Exercises   exercisesJSON      `json:"exercises"`
+	Inactive    inactiveJSON       `json:"inactive"`
+	Roster      *rosterJSON        `json:"roster"` // null without a roster
+	Activity    dashboard.Activity `json:"activity"`
 }
 
-func loadInactiveStudents(db *sql.DB) ([]inactiveStudent, error) {
-	rows, err := db.Query(`
-        SELECT name, MAX(timestamp) as last_seen
-        FROM activity_log
-        WHERE name IS NOT NULL
-        GROUP BY name
-        HAVING last_seen < datetime('now', '-15 minutes')
-        ORDER BY last_seen DESC
-    `)
-	if err != nil {
-		return nil, err
+type filtersJSON struct {
+	Session string     `json:"session"`
+	Since   *time.Time `json:"since"`
+	Until   *time.Time `json:"until"`
+}
+
+// windowJSON is the span a section covers. Until is null when it runs up
+// to generated_at.
+type windowJSON struct {
+	Label string     `json:"label"`
+	Since *time.Time `json:"since"`
+	Until *time.Time `json:"until"`
+}
+
+type liveJSON struct {
+	Window windowJSON         `json:"window"`
+	Users  []monitor.LiveUser `json:"users"`
+}
+
+type summaryJSON struct {
+	Window windowJSON `json:"window"`
+	monitor.Summary
+	PerMinute  []monitor.MinuteBucket `json:"per_minute"`
+	Latency    monitor.Latency        `json:"latency"`
+	Deprecated []monitor.AliasUsage   `json:"deprecated"`
+}
+
+type studentsJSON struct {
+	Window   windowJSON                `json:"window"`
+	Students []monitor.StudentProgress `json:"students"`
+}
+
+// exercisesJSON covers the session when there is one and the students
+// window otherwise.
+type exercisesJSON struct {
+	Session    string              `json:"session"`
+	Milestones []monitor.Milestone `json:"milestones"`
+	Students   []exerciseJSON      `json:"students"`
+}
+
+// exerciseJSON is one student's milestones, each reached time or null.
+type exerciseJSON struct {
+	Name    string                `json:"name"`
+	Reached map[string]*time.Time `json:"reached"`
+	Done    int                   `json:"done"`
+}
+
+type inactiveJSON struct {
+	AfterSeconds int                       `json:"after_seconds"`
+	Students     []monitor.InactiveStudent `json:"students"`
+}
+
+type rosterJSON struct {
+	Session  string                  `json:"session"`
+	Expected int                     `json:"expected"`
+	Problems []monitor.RosterStudent `json:"problems"`
+}
+
+func newDashboardJSON(data pageData) dashboardJSON {
+	q := data.Query
+	doc := dashboardJSON{
+		GeneratedAt: data.GeneratedAt,
+		Filters:     filtersJSON{q.Session, monitor.OptionalTime(q.Since), monitor.OptionalTime(q.Until)},
+		Live: liveJSON{
+			Window: newWindowJSON(data.LiveLabel, data.LiveWindow),
+			Users:  nonNil(data.LiveUsers),
+		},
+		Summary: summaryJSON{
+			Window: newWindowJSON(data.SummaryLabel, data.SummaryWindow),
+			Summary: monitor.Summary{
+				TotalRequests: data.SummaryTotal,
+				Students:      data.SummaryStudents,
+				Endpoints:     nonNil(data.SummaryEndpoints),
+				ErrorCount:    data.SummaryErrorCount,
+				ErrorRate:     data.SummaryErrorRate,
+			},
+			PerMinute:  nonNil(data.PerMinute),
+			Latency:    data.Latency,
+			Deprecated: nonNil(data.Deprecated),
+		},
+		Students: studentsJSON{
+			Window:   newWindowJSON(data.StudentsLabel, data.StudentsWindow),
+			Students: nonNil(data.StudentProgress),
+		},
+		Exercises: exercisesJSON{
+			Session:    data.ExerciseSession,
+			Milestones: data.Milestones,
+			Students:   []exerciseJSON{},
+		},
+		Inactive: inactiveJSON{
+			AfterSeconds: int(q.InactiveAfter.Seconds()),
+			Students:     nonNil(data.InactiveStudents),
+		},
+		Activity: dashboard.Activity{LastID: data.LastID, Requests: nonNil(data.Activity)},
+	}
+	doc.Summary.Latency.Buckets = nonNil(doc.Summary.Latency.Buckets)
+	for _, p := range data.ExerciseProgress {
+		doc.Exercises.Students = append(doc.Exercises.Students,
+			exerciseJSON{p.Name, p.ReachedByID(data.Milestones), p.Done()})
 	}
-	defer rows.Close()
+	if data.RosterSession != "" {
+		doc.Roster = &rosterJSON{data.RosterSession, data.RosterExpected, nonNil(data.RosterProblems)}
+	}
+	return doc
+}
 
-	var students []inactiveStudent
-	for rows.Next() {
-		var s inactiveStudent
-		if err := rows.Scan(&s.Name, &s.LastSeen); err != nil {
-			return nil, err
-		}
-		students = append(students, s)
+// studentJSON is a student's page as JSON. Exercises is null when the
+// student has made no exercise attempts in the window.
+type studentJSON struct {
+	GeneratedAt time.Time               `json:"generated_at"`
+	Name        string                  `json:"name"`
+	Filters     filtersJSON             `json:"filters"`
+	Window      windowJSON              `json:"window"`
+	Total       int                     `json:"total_requests"`
+	Errors      int                     `json:"error_count"`
+	Requests    []monitor.ActivityEntry `json:"requests"`
+	Received    []monitor.UserMessage   `json:"received"`
+	Sent        int                     `json:"sent"`
+	Exercises   *studentExercisesJSON   `json:"exercises"`
+}
+
+type studentExercisesJSON struct {
+	Milestones []monitor.Milestone   `json:"milestones"`
+	Reached    map[string]*time.Time `json:"reached"`
+	Done       int                   `json:"done"`
+}
+
+func newStudentJSON(data studentData) studentJSON {
+	q := data.Query
+	doc := studentJSON{
+		GeneratedAt: data.GeneratedAt,
+		Name:        q.Student,
+		Filters:     filtersJSON{q.Session, monitor.OptionalTime(q.Since), monitor.OptionalTime(q.Until)},
+		Window:      newWindowJSON(data.Label, data.Window),
+		Total:       data.Total,
+		Errors:      data.Errors,
+		Requests:    nonNil(data.Requests),
+		Received:    nonNil(data.Received),
+		Sent:        data.Sent,
+	}
+	if p := data.Progress; p != nil {
+		doc.Exercises = &studentExercisesJSON{data.Milestones, p.ReachedByID(data.Milestones), p.Done()}
 	}
+	return doc
+}
+
+func newWindowJSON(label string, r monitor.Range) windowJSON {
+	return windowJSON{label, monitor.OptionalTime(r.Since), monitor.OptionalTime(r.Until)}
+}
 
-	if err := rows.Err(); err != nil {
-		return nil, err
+// nonNil writes empty lists as [] rather than null.
+func nonNil[T any](s []T) []T {
+	if s == nil {
+		return []T{}
 	}
+	return s
+}
+
+func sendJSON(status int, data interface{}) {
+	fmt.Printf("Status: %d %s\r\n", status, http.StatusText(status))
+	fmt.Printf("Content-Type: application/json\r\n")
+	fmt.Printf("Vary: Accept\r\n\r\n")
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	enc.Encode(data)
+}
 
-	return students, nil
+// sendJSONError reports an error in the same shape as message-api.
+func sendJSONError(status int, message string) {
+	sendJSON(status, struct {
+		Error     string    `json:"error"`
+		Timestamp time.Time `json:"timestamp"`
+	}{message, time.Now().UTC()})
 }
 
 func sendError(status int, message string) {
@@ -282,19 +532,254 @@ func formatDuration(d time.Duration) string {
 	return fmt.Sprintf("%dh ago", int(d.Hours()))
 }
 
-func formatTime(t time.Time) string {
+// formatRFC3339 writes t for a filter input, blank when unset.
+func formatRFC3339(t time.Time) string {
 	if t.IsZero() {
-		return "-"
+		return ""
 	}
-	return t.Local().Format("15:04")
+	return t.Format(time.RFC3339)
 }
 
-func formatTimestamp(t time.Time) string {
-	if t.IsZero() {
-		return "-"
-	}
-	return t.Local().Format(time.RFC3339)
-}
+// pageCSS styles the dashboard and student pages.
+const pageCSS = `
+        body { font-family: system-ui, sans-serif; margin: 2rem; background: #f4f6f8; color: #222; }
+        h1 { margin-bottom: 0.2rem; }
+        h2 { margin-top: 2rem; }
+        table { border-collapse: collapse; width: 100%; background: #fff; box-shadow: 0 1px 3px rgba(0,0,0,0.1); margin-top: 1rem; }
+        th, td { border: 1px solid #d8dee4; padding: 0.5rem 0.75rem; text-align: left; }
+        th { background: #e9eef3; }
+        tbody tr:nth-child(even) { background: #f7f9fb; }
+        .muted { color: #555; font-size: 0.9rem; }
+        .error { color: #b42323; font-weight: bold; }
+        .done { color: #1a7f37; font-weight: bold; }
+        .pending { color: #999; }
+        .badge { display: inline-block; padding: 0.15rem 0.5rem; border-radius: 999px; background: #e1ecf4; color: #085fa2; font-size: 0.8rem; margin-left: 0.5rem; }
+        .card { background: #fff; padding: 1rem; border-radius: 0.5rem; box-shadow: 0 1px 3px rgba(0,0,0,0.1); margin-top: 1rem; }
+        ul { padding-left: 1.25rem; }
+        a { color: #085fa2; }
+        .filters label { margin-right: 1rem; white-space: nowrap; }
+        .status { display: inline-block; padding: 0.15rem 0.5rem; border-radius: 999px; font-size: 0.8rem; margin-left: 0.5rem; background: #e9eef3; color: #555; }
+        .status::before { content: "\25CF  "; }
+        .status.ok { background: #dff3e4; color: #1a7f37; }
+        .status.retrying { background: #fff3cd; color: #8a6100; }
+        .status.down { background: #fbe3e3; color: #b42323; }
+        .changed { animation: changed 4s ease-out; }
+        @keyframes changed { from { background: #fff3b0; } to { background: transparent; } }` + chart.CSS
+
+// liveScript keeps the dashboard up to date in live mode. Every refresh it
+// asks the JSON view for the requests since the last id it has and the
+// current counters, redraws the live activity table and summary, and
+// highlights whatever changed. It backs off while the server is
+// unreachable.
+const liveScript = `
+(function () {
+    var body = document.body;
+    var url = body.getAttribute("data-live-url");
+    var refresh = parseInt(body.getAttribute("data-refresh-ms"), 10);
+    var lastId = body.getAttribute("data-last-id");
+    var zone = body.getAttribute("data-tz");
+    var status = document.getElementById("live-status");
+    var feedKeep = 50;
+    var failures = 0;
+    var users = null; // name -> rowKey, null until the first update
+
+    function rowKey(u) {
+        return u.total_count + "/" + u.error_count + "/" + u.last_seen;
+    }
+
+    function setStatus(state, text) {
+        status.className = "status " + state;
+        status.textContent = text;
+    }
+
+    function ago(t) {
+        var s = Math.max(0, Math.floor((Date.now() - Date.parse(t)) / 1000));
+        if (s < 60) {
+            return s + "s ago";
+        }
+        if (s < 3600) {
+            return Math.floor(s / 60) + "m ago";
+        }
+        return Math.floor(s / 3600) + "h ago";
+    }
+
+    function clock(t) {
+        var options = { hour: "2-digit", minute: "2-digit", second: "2-digit", hourCycle: "h23", timeZone: zone };
+        try {
+            return new Date(t).toLocaleTimeString("en-GB", options);
+        } catch (e) {
+            // Zone abbreviations such as AEST are not accepted
+            delete options.timeZone;
+            return new Date(t).toLocaleTimeString("en-GB", options);
+        }
+    }
+
+    function studentLink(name) {
+        var u = new URL(url, location.href);
+        u.searchParams.set("student", name);
+        var a = document.createElement("a");
+        a.href = u.pathname + u.search;
+        a.textContent = name;
+        return a;
+    }
+
+    function cell(tr, content, className) {
+        var td = document.createElement("td");
+        if (typeof content === "string" || typeof content === "number") {
+            td.textContent = content;
+        } else if (content) {
+            td.appendChild(content);
+        }
+        if (className) {
+            td.className = className;
+        }
+        tr.appendChild(td);
+        return td;
+    }
+
+    function statusCell(tr, code) {
+        var span = document.createElement("span");
+        span.textContent = code;
+        if (code >= 400) {
+            span.className = "error";
+        }
+        return cell(tr, span);
+    }
+
+    function flash(el) {
+        el.classList.remove("changed");
+        void el.offsetWidth;
+        el.classList.add("changed");
+    }
+
+    function renderUsers(list) {
+        var box = document.getElementById("live-users");
+        box.textContent = "";
+        if (list.length === 0) {
+            var empty = document.createElement("div");
+            empty.className = "card";
+            empty.textContent = "No activity in this window.";
+            box.appendChild(empty);
+            users = {};
+            return;
+        }
+
+        var table = document.createElement("table");
+        var head = table.createTHead().insertRow();
+        ["Name", "Last Seen", "Last Activity", "Requests", "Errors"].forEach(function (h) {
+            var th = document.createElement("th");
+            th.textContent = h;
+            head.appendChild(th);
+        });
+        var tbody = table.createTBody();
+        var seen = {};
+        list.forEach(function (u) {
+            var tr = document.createElement("tr");
+            tr.setAttribute("data-name", u.name);
+            cell(tr, studentLink(u.name));
+            cell(tr, ago(u.last_seen)).title = u.last_seen;
+            cell(tr, u.endpoint);
+            cell(tr, u.total_count);
+            if (u.error_count > 0) {
+                statusCell(tr, u.error_count);
+            } else {
+                cell(tr, 0);
+            }
+            tbody.appendChild(tr);
+
+            var key = rowKey(u);
+            if (users !== null && users[u.name] !== key) {
+                flash(tr);
+            }
+            seen[u.name] = key;
+        });
+        users = seen;
+
+        var total = document.createElement("p");
+        total.className = "muted";
+        total.textContent = "Total active users: " + list.length;
+        box.appendChild(table);
+        box.appendChild(total);
+    }
+
+    function setText(id, text) {
+        var el = document.getElementById(id);
+        if (el.textContent !== text) {
+            el.textContent = text;
+            flash(el.parentNode);
+        }
+    }
+
+    function renderSummary(summary) {
+        setText("summary-total", String(summary.total_requests));
+        setText("summary-students", String(summary.active_students));
+        setText("summary-errors", summary.error_rate.toFixed(1) + "% (" + summary.error_count + " errors)");
+    }
+
+    function renderFeed(requests) {
+        var tbody = document.getElementById("feed");
+        requests.forEach(function (e) {
+            var tr = document.createElement("tr");
+            cell(tr, clock(e.timestamp)).title = e.timestamp;
+            cell(tr, e.name ? studentLink(e.name) : "");
+            cell(tr, e.endpoint);
+            statusCell(tr, e.response_code);
+            cell(tr, e.response_time_ms + "ms");
+            cell(tr, e.session_id);
+            tbody.insertBefore(tr, tbody.firstChild);
+            flash(tr);
+        });
+        while (tbody.rows.length > feedKeep) {
+            tbody.deleteRow(-1);
+        }
+    }
+
+    function update(doc) {
+        renderUsers(doc.live.users);
+        renderSummary(doc.summary);
+        renderFeed(doc.activity.requests);
+        lastId = doc.activity.last_id;
+    }
+
+    function schedule() {
+        var delay = refresh;
+        if (failures > 0) {
+            delay = Math.min(refresh * Math.pow(2, failures), 60000);
+        }
+        setTimeout(poll, delay);
+    }
+
+    function poll() {
+        if (document.hidden) {
+            schedule();
+            return;
+        }
+        var u = new URL(url, location.href);
+        u.searchParams.set("after", lastId);
+        fetch(u.toString(), { headers: { Accept: "application/json" }, cache: "no-store" })
+            .then(function (response) {
+                if (!response.ok) {
+                    throw new Error("HTTP " + response.status);
+                }
+                return response.json();
+            })
+            .then(function (doc) {
+                update(doc);
+                failures = 0;
+                setStatus("ok", "Live · updated " + clock(doc.generated_at));
+            })
+            .catch(function (err) {
+                failures++;
+                setStatus(failures < 3 ? "retrying" : "down",
+                    (failures < 3 ? "Reconnecting" : "Disconnected") + " (" + err.message + ")");
+            })
+            .then(schedule);
+    }
+
+    setStatus("ok", "Live");
+    schedule();
+})();
+`
 
 var pageTemplate = template.Must(template.New("page").Funcs(template.FuncMap{
 	"formatAgo": func(t time.Time) string {
@@ -303,36 +788,44 @@ var pageTemplate = template.Must(template.New("page").Funcs(template.FuncMap{
 		}
 		return formatDuration(time.Since(t))
 	},
-	"formatTime":      formatTime,
-	"formatTimestamp": formatTimestamp,
+	"formatRFC3339": formatRFC3339,
+	"newestFirst": func(entries []monitor.ActivityEntry) []monitor.ActivityEntry {
+		reversed := make([]monitor.ActivityEntry, len(entries))
+		for i, e := range entries {
+			reversed[len(entries)-1-i] = e
+		}
+		return reversed
+	},
 }).Parse(`Status: 200 OK
 Content-Type: text/html; charset=utf-8
+Vary: Accept
 
 <!DOCTYPE html>
 <html lang="en">
 <head>
     <meta charset="utf-8">
     <title>happywatch</title>
-    <style>
-        body { font-family: system-ui, sans-serif; margin: 2rem; background: #f4f6f8; color: #222; }
-        h1 { margin-bottom: 0.2rem; }
-        h2 { margin-top: 2rem; }
-        table { border-collapse: collapse; width: 100%; background: #fff; box-shadow: 0 1px 3px rgba(0,0,0,0.1); margin-top: 1rem; }
-        th, td { border: 1px solid #d8dee4; padding: 0.5rem 0.75rem; text-align: left; }
-        th { background: #e9eef3; }
-        tbody tr:nth-child(even) { background: #f7f9fb; }
-        .muted { color: #555; font-size: 0.9rem; }
-        .error { color: #b42323; font-weight: bold; }
-        .badge { display: inline-block; padding: 0.15rem 0.5rem; border-radius: 999px; background: #e1ecf4; color: #085fa2; font-size: 0.8rem; margin-left: 0.5rem; }
-        .card { background: #fff; padding: 1rem; border-radius: 0.5rem; box-shadow: 0 1px 3px rgba(0,0,0,0.1); margin-top: 1rem; }
-        ul { padding-left: 1.25rem; }
+    {{ if .Query.Live }}<noscript><meta http-equiv="refresh" content="{{ .Query.Refresh.Seconds }}"></noscript>{{ end }}
+    <style>` + pageCSS + `
     </style>
 </head>
-<body>
-    <h1>happywatch</h1>
-    <p class="muted">Snapshot generated at {{ .GeneratedAt.Local | formatTimestamp }}</p>
+<body{{ if .Query.Live }} data-live-url="{{ .Query.Link "" }}" data-refresh-ms="{{ .Query.Refresh.Milliseconds }}" data-last-id="{{ .LastID }}" data-tz="{{ .Query.Zone }}"{{ end }}>
+    <h1>happywatch{{ if .Query.Session }} <span class="badge">{{ .Query.Session }}</span>{{ end }}{{ if .Query.Live }} <span id="live-status" class="status">Live</span>{{ end }}</h1>
+    <p class="muted">Snapshot generated at {{ .Query.Timestamp .GeneratedAt }}</p>
+
+    <form class="card filters" method="get" action="{{ .Query.Base }}">
+        <label>Session <input name="session" value="{{ .Query.Session }}" size="24"></label>
+        <label>Since <input name="since" value="{{ formatRFC3339 .Query.Since }}" placeholder="2025-10-14 09:00 or 2h" size="26"></label>
+        <label>Until <input name="until" value="{{ formatRFC3339 .Query.Until }}" placeholder="2025-10-14 12:00" size="26"></label>
+        <label>Inactive after <input name="inactive_after" value="{{ .Query.InactiveAfter }}" size="6"></label>
+        <label>Time zone <input name="tz" value="{{ .Query.TZ }}" placeholder="{{ .Query.Zone }}" size="18"></label>
+        <label><input type="checkbox" name="live" value="1"{{ if .Query.Live }} checked{{ end }}> Live updates</label>
+        <button type="submit">Apply</button>
+        {{ if .Query.Filtered }}<a href="{{ .Query.Base }}">Clear</a>{{ end }}
+    </form>
 
-    <h2>Live Activity</h2>
+    <h2>Live Activity ({{ .LiveLabel }})</h2>
+    <div id="live-users">
     {{ if .LiveUsers }}
     <table>
         <thead>
@@ -346,8 +839,8 @@ Content-Type: text/html; charset=utf-8
         </thead>
         <tbody>
         {{ range .LiveUsers }}
-            <tr>
-                <td>{{ .Name }}</td>
+            <tr data-name="{{ .Name }}">
+                <td><a href="{{ $.Query.Link .Name }}">{{ .Name }}</a></td>
                 <td>{{ .LastSeen | formatAgo }}</td>
                 <td>{{ .Endpoint }}</td>
                 <td>{{ .TotalCount }}</td>
@@ -358,14 +851,43 @@ Content-Type: text/html; charset=utf-8
     </table>
     <p class="muted">Total active users: {{ len .LiveUsers }}</p>
     {{ else }}
-    <div class="card">No activity in the last hour.</div>
+    <div class="card">No activity in this window.</div>
+    {{ end }}
+    </div>
+
+    {{ if .Query.Live }}
+    <h2>Recent Requests</h2>
+    <table>
+        <thead>
+            <tr>
+                <th>Time</th>
+                <th>Name</th>
+                <th>Endpoint</th>
+                <th>Status</th>
+                <th>Response Time</th>
+                <th>Session</th>
+            </tr>
+        </thead>
+        <tbody id="feed">
+        {{ range newestFirst .Activity }}
+            <tr>
+                <td title="{{ $.Query.Timestamp .Timestamp }}">{{ $.Query.Clock .Timestamp }}</td>
+                <td>{{ if .Name }}<a href="{{ $.Query.Link .Name }}">{{ .Name }}</a>{{ end }}</td>
+                <td>{{ .Endpoint }}</td>
+                <td>{{ if ge .ResponseCode 400 }}<span class="error">{{ .ResponseCode }}</span>{{ else }}{{ .ResponseCode }}{{ end }}</td>
+                <td>{{ .ResponseTimeMs }}ms</td>
+                <td>{{ .SessionID }}</td>
+            </tr>
+        {{ end }}
+        </tbody>
+    </table>
     {{ end }}
 
-    <h2>Activity Summary (last 2 hours)</h2>
+    <h2>Activity Summary ({{ .SummaryLabel }})</h2>
     <div class="card">
-        <p><strong>Total Requests:</strong> {{ .SummaryTotal }}</p>
-        <p><strong>Active Students:</strong> {{ .SummaryStudents }}</p>
-        <p><strong>Error Rate:</strong> {{ printf "%.1f" .SummaryErrorRate }}% ({{ .SummaryErrorCount }} errors)</p>
+        <p><strong>Total Requests:</strong> <span id="summary-total">{{ .SummaryTotal }}</span></p>
+        <p><strong>Active Students:</strong> <span id="summary-students">{{ .SummaryStudents }}</span></p>
+        <p><strong>Error Rate:</strong> <span id="summary-errors">{{ printf "%.1f" .SummaryErrorRate }}% ({{ .SummaryErrorCount }} errors)</span></p>
     </div>
     {{ if .SummaryEndpoints }}
     <table>
@@ -386,7 +908,34 @@ Content-Type: text/html; charset=utf-8
     </table>
     {{ end }}
 
-    <h2>Student Progress (last 4 hours)</h2>
+    {{ if .Deprecated }}
+    <div class="card">
+        <p><strong>Deprecated routes</strong> <span class="muted">&mdash; still working, but these students should move to the current endpoint</span></p>
+        <ul>
+            {{ range .Deprecated }}
+            <li><code>{{ .Alias }}</code> &rarr; <code>{{ .Endpoint }}</code>: {{ .Requests }} requests, last {{ .LastSeen | formatAgo }}{{ if .Students }} by {{ range $i, $name := .Students }}{{ if $i }}, {{ end }}<a href="{{ $.Query.Link $name }}">{{ $name }}</a>{{ end }}{{ end }}</li>
+            {{ end }}
+        </ul>
+    </div>
+    {{ end }}
+
+    {{ if .RequestChart.Bars }}
+    <div class="card">
+        <p><strong>Requests per minute</strong> <span class="muted">(errors in red)</span></p>
+        {{ template "chart" .RequestChart }}
+        <p><strong>Error rate per minute</strong></p>
+        {{ template "chart" .ErrorRateChart }}
+    </div>
+    {{ end }}
+
+    {{ if .Latency.Count }}
+    <div class="card">
+        <p><strong>Response time:</strong> p50 {{ .Latency.P50 }}ms &middot; p95 {{ .Latency.P95 }}ms &middot; p99 {{ .Latency.P99 }}ms &middot; max {{ .Latency.Max }}ms</p>
+        {{ template "chart" .LatencyChart }}
+    </div>
+    {{ end }}
+
+    <h2>Student Progress ({{ .StudentsLabel }})</h2>
     {{ if .StudentProgress }}
     <table>
         <thead>
@@ -401,10 +950,10 @@ Content-Type: text/html; charset=utf-8
         <tbody>
         {{ range .StudentProgress }}
             <tr>
-                <td>{{ .Name }}</td>
+                <td><a href="{{ $.Query.Link .Name }}">{{ .Name }}</a></td>
                 <td>{{ .TotalRequests }}</td>
-                <td>{{ .FirstSeen | formatTime }}</td>
-                <td>{{ .LastSeen | formatTime }}</td>
+                <td>{{ $.Query.Time .FirstSeen }}</td>
+                <td>{{ $.Query.Time .LastSeen }}</td>
                 <td>{{ .Sessions }}</td>
             </tr>
         {{ end }}
@@ -414,16 +963,168 @@ Content-Type: text/html; charset=utf-8
     <div class="card">No recent student activity.</div>
     {{ end }}
 
-    <h2>Inactive Students (&gt;15 minutes)</h2>
+    <h2>Exercise Progress{{ if .ExerciseSession }} <span class="badge">{{ .ExerciseSession }}</span>{{ else }} ({{ .StudentsLabel }}){{ end }}</h2>
+    {{ if .ExerciseProgress }}
+    <table>
+        <thead>
+            <tr>
+                <th>Student</th>
+                {{ range .Milestones }}<th title="{{ .Label }}">{{ .ID }}{{ if .Exercise }}<br><span class="muted">{{ .Exercise }}</span>{{ end }}</th>{{ end }}
+                <th>Done</th>
+            </tr>
+        </thead>
+        <tbody>
+        {{ $total := len .Milestones }}
+        {{ range .ExerciseProgress }}
+            <tr>
+                <td><a href="{{ $.Query.Link .Name }}">{{ .Name }}</a></td>
+                {{ range .Reached }}<td>{{ if .IsZero }}<span class="pending">&middot;</span>{{ else }}<span class="done" title="{{ $.Query.Timestamp . }}">&#10003; {{ $.Query.Time . }}</span>{{ end }}</td>{{ end }}
+                <td>{{ .Done }}/{{ $total }}</td>
+            </tr>
+        {{ end }}
+        </tbody>
+    </table>
+    <ul class="muted">
+        {{ range .Milestones }}<li><strong>{{ .ID }}</strong>: {{ if .Exercise }}{{ .Exercise }} &ndash; {{ end }}{{ .Label }}</li>{{ end }}
+    </ul>
+    {{ else }}
+    <div class="card">No exercise activity yet.</div>
+    {{ end }}
+
+    <h2>Inactive Students (&gt;{{ .InactiveLabel }})</h2>
     {{ if .InactiveStudents }}
     <ul>
         {{ range .InactiveStudents }}
-        <li>{{ .Name }} <span class="badge">last seen {{ .LastSeen | formatAgo }}</span></li>
+        <li><a href="{{ $.Query.Link .Name }}">{{ .Name }}</a> <span class="badge">last seen {{ .LastSeen | formatAgo }}</span></li>
         {{ end }}
     </ul>
     {{ else }}
     <div class="card">No inactive students in the last period.</div>
     {{ end }}
+
+    {{ if .RosterSession }}
+    <h2>Roster Check <span class="badge">{{ .RosterSession }}</span></h2>
+    {{ if .RosterProblems }}
+    <table>
+        <thead>
+            <tr>
+                <th>Student</th>
+                <th>Status</th>
+                <th>Requests</th>
+                <th>Errors</th>
+                <th>Current Endpoint</th>
+                <th>Last Seen</th>
+            </tr>
+        </thead>
+        <tbody>
+        {{ range .RosterProblems }}
+            <tr>
+                <td><a href="{{ $.Query.Link .Name }}">{{ .Name }}</a></td>
+                <td>{{ if eq .Status "absent" }}never showed up{{ else if eq .Status "failing" }}<span class="error">only errors</span>{{ else }}stuck{{ end }}</td>
+                <td>{{ .Requests }}</td>
+                <td>{{ .Errors }}</td>
+                <td>{{ if .Requests }}{{ .Endpoint }} (&times;{{ .RunLength }}){{ else }}-{{ end }}</td>
+                <td>{{ .LastSeen | formatAgo }}</td>
+            </tr>
+        {{ end }}
+        </tbody>
+    </table>
+    <p class="muted">{{ len .RosterProblems }} of {{ .RosterExpected }} expected students need attention.</p>
+    {{ else }}
+    <div class="card">All {{ .RosterExpected }} expected students are making progress.</div>
+    {{ end }}
+    {{ end }}
+    {{ if .Query.Live }}<script>` + liveScript + `</script>{{ end }}
+</body>
+</html>
+` + chart.Template))
+
+var studentTemplate = template.Must(template.New("student").Funcs(template.FuncMap{
+	"formatAgo": func(t time.Time) string {
+		return formatDuration(time.Since(t))
+	},
+}).Parse(`Status: 200 OK
+Content-Type: text/html; charset=utf-8
+Vary: Accept
+
+<!DOCTYPE html>
+<html lang="en">
+<head>
+    <meta charset="utf-8">
+    <title>{{ .Query.Student }} - happywatch</title>
+    <style>` + pageCSS + `
+    </style>
+</head>
+<body>
+    <p><a href="{{ .Query.Link "" }}">&larr; Dashboard</a></p>
+    <h1>{{ .Query.Student }}{{ if .Query.Session }} <span class="badge">{{ .Query.Session }}</span>{{ end }}</h1>
+    <p class="muted">{{ .Label }} &middot; generated at {{ .Query.Timestamp .GeneratedAt }}</p>
+
+    <div class="card">
+        <p><strong>Requests:</strong> {{ .Total }}{{ if .Errors }} (<span class="error">{{ .Errors }} errors</span>){{ end }}</p>
+        <p><strong>Messages:</strong> {{ len .Received }} received, {{ .Sent }} sent</p>
+        {{ if .Progress }}{{ $reached := .Progress.Reached }}
+        <p><strong>Exercises:</strong> {{ .Progress.Done }}/{{ len .Milestones }} milestones</p>
+        <ul>
+            {{ range $i, $m := .Milestones }}<li>{{ if (index $reached $i).IsZero }}<span class="pending">&middot;</span>{{ else }}<span class="done">&#10003; {{ $.Query.Time (index $reached $i) }}</span>{{ end }} {{ if $m.Exercise }}{{ $m.Exercise }} &ndash; {{ end }}{{ $m.Label }}</li>{{ end }}
+        </ul>
+        {{ end }}
+    </div>
+
+    <h2>Requests</h2>
+    {{ if .Requests }}
+    <table>
+        <thead>
+            <tr>
+                <th>Time</th>
+                <th>Endpoint</th>
+                <th>Status</th>
+                <th>Response Time</th>
+                <th>Session</th>
+                <th>User Agent</th>
+            </tr>
+        </thead>
+        <tbody>
+        {{ range .Requests }}
+            <tr>
+                <td title="{{ $.Query.Timestamp .Timestamp }}">{{ $.Query.Clock .Timestamp }} <span class="muted">{{ formatAgo .Timestamp }}</span></td>
+                <td>{{ .Endpoint }}</td>
+                <td>{{ if ge .ResponseCode 400 }}<span class="error">{{ .ResponseCode }}</span>{{ else }}{{ .ResponseCode }}{{ end }}</td>
+                <td>{{ .ResponseTimeMs }}ms</td>
+                <td>{{ .SessionID }}</td>
+                <td class="muted">{{ .UserAgent }}</td>
+            </tr>
+        {{ end }}
+        </tbody>
+    </table>
+    {{ if gt .Total (len .Requests) }}<p class="muted">Showing the latest {{ len .Requests }} of {{ .Total }} requests.</p>{{ end }}
+    {{ else }}
+    <div class="card">No requests in this window.</div>
+    {{ end }}
+
+    <h2>Received Messages</h2>
+    {{ if .Received }}
+    <table>
+        <thead>
+            <tr>
+                <th>Time</th>
+                <th>From</th>
+                <th>Message</th>
+            </tr>
+        </thead>
+        <tbody>
+        {{ range .Received }}
+            <tr>
+                <td title="{{ $.Query.Timestamp .CreatedAt }}">{{ $.Query.Clock .CreatedAt }}</td>
+                <td><a href="{{ $.Query.Link .From }}">{{ .From }}</a></td>
+                <td>{{ .Message }}</td>
+            </tr>
+        {{ end }}
+        </tbody>
+    </table>
+    {{ else }}
+    <div class="card">No messages received in this window.</div>
+    {{ end }}
 </body>
 </html>
 `))
@@ -1,28 +1,139 @@
 package main
 
 import (
+	"bytes"
+	"compress/gzip"
+	"context"
 	"database/sql"
+	"encoding/csv"
+	"encoding/json"
 	"flag"
 	"fmt"
+	"io"
 	"os"
+	"os/signal"
+	"strconv"
 	"strings"
+	"syscall"
 	"text/tabwriter"
 	"time"
 
+	"github.com/industrial-linguistics/happy-api/internal/alert"
+	"github.com/industrial-linguistics/happy-api/internal/api"
+	"github.com/industrial-linguistics/happy-api/internal/chart"
+	"github.com/industrial-linguistics/happy-api/internal/live"
+	"github.com/industrial-linguistics/happy-api/internal/metrics"
+	"github.com/industrial-linguistics/happy-api/internal/monitor"
+	"github.com/industrial-linguistics/happy-api/internal/report"
 	_ "github.com/mattn/go-sqlite3"
 	"golang.org/x/term"
 )
 
 const dbPath = "/var/www/vhosts/happy.industrial-linguistics.com/data/positive-social.db"
 
+// Output formats accepted by -format
+const (
+	formatTable  = "table"
+	formatJSON   = "json"
+	formatNDJSON = "ndjson"
+	formatCSV    = "csv"
+)
+
 func main() {
 	// Command-line flags
-	modeFlag := flag.String("mode", "live", "Mode: live, summary, students, export")
-	tailFlag := flag.Int("tail", 20, "Number of recent entries to show")
-	sinceFlag := flag.String("since", "", "Show activity since timestamp (RFC3339)")
+	modeFlag := flag.String("mode", "live", "Mode: live, summary, students, export, roster, exercises, perf, alert, report, metrics")
+	formatFlag := flag.String("format", "", "Output format: table, json, ndjson, csv (default table; csv for export)")
+	viewFlag := flag.String("view", live.ViewTable, "Live view: table, feed, split")
+	intervalFlag := flag.Duration("interval", live.DefaultOptions.Interval, "How often live and alert modes poll the database")
+	tailFlag := flag.Int("tail", 20, "Number of recent requests in the live feed and detail pane")
+	sinceFlag := flag.String("since", "", "Show activity since a time: RFC3339, a date (2025-10-14), a date and time (\"2025-10-14 09:00\") or a duration ago (30m)")
+	untilFlag := flag.String("until", "", "Show activity before a time, in the same forms as -since")
+	tzFlag := flag.String("tz", "", "Time zone to show times in and to read -since and -until dates in, e.g. Australia/Perth (default local)")
 	studentFlag := flag.String("student", "", "Filter by student name")
+	sessionFlag := flag.String("session", "", "Training session ID (roster, exercises, report modes)")
+	importFlag := flag.String("import", "", "CSV roster to import for -session (roster mode)")
+	milestonesFlag := flag.String("milestones", "", "JSON milestone definitions (exercises, report modes)")
+	columnsFlag := flag.String("columns", "", "Comma-separated export columns, or \"all\" (export mode)")
+	outputFlag := flag.String("o", "", "Write export to file instead of stdout; .gz implies -gzip (export mode), the report file name without extension (report mode), or the file to replace with the metrics (metrics mode)")
+	messagesFlag := flag.String("messages", "", "Also export user_messages to this file (export mode)")
+	gzipFlag := flag.Bool("gzip", false, "Gzip export output (export mode)")
+	saveBaselineFlag := flag.Bool("save-baseline", false, "Record this window's latency as the baseline (perf mode)")
+	rulesFlag := flag.String("rules", "", "JSON alert rules (alert mode)")
+	bellFlag := flag.Bool("bell", true, "Ring the terminal bell when an alert fires (alert mode)")
+	alertCommandFlag := flag.String("alert-command", "", "Shell command to run for each alert (alert mode)")
+	webhookFlag := flag.String("webhook", "", "URL to POST each alert to as JSON (alert mode)")
+	mailToFlag := flag.String("mail-to", "", "Comma-separated addresses to email alerts to via sendmail (alert mode)")
+	mailFromFlag := flag.String("mail-from", "", "From address for alert emails (alert mode)")
+	sendmailFlag := flag.String("sendmail", alert.DefaultSendmail, "Path to sendmail (alert mode)")
+
+	// Accept the mode as a leading word too: "happywatch report -session x"
+	args := os.Args[1:]
+	if len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+		*modeFlag = args[0]
+		args = args[1:]
+	}
+	flag.CommandLine.Parse(args)
+
+	format := *formatFlag
+	if format == "" {
+		format = formatTable
+		if *modeFlag == "export" {
+			format = formatCSV
+		}
+	}
+	switch format {
+	case formatTable, formatJSON, formatNDJSON, formatCSV:
+	default:
+		fmt.Fprintf(os.Stderr, "Unknown format: %s\n", format)
+		flag.Usage()
+		os.Exit(1)
+	}
+
+	// A stream of snapshots is not one JSON document
+	if *modeFlag == "live" && format == formatJSON {
+		fmt.Fprintf(os.Stderr, "Live mode streams one snapshot per poll: use -format ndjson rather than json\n")
+		os.Exit(1)
+	}
+
+	switch *viewFlag {
+	case live.ViewTable, live.ViewFeed, live.ViewSplit:
+	default:
+		fmt.Fprintf(os.Stderr, "Unknown view: %s\n", *viewFlag)
+		flag.Usage()
+		os.Exit(1)
+	}
+
+	if *intervalFlag <= 0 {
+		fmt.Fprintf(os.Stderr, "Invalid -interval %s: must be positive\n", *intervalFlag)
+		os.Exit(1)
+	}
+
+	// Times are shown, and -since and -until dates read, in loc
+	loc := time.Local
+	if *tzFlag != "" {
+		var err error
+		if loc, err = time.LoadLocation(*tzFlag); err != nil {
+			fmt.Fprintf(os.Stderr, "Invalid -tz %q: %v\n", *tzFlag, err)
+			os.Exit(1)
+		}
+	}
 
-	flag.Parse()
+	now := time.Now()
+	since := parseTimeFlag("since", *sinceFlag, now, loc)
+	until := parseTimeFlag("until", *untilFlag, now, loc)
+	if !since.IsZero() && !until.IsZero() && !until.After(since) {
+		fmt.Fprintf(os.Stderr, "Invalid -until: must be after -since\n")
+		os.Exit(1)
+	}
+
+	columns, err := parseColumns(*columnsFlag)
+	if err != nil {
+		exitWithError(err)
+	}
+	// JSON exports keep every field unless -columns picks some
+	if *columnsFlag == "" && (format == formatJSON || format == formatNDJSON) {
+		columns = allExportColumns
+	}
 
 	db, err := sql.Open("sqlite3", dbPath)
 	if err != nil {
@@ -33,13 +144,43 @@ func main() {
 
 	switch *modeFlag {
 	case "live":
-		runLiveMode(db, *tailFlag)
+		runLiveMode(db, *viewFlag, *tailFlag, *intervalFlag, loc, format)
 	case "summary":
-		runSummary(db, *sinceFlag)
+		runSummary(db, monitor.Range{Since: since, Until: until}, loc, format)
 	case "students":
-		runStudentProgress(db)
+		runStudentProgress(db, monitor.Range{Since: since, Until: until}, loc, format)
 	case "export":
-		runExport(db, *sinceFlag, *studentFlag)
+		runExport(db, exportOptions{
+			since:    since,
+			until:    until,
+			student:  *studentFlag,
+			columns:  columns,
+			output:   *outputFlag,
+			messages: *messagesFlag,
+			gzip:     *gzipFlag,
+		}, format)
+	case "roster":
+		runRoster(db, *sessionFlag, *importFlag, format)
+	case "exercises":
+		runExercises(db, *sessionFlag, *milestonesFlag, loc, format)
+	case "perf":
+		runPerf(db, monitor.Range{Since: since, Until: until}, *saveBaselineFlag, loc, format)
+	case "report":
+		runReport(db, *sessionFlag, *milestonesFlag, *outputFlag, loc)
+	case "metrics":
+		runMetrics(db, *outputFlag)
+	case "alert":
+		runAlert(db, alertOptions{
+			rules:    *rulesFlag,
+			interval: *intervalFlag,
+			bell:     *bellFlag,
+			command:  *alertCommandFlag,
+			webhook:  *webhookFlag,
+			mailTo:   *mailToFlag,
+			mailFrom: *mailFromFlag,
+			sendmail: *sendmailFlag,
+			loc:      loc,
+		}, format)
 	default:
 		fmt.Fprintf(os.Stderr, "Unknown mode: %s\n", *modeFlag)
 		flag.Usage()
@@ -47,218 +188,92 @@ func main() {
 	}
 }
 
-func runLiveMode(db *sql.DB, tail int) {
-	// Hide cursor
-	fmt.Print("\033[?25l")
-	defer fmt.Print("\033[?25h") // Show cursor on exit
-
-	for {
-		// Clear screen and move to top
-		fmt.Print("\033[2J\033[H")
-
-		// Get terminal size
-		width, height, err := term.GetSize(int(os.Stdout.Fd()))
-		if err != nil {
-			// Fallback to reasonable defaults
-			width, height = 80, 24
-		}
-
-		// Get active users with their latest activity
-		rows, err := db.Query(`
-            SELECT
-                a.name,
-                a.timestamp as last_seen,
-                a.endpoint,
-                stats.total_count,
-                stats.error_count
-            FROM activity_log a
-            INNER JOIN (
-                SELECT
-                    name,
-                    MAX(timestamp) as max_timestamp,
-                    COUNT(*) as total_count,
-                    SUM(CASE WHEN response_code >= 400 THEN 1 ELSE 0 END) as error_count
-                FROM activity_log
-                WHERE name IS NOT NULL AND name != ''
-                  AND timestamp >= datetime('now', '-1 hour')
-                GROUP BY name
-            ) stats ON a.name = stats.name AND a.timestamp = stats.max_timestamp
-            WHERE a.name IS NOT NULL AND a.name != ''
-            ORDER BY a.timestamp DESC
-        `)
-
-		if err != nil {
-			fmt.Printf("\033[31mError querying database: %v\033[0m\n", err)
-			time.Sleep(3 * time.Second)
-			continue
-		}
+// parseTimeFlag parses an optional -since or -until value, reading dates
+// in loc, exiting on error.
+func parseTimeFlag(name, value string, now time.Time, loc *time.Location) time.Time {
+	if value == "" {
+		return time.Time{}
+	}
+	t, err := monitor.ParseTime(value, now, loc)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Invalid -%s: %v\n", name, err)
+		os.Exit(1)
+	}
+	return t
+}
 
-		var users []UserActivity
-		for rows.Next() {
-			var u UserActivity
-			rows.Scan(&u.name, &u.lastSeen, &u.endpoint, &u.totalCount, &u.errorCount)
-			users = append(users, u)
-		}
-		rows.Close()
+func runLiveMode(db *sql.DB, view string, tail int, interval time.Duration, loc *time.Location, format string) {
+	// Stop polling on Ctrl+C or kill so the terminal is restored on the
+	// way out
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
 
-		// Render the display
-		renderLiveDisplay(users, width, height)
+	if format != formatTable {
+		streamLive(ctx, db, interval, format)
+		return
+	}
 
-		time.Sleep(3 * time.Second)
+	opts := live.DefaultOptions
+	opts.View = view
+	opts.Tail = tail
+	opts.Interval = interval
+	opts.Location = loc
+	opts.Color = term.IsTerminal(int(os.Stdout.Fd())) && os.Getenv("NO_COLOR") == ""
+	if err := live.Run(ctx, db, opts); err != nil {
+		exitWithError(err)
 	}
 }
 
-// ANSI color codes
-const (
-	colorReset  = "\033[0m"
-	colorBold   = "\033[1m"
-	colorCyan   = "\033[36m"
-	colorGreen  = "\033[32m"
-	colorYellow = "\033[33m"
-	colorRed    = "\033[31m"
-	colorBlue   = "\033[34m"
-	colorGray   = "\033[90m"
-)
-
-type UserActivity struct {
-	name       string
-	lastSeen   time.Time
-	endpoint   string
-	totalCount int
-	errorCount int
+// liveSnapshot is one poll of live mode in a machine-readable format.
+type liveSnapshot struct {
+	GeneratedAt time.Time          `json:"generated_at"`
+	Users       []monitor.LiveUser `json:"users"`
 }
 
-func renderLiveDisplay(users []UserActivity, width, height int) {
-	// Header section (takes 6 lines)
-	title := "╔══ Happy API Activity Monitor ══╗"
-	if len(title)-6 < width { // -6 for ANSI codes overhead
-		// Center the title
-		padding := (width - len(title) + 6) / 2
-		if padding > 0 {
-			fmt.Print(strings.Repeat(" ", padding))
-		}
+// streamLive writes one snapshot per poll until ctx is done: a JSON object
+// per line for ndjson, or rows tagged with the poll time for csv.
+func streamLive(ctx context.Context, db *sql.DB, interval time.Duration, format string) {
+	enc := json.NewEncoder(os.Stdout)
+	cw := csv.NewWriter(os.Stdout)
+	if format == formatCSV {
+		cw.Write([]string{"generated_at", "name", "last_seen", "endpoint", "total_count", "error_count", "session_id"})
+		cw.Flush()
 	}
-	fmt.Printf("%s%s%s%s\n", colorBold, colorCyan, title, colorReset)
 
-	timestamp := time.Now().Format("15:04:05")
-	info := fmt.Sprintf("Last updated: %s │ Press Ctrl+C to exit", timestamp)
-	if len(info) < width {
-		padding := (width - len(info)) / 2
-		if padding > 0 {
-			fmt.Print(strings.Repeat(" ", padding))
-		}
-	}
-	fmt.Printf("%s%s%s\n", colorGray, info, colorReset)
-	fmt.Println()
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
 
-	if len(users) == 0 {
-		fmt.Printf("%s%s━━━ No activity in the last hour ━━━%s\n",
-			colorBold, colorYellow, colorReset)
-		return
-	}
+	for {
+		users, err := monitor.LiveUsers(ctx, db, monitor.Last(time.Hour))
+		now := time.Now()
+		switch {
+		case ctx.Err() != nil:
+			return
+		case err != nil:
+			fmt.Fprintf(os.Stderr, "Error querying database: %v\n", err)
+		case format == formatCSV:
+			for _, u := range users {
+				cw.Write([]string{
+					csvTime(now),
+					u.Name,
+					csvTime(u.LastSeen),
+					u.Endpoint,
+					strconv.Itoa(u.TotalCount),
+					strconv.Itoa(u.ErrorCount),
+					u.SessionID,
+				})
+			}
+			cw.Flush()
+		default:
+			enc.Encode(liveSnapshot{GeneratedAt: now, Users: users})
+		}
 
-	// Calculate available rows for user data
-	// Reserve: 3 for header, 2 for table header, 1 for separator, 2 for footer
-	availableRows := height - 8
-	if availableRows < 1 {
-		availableRows = 1
-	}
-
-	// Limit users to fit in available rows
-	displayUsers := users
-	if len(users) > availableRows {
-		displayUsers = users[:availableRows]
-	}
-
-	// Calculate column widths based on terminal width
-	// Format: Name | Last Seen | Endpoint | Requests | Errors
-	nameWidth := 18
-	lastSeenWidth := 11
-	endpointWidth := width - nameWidth - lastSeenWidth - 20 - 10 - 10 // remaining space
-	if endpointWidth < 10 {
-		endpointWidth = 10
-	}
-	if endpointWidth > 40 {
-		endpointWidth = 40
-	}
-
-	// Print table header
-	fmt.Printf("%s%s┌─%s─┬─%s─┬─%s─┬─────────┬────────┐%s\n",
-		colorBold, colorBlue,
-		strings.Repeat("─", nameWidth),
-		strings.Repeat("─", lastSeenWidth),
-		strings.Repeat("─", endpointWidth),
-		colorReset)
-
-	fmt.Printf("%s%s│ %-*s │ %-*s │ %-*s │ Requests │ Errors │%s\n",
-		colorBold, colorBlue,
-		nameWidth, "Name",
-		lastSeenWidth, "Last Seen",
-		endpointWidth, "Endpoint",
-		colorReset)
-
-	fmt.Printf("%s%s├─%s─┼─%s─┼─%s─┼─────────┼────────┤%s\n",
-		colorBold, colorBlue,
-		strings.Repeat("─", nameWidth),
-		strings.Repeat("─", lastSeenWidth),
-		strings.Repeat("─", endpointWidth),
-		colorReset)
-
-	// Print each user
-	for i, u := range displayUsers {
-		ago := time.Since(u.lastSeen).Round(time.Second)
-		agoStr := formatDuration(ago)
-
-		// Color based on recency
-		rowColor := colorReset
-		if ago < 30*time.Second {
-			rowColor = colorGreen
-		} else if ago < 5*time.Minute {
-			rowColor = colorYellow
-		}
-
-		errorStr := "─"
-		errorColor := colorReset
-		if u.errorCount > 0 {
-			errorStr = fmt.Sprintf("%d", u.errorCount)
-			errorColor = colorRed
-		}
-
-		name := truncate(u.name, nameWidth)
-		endpoint := truncate(u.endpoint, endpointWidth)
-
-		fmt.Printf("%s│ %-*s │ %-*s │ %-*s │ %7d  │ %s%6s%s  │%s\n",
-			colorBlue,
-			nameWidth, rowColor+name+colorReset,
-			lastSeenWidth, rowColor+agoStr+colorReset,
-			endpointWidth, endpoint,
-			u.totalCount,
-			errorColor, errorStr, colorReset,
-			colorBlue)
-
-		// Add separator between rows (except for last row)
-		if i < len(displayUsers)-1 {
-			fmt.Printf("├─%s─┼─%s─┼─%s─┼─────────┼────────┤\n",
-				strings.Repeat("─", nameWidth),
-				strings.Repeat("─", lastSeenWidth),
-				strings.Repeat("─", endpointWidth))
-		}
-	}
-
-	// Bottom border
-	fmt.Printf("└─%s─┴─%s─┴─%s─┴─────────┴────────┘%s\n",
-		strings.Repeat("─", nameWidth),
-		strings.Repeat("─", lastSeenWidth),
-		strings.Repeat("─", endpointWidth),
-		colorReset)
-
-	// Footer
-	fmt.Println()
-	totalMsg := fmt.Sprintf("Total active users: %s%d%s", colorBold+colorGreen, len(users), colorReset)
-	if len(users) > len(displayUsers) {
-		totalMsg += fmt.Sprintf(" %s(showing %d)%s", colorGray, len(displayUsers), colorReset)
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
 	}
-	fmt.Println(totalMsg)
 }
 
 func formatDuration(d time.Duration) string {
@@ -271,215 +286,698 @@ func formatDuration(d time.Duration) string {
 	}
 }
 
-func runSummary(db *sql.DB, since string) {
-	whereClause := ""
-	args := []interface{}{}
+// summaryReport is the summary mode output in the machine-readable formats.
+type summaryReport struct {
+	monitor.Summary
+	PerMinute  []monitor.MinuteBucket `json:"per_minute"`
+	Latency    monitor.Latency        `json:"latency"`
+	Deprecated []monitor.AliasUsage   `json:"deprecated"`
+}
 
-	if since != "" {
-		whereClause = "WHERE timestamp >= ?"
-		args = append(args, since)
-	} else {
+func runSummary(db *sql.DB, r monitor.Range, loc *time.Location, format string) {
+	if r.Since.IsZero() {
 		// Default: last 2 hours
-		whereClause = "WHERE timestamp >= datetime('now', '-2 hours')"
+		r.Since = time.Now().Add(-2 * time.Hour)
 	}
+	ctx := context.Background()
 
-	fmt.Println("=== Activity Summary ===\n")
+	summary, err := monitor.LoadSummary(ctx, db, r)
+	if err != nil {
+		exitWithError(err)
+	}
 
-	// Total requests
-	var totalRequests int
-	db.QueryRow("SELECT COUNT(*) FROM activity_log "+whereClause, args...).Scan(&totalRequests)
-	fmt.Printf("Total Requests: %d\n", totalRequests)
+	perMinute, err := monitor.RequestsPerMinute(ctx, db, r)
+	if err != nil {
+		exitWithError(err)
+	}
+
+	latency, err := monitor.LoadLatency(ctx, db, r)
+	if err != nil {
+		exitWithError(err)
+	}
+
+	deprecated, err := monitor.LoadAliasUsage(ctx, db, r)
+	if err != nil {
+		exitWithError(err)
+	}
 
-	// Unique students
-	var uniqueStudents int
-	db.QueryRow(`
-        SELECT COUNT(DISTINCT name)
-        FROM activity_log
-        `+whereClause+` AND name IS NOT NULL
-    `, args...).Scan(&uniqueStudents)
-	fmt.Printf("Active Students: %d\n\n", uniqueStudents)
+	report := summaryReport{Summary: summary, PerMinute: perMinute, Latency: latency, Deprecated: deprecated}
+
+	switch format {
+	case formatJSON:
+		writeJSON(os.Stdout, report)
+		return
+	case formatNDJSON:
+		writeNDJSON(os.Stdout, report)
+		return
+	case formatCSV:
+		rows := [][]string{
+			{"total_requests", strconv.Itoa(summary.TotalRequests)},
+			{"active_students", strconv.Itoa(summary.Students)},
+			{"error_count", strconv.Itoa(summary.ErrorCount)},
+			{"error_rate", strconv.FormatFloat(summary.ErrorRate, 'f', 2, 64)},
+			{"latency_p50_ms", strconv.Itoa(latency.P50)},
+			{"latency_p95_ms", strconv.Itoa(latency.P95)},
+			{"latency_p99_ms", strconv.Itoa(latency.P99)},
+			{"latency_max_ms", strconv.Itoa(latency.Max)},
+		}
+		for _, ec := range summary.Endpoints {
+			rows = append(rows, []string{"endpoint " + ec.Endpoint, strconv.Itoa(ec.Count)})
+		}
+		for _, u := range deprecated {
+			rows = append(rows, []string{"deprecated " + u.Alias, strconv.Itoa(u.Requests)})
+		}
+		writeCSV(os.Stdout, []string{"metric", "value"}, rows)
+		return
+	}
+
+	fmt.Printf("=== Activity Summary ===\n\n")
+
+	fmt.Printf("Total Requests: %d\n", summary.TotalRequests)
+	fmt.Printf("Active Students: %d\n\n", summary.Students)
 
 	// Requests by endpoint
 	fmt.Println("Requests by Endpoint:")
-	rows, _ := db.Query(`
-        SELECT endpoint, COUNT(*) as count
-        FROM activity_log
-        `+whereClause+`
-        GROUP BY endpoint
-        ORDER BY count DESC
-    `, args...)
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 3, ' ', 0)
+	for _, ec := range summary.Endpoints {
+		fmt.Fprintf(w, "  %s\t%d\n", ec.Endpoint, ec.Count)
+	}
+	w.Flush()
+
+	fmt.Println()
+	fmt.Printf("Error Rate: %.1f%% (%d errors)\n", summary.ErrorRate, summary.ErrorCount)
+
+	if len(perMinute) > 0 {
+		printTimeSeries(perMinute, loc)
+	}
+	if latency.Count > 0 {
+		printLatency(latency)
+	}
+	if len(deprecated) > 0 {
+		printDeprecated(deprecated)
+	}
+}
 
+// printDeprecated lists who is still calling deprecated aliases, so they
+// can be pointed at the current endpoints before the aliases go away.
+func printDeprecated(usage []monitor.AliasUsage) {
+	fmt.Println()
+	fmt.Println("Deprecated Routes:")
 	w := tabwriter.NewWriter(os.Stdout, 0, 0, 3, ' ', 0)
-	for rows.Next() {
-		var endpoint string
-		var count int
-		rows.Scan(&endpoint, &count)
-		fmt.Fprintf(w, "  %s\t%d\n", endpoint, count)
+	for _, u := range usage {
+		fmt.Fprintf(w, "  %s → %s\t%d requests\tlast %s\t%s\n",
+			u.Alias, u.Endpoint, u.Requests, formatDuration(time.Since(u.LastSeen)), strings.Join(u.Students, ", "))
 	}
 	w.Flush()
-	rows.Close()
+}
+
+// terminalWidth returns the width of stdout, or 80 when it is not a
+// terminal.
+func terminalWidth() int {
+	width, _, err := term.GetSize(int(os.Stdout.Fd()))
+	if err != nil || width <= 0 {
+		return 80
+	}
+	return width
+}
+
+// printTimeSeries draws per-minute requests and errors as sparklines, so
+// an instructor can see whether the class is speeding up or stalling. Long
+// ranges arrive in wider buckets and are labelled accordingly.
+func printTimeSeries(buckets []monitor.MinuteBucket, loc *time.Location) {
+	requests := make([]int, len(buckets))
+	errors := make([]int, len(buckets))
+	peak, errorPeak := 0, 0
+	for i, b := range buckets {
+		requests[i], errors[i] = b.Requests, b.Errors
+		if b.Requests > peak {
+			peak = b.Requests
+		}
+		if b.Errors > errorPeak {
+			errorPeak = b.Errors
+		}
+	}
+
+	width := terminalWidth() - 4
+	requestLine, per := chart.Sparkline(requests, width)
+	errorLine, _ := chart.Sparkline(errors, width)
+
+	minutes := buckets[0].Minutes
+	if minutes < 1 {
+		minutes = 1
+	}
+	unit, layout := "/min", "15:04"
+	if minutes > 1 {
+		unit = " per " + chart.Step(minutes)
+	}
+	if minutes >= 60 {
+		layout = "Jan 2 15:04"
+	}
+	first, last := buckets[0].Minute.In(loc), buckets[len(buckets)-1].Minute.In(loc)
 
 	fmt.Println()
+	fmt.Printf("Requests per %s, %s-%s (one column per %s, peak %d%s):\n",
+		chart.Step(minutes), first.Format(layout), last.Format(layout), chart.Step(per*minutes), peak, unit)
+	fmt.Printf("  %s\n", requestLine)
+	fmt.Printf("Errors per %s (peak %d%s):\n", chart.Step(minutes), errorPeak, unit)
+	fmt.Printf("  %s\n", errorLine)
+}
+
+// printLatency draws the response time histogram with its percentiles.
+func printLatency(l monitor.Latency) {
+	fmt.Println()
+	fmt.Printf("Latency: p50 %dms  p95 %dms  p99 %dms  max %dms\n", l.P50, l.P95, l.P99, l.Max)
+
+	most := 0
+	for _, b := range l.Buckets {
+		if b.Count > most {
+			most = b.Count
+		}
+	}
+	barWidth := terminalWidth() - 24
+	if barWidth > 50 {
+		barWidth = 50
+	}
 
-	// Error rate
-	var errorCount int
-	db.QueryRow(`
-        SELECT COUNT(*) FROM activity_log
-        `+whereClause+` AND response_code >= 400
-    `, args...).Scan(&errorCount)
-
-	errorRate := 0.0
-	if totalRequests > 0 {
-		errorRate = float64(errorCount) / float64(totalRequests) * 100
-	}
-	fmt.Printf("Error Rate: %.1f%% (%d errors)\n", errorRate, errorCount)
-}
-
-func runStudentProgress(db *sql.DB) {
-	fmt.Println("=== Student Progress ===\n")
-
-	rows, _ := db.Query(`
-        SELECT
-            name,
-            COUNT(*) as total_requests,
-            MIN(timestamp) as first_seen,
-            MAX(timestamp) as last_seen,
-            COUNT(DISTINCT session_id) as sessions
-        FROM activity_log
-        WHERE name IS NOT NULL
-          AND timestamp >= datetime('now', '-4 hours')
-        GROUP BY name
-        ORDER BY total_requests DESC
-    `)
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', tabwriter.AlignRight)
+	for i, b := range l.Buckets {
+		label := fmt.Sprintf("<= %dms", b.UpperMs)
+		if b.UpperMs == 0 {
+			label = fmt.Sprintf("> %dms", l.Buckets[i-1].UpperMs)
+		}
+		bar := 0
+		if most > 0 {
+			bar = b.Count * barWidth / most
+		}
+		if bar == 0 && b.Count > 0 {
+			bar = 1
+		}
+		fmt.Fprintf(w, "  %s\t%d\t %s\n", label, b.Count, strings.Repeat("█", bar))
+	}
+	w.Flush()
+}
+
+// studentRecord tags a students-mode row with its section for ndjson.
+type studentRecord struct {
+	Section string `json:"section"`
+	monitor.StudentProgress
+}
+
+type inactiveRecord struct {
+	Section string `json:"section"`
+	monitor.InactiveStudent
+}
+
+func runStudentProgress(db *sql.DB, r monitor.Range, loc *time.Location, format string) {
+	ctx := context.Background()
+	if r.Since.IsZero() {
+		// Default: last 4 hours
+		r.Since = time.Now().Add(-4 * time.Hour)
+	}
+
+	students, err := monitor.LoadStudentProgress(ctx, db, r)
+	if err != nil {
+		exitWithError(err)
+	}
+
+	// Anyone ever seen who has been quiet for 15 minutes
+	inactive, err := monitor.LoadInactiveStudents(ctx, db, monitor.Range{}, time.Now().Add(-15*time.Minute))
+	if err != nil {
+		exitWithError(err)
+	}
+
+	switch format {
+	case formatJSON:
+		writeJSON(os.Stdout, struct {
+			Students []monitor.StudentProgress `json:"students"`
+			Inactive []monitor.InactiveStudent `json:"inactive"`
+		}{students, inactive})
+		return
+	case formatNDJSON:
+		records := make([]interface{}, 0, len(students)+len(inactive))
+		for _, s := range students {
+			records = append(records, studentRecord{"students", s})
+		}
+		for _, s := range inactive {
+			records = append(records, inactiveRecord{"inactive", s})
+		}
+		writeNDJSON(os.Stdout, records...)
+		return
+	case formatCSV:
+		var rows [][]string
+		for _, s := range students {
+			rows = append(rows, []string{"students", s.Name, strconv.Itoa(s.TotalRequests),
+				csvTime(s.FirstSeen), csvTime(s.LastSeen), strconv.Itoa(s.Sessions)})
+		}
+		for _, s := range inactive {
+			rows = append(rows, []string{"inactive", s.Name, "", "", csvTime(s.LastSeen), ""})
+		}
+		writeCSV(os.Stdout, []string{"section", "name", "total_requests", "first_seen", "last_seen", "sessions"}, rows)
+		return
+	}
+
+	fmt.Printf("=== Student Progress ===\n\n")
 
 	w := tabwriter.NewWriter(os.Stdout, 0, 0, 3, ' ', 0)
 	fmt.Fprintf(w, "Student\tRequests\tFirst Seen\tLast Seen\tSessions\n")
 	fmt.Fprintf(w, "-------\t--------\t----------\t---------\t--------\n")
 
-	for rows.Next() {
-		var name string
-		var totalRequests, sessions int
-		var firstSeen, lastSeen time.Time
-
-		rows.Scan(&name, &totalRequests, &firstSeen, &lastSeen, &sessions)
-
+	for _, s := range students {
 		fmt.Fprintf(w, "%s\t%d\t%s\t%s\t%d\n",
-			truncate(name, 20),
-			totalRequests,
-			firstSeen.Format("15:04"),
-			lastSeen.Format("15:04"),
-			sessions)
+			truncate(s.Name, 20),
+			s.TotalRequests,
+			s.FirstSeen.In(loc).Format("15:04"),
+			s.LastSeen.In(loc).Format("15:04"),
+			s.Sessions)
 	}
 
 	w.Flush()
-	rows.Close()
 
 	// Show who hasn't been seen recently
-	fmt.Println("\n=== Inactive Students (>15 min) ===\n")
+	fmt.Printf("\n=== Inactive Students (>15 min) ===\n\n")
 
-	rows, _ = db.Query(`
-        SELECT name, MAX(timestamp) as last_seen
-        FROM activity_log
-        WHERE name IS NOT NULL
-        GROUP BY name
-        HAVING last_seen < datetime('now', '-15 minutes')
-        ORDER BY last_seen DESC
-    `)
+	for _, s := range inactive {
+		ago := time.Since(s.LastSeen).Round(time.Minute)
+		fmt.Printf("  %s (last seen %v ago)\n", s.Name, ago)
+	}
+}
+
+func runRoster(db *sql.DB, session, importPath, format string) {
+	ctx := context.Background()
+
+	if importPath != "" {
+		f, err := os.Open(importPath)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error opening roster: %v\n", err)
+			os.Exit(1)
+		}
+		n, err := monitor.ImportRoster(ctx, db, session, f)
+		f.Close()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error importing roster: %v\n", err)
+			os.Exit(1)
+		}
+		// Keep stdout clean for machine-readable formats
+		out := os.Stdout
+		if format != formatTable {
+			out = os.Stderr
+		}
+		fmt.Fprintf(out, "Imported %d students from %s\n\n", n, importPath)
+	}
 
-	for rows.Next() {
-		var name string
-		var lastSeen time.Time
-		rows.Scan(&name, &lastSeen)
+	if session == "" {
+		latest, err := monitor.LatestRosterSession(ctx, db)
+		if err != nil {
+			exitWithError(err)
+		}
+		if latest == "" {
+			fmt.Fprintf(os.Stderr, "No roster imported; use -import roster.csv -session ID\n")
+			os.Exit(1)
+		}
+		session = latest
+	}
 
-		ago := time.Since(lastSeen).Round(time.Minute)
-		fmt.Printf("  %s (last seen %v ago)\n", name, ago)
+	students, err := monitor.RosterReport(ctx, db, session, monitor.DefaultRosterOptions, time.Now())
+	if err != nil {
+		exitWithError(err)
 	}
-	rows.Close()
-}
 
-func runExport(db *sql.DB, since, student string) {
-	whereClause := "WHERE 1=1"
-	args := []interface{}{}
+	switch format {
+	case formatJSON:
+		writeJSON(os.Stdout, struct {
+			Session  string                  `json:"session"`
+			Students []monitor.RosterStudent `json:"students"`
+		}{session, students})
+		return
+	case formatNDJSON:
+		records := make([]interface{}, len(students))
+		for i, s := range students {
+			records[i] = s
+		}
+		writeNDJSON(os.Stdout, records...)
+		return
+	case formatCSV:
+		rows := make([][]string, len(students))
+		for i, s := range students {
+			rows[i] = []string{s.Name, string(s.Status), strconv.Itoa(s.Requests),
+				strconv.Itoa(s.Errors), s.Endpoint, strconv.Itoa(s.RunLength), csvTime(s.LastSeen)}
+		}
+		writeCSV(os.Stdout, []string{"name", "status", "requests", "errors", "endpoint", "run_length", "last_seen"}, rows)
+		return
+	}
 
-	if since != "" {
-		whereClause += " AND timestamp >= ?"
-		args = append(args, since)
+	fmt.Printf("=== Roster: %s ===\n\n", session)
+	if len(students) == 0 {
+		fmt.Println("No roster for this session")
+		return
 	}
 
-	if student != "" {
-		whereClause += " AND name = ?"
-		args = append(args, student)
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 3, ' ', 0)
+	fmt.Fprintf(w, "Student\tStatus\tRequests\tErrors\tCurrent Endpoint\tLast Seen\n")
+	fmt.Fprintf(w, "-------\t------\t--------\t------\t----------------\t---------\n")
+
+	counts := map[monitor.RosterStatus]int{}
+	for _, s := range students {
+		counts[s.Status]++
+
+		endpoint, lastSeen := "-", "-"
+		if s.Requests > 0 {
+			endpoint = fmt.Sprintf("%s (x%d)", s.Endpoint, s.RunLength)
+			lastSeen = formatDuration(time.Since(s.LastSeen).Round(time.Second))
+		}
+
+		fmt.Fprintf(w, "%s\t%s\t%d\t%d\t%s\t%s\n",
+			truncate(s.Name, 20),
+			s.Status,
+			s.Requests,
+			s.Errors,
+			endpoint,
+			lastSeen)
 	}
+	w.Flush()
 
-	rows, err := db.Query(`
-        SELECT timestamp, name, endpoint, session_id, ip_address,
-               response_code, response_time_ms
-        FROM activity_log
-        `+whereClause+`
-        ORDER BY timestamp
-    `, args...)
+	fmt.Printf("\n%d expected: %d ok, %d never showed up, %d only errors, %d stuck\n",
+		len(students),
+		counts[monitor.RosterOK],
+		counts[monitor.RosterAbsent],
+		counts[monitor.RosterFailing],
+		counts[monitor.RosterStuck])
+}
 
+// exerciseRecord is one student's row of the exercises grid.
+type exerciseRecord struct {
+	Name    string                `json:"name"`
+	Reached map[string]*time.Time `json:"reached"`
+	Done    int                   `json:"done"`
+}
+
+// loadMilestones returns the milestones in path, or the defaults when path
+// is empty, exiting on error.
+func loadMilestones(path string) []monitor.Milestone {
+	if path == "" {
+		return monitor.DefaultMilestones
+	}
+	f, err := os.Open(path)
 	if err != nil {
-		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		fmt.Fprintf(os.Stderr, "Error opening milestones: %v\n", err)
 		os.Exit(1)
 	}
+	defer f.Close()
+	milestones, err := monitor.LoadMilestones(f)
+	if err != nil {
+		exitWithError(err)
+	}
+	return milestones
+}
 
-	// CSV output
-	fmt.Println("timestamp,name,endpoint,session_id,ip_address,response_code,response_time_ms")
+func runExercises(db *sql.DB, session, milestonesPath string, loc *time.Location, format string) {
+	milestones := loadMilestones(milestonesPath)
+
+	// Without a session, look at the same window as the students mode
+	var r monitor.Range
+	if session == "" {
+		r = monitor.Last(4 * time.Hour)
+	}
+	progress, err := monitor.ExerciseProgress(context.Background(), db, milestones, session, r)
+	if err != nil {
+		exitWithError(err)
+	}
+
+	switch format {
+	case formatJSON, formatNDJSON:
+		records := make([]interface{}, len(progress))
+		for i, p := range progress {
+			records[i] = exerciseRecord{p.Name, p.ReachedByID(milestones), p.Done()}
+		}
+		if format == formatNDJSON {
+			writeNDJSON(os.Stdout, records...)
+			return
+		}
+		writeJSON(os.Stdout, struct {
+			Session    string              `json:"session,omitempty"`
+			Milestones []monitor.Milestone `json:"milestones"`
+			Students   []interface{}       `json:"students"`
+		}{session, milestones, records})
+		return
+	case formatCSV:
+		header := []string{"name"}
+		for _, m := range milestones {
+			header = append(header, m.ID)
+		}
+		header = append(header, "done")
+
+		rows := make([][]string, len(progress))
+		for i, p := range progress {
+			row := []string{p.Name}
+			for _, t := range p.Reached {
+				row = append(row, csvTime(t))
+			}
+			rows[i] = append(row, strconv.Itoa(p.Done()))
+		}
+		writeCSV(os.Stdout, header, rows)
+		return
+	}
 
-	for rows.Next() {
-		var ts time.Time
-		var name, endpoint, sessionID, ip sql.NullString
-		var responseCode sql.NullInt64
-		var responseTime sql.NullInt64
+	if session != "" {
+		fmt.Printf("=== Exercise Progress: %s ===\n\n", session)
+	} else {
+		fmt.Printf("=== Exercise Progress (last 4 hours) ===\n\n")
+	}
 
-		rows.Scan(&ts, &name, &endpoint, &sessionID, &ip, &responseCode, &responseTime)
+	if len(progress) == 0 {
+		fmt.Println("No student activity")
+		return
+	}
 
-		fmt.Printf("%s,%s,%s,%s,%s,%d,%d\n",
-			ts.Format(time.RFC3339),
-			nullStringOr(name, ""),
-			nullStringOr(endpoint, ""),
-			nullStringOr(sessionID, ""),
-			nullStringOr(ip, ""),
-			nullInt64Or(responseCode, 0),
-			nullInt64Or(responseTime, 0))
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintf(w, "Student")
+	for _, m := range milestones {
+		fmt.Fprintf(w, "\t%s", m.ID)
+	}
+	fmt.Fprintf(w, "\tDone\n")
+
+	for _, p := range progress {
+		fmt.Fprintf(w, "%s", truncate(p.Name, 20))
+		for _, t := range p.Reached {
+			if t.IsZero() {
+				fmt.Fprintf(w, "\t·")
+			} else {
+				fmt.Fprintf(w, "\t✓ %s", t.In(loc).Format("15:04"))
+			}
+		}
+		fmt.Fprintf(w, "\t%d/%d\n", p.Done(), len(milestones))
+	}
+	w.Flush()
+
+	fmt.Println()
+	for i, m := range milestones {
+		reached := 0
+		for _, p := range progress {
+			if !p.Reached[i].IsZero() {
+				reached++
+			}
+		}
+		label := m.Label
+		if m.Exercise != "" {
+			label = m.Exercise + ": " + label
+		}
+		fmt.Printf("  %-8s %s (%d/%d)\n", m.ID, label, reached, len(progress))
 	}
-	rows.Close()
 }
 
-func showRecentActivity(db *sql.DB, fromID, toID int64) {
-	rows, _ := db.Query(`
-        SELECT id, timestamp, name, endpoint, response_code, session_id
-        FROM activity_log
-        WHERE id > ? AND id <= ?
-        ORDER BY id
-    `, fromID, toID)
+// exportColumns maps each -columns name to its value in an export row.
+var exportColumns = map[string]func(monitor.ActivityEntry) string{
+	"id":               func(e monitor.ActivityEntry) string { return strconv.FormatInt(e.ID, 10) },
+	"timestamp":        func(e monitor.ActivityEntry) string { return e.Timestamp.Format(time.RFC3339) },
+	"name":             func(e monitor.ActivityEntry) string { return e.Name },
+	"endpoint":         func(e monitor.ActivityEntry) string { return e.Endpoint },
+	"session_id":       func(e monitor.ActivityEntry) string { return e.SessionID },
+	"ip_address":       func(e monitor.ActivityEntry) string { return e.IPAddress },
+	"user_agent":       func(e monitor.ActivityEntry) string { return e.UserAgent },
+	"response_code":    func(e monitor.ActivityEntry) string { return strconv.Itoa(e.ResponseCode) },
+	"response_time_ms": func(e monitor.ActivityEntry) string { return strconv.Itoa(e.ResponseTimeMs) },
+}
 
-	for rows.Next() {
-		var id int64
-		var ts time.Time
-		var name, endpoint, sessionID sql.NullString
-		var responseCode int
+// allExportColumns is the order used by -columns all.
+var allExportColumns = []string{"id", "timestamp", "name", "endpoint", "session_id",
+	"ip_address", "user_agent", "response_code", "response_time_ms"}
+
+var defaultExportColumns = []string{"timestamp", "name", "endpoint", "session_id",
+	"ip_address", "response_code", "response_time_ms"}
+
+// parseColumns validates a comma-separated -columns value.
+func parseColumns(spec string) ([]string, error) {
+	switch spec {
+	case "":
+		return defaultExportColumns, nil
+	case "all":
+		return allExportColumns, nil
+	}
+
+	var columns []string
+	for _, c := range strings.Split(spec, ",") {
+		c = strings.TrimSpace(c)
+		if _, ok := exportColumns[c]; !ok {
+			return nil, fmt.Errorf("unknown column %q (available: %s)", c, strings.Join(allExportColumns, ", "))
+		}
+		columns = append(columns, c)
+	}
+	return columns, nil
+}
+
+// exportRecord is an activity entry cut down to the -columns, in their
+// order, for json and ndjson. The columns are named after the entry's JSON
+// fields, which keep their types.
+type exportRecord struct {
+	columns []string
+	fields  map[string]json.RawMessage
+}
+
+func newExportRecord(e monitor.ActivityEntry, columns []string) (exportRecord, error) {
+	b, err := json.Marshal(e)
+	if err != nil {
+		return exportRecord{}, err
+	}
+	r := exportRecord{columns: columns}
+	if err := json.Unmarshal(b, &r.fields); err != nil {
+		return exportRecord{}, err
+	}
+	return r, nil
+}
+
+func (r exportRecord) MarshalJSON() ([]byte, error) {
+	var b bytes.Buffer
+	b.WriteByte('{')
+	for i, c := range r.columns {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		key, _ := json.Marshal(c)
+		b.Write(key)
+		b.WriteByte(':')
+		b.Write(r.fields[c])
+	}
+	b.WriteByte('}')
+	return b.Bytes(), nil
+}
+
+type exportOptions struct {
+	since, until time.Time
+	student      string
+	columns      []string
+	output       string
+	messages     string
+	gzip         bool
+}
+
+func runExport(db *sql.DB, opts exportOptions, format string) {
+	ctx := context.Background()
+
+	entries, err := monitor.LoadActivity(ctx, db, monitor.Range{Since: opts.since, Until: opts.until}, opts.student)
+	if err != nil {
+		exitWithError(err)
+	}
+
+	out, err := openOutput(opts.output, opts.gzip)
+	if err != nil {
+		exitWithError(err)
+	}
+	writeActivity(out, entries, opts.columns, format)
+	if err := out.Close(); err != nil {
+		exitWithError(err)
+	}
+
+	if opts.messages == "" {
+		return
+	}
+
+	messages, err := monitor.LoadUserMessages(ctx, db, monitor.Range{Since: opts.since, Until: opts.until}, opts.student)
+	if err != nil {
+		exitWithError(err)
+	}
+
+	out, err = openOutput(opts.messages, opts.gzip)
+	if err != nil {
+		exitWithError(err)
+	}
+	writeUserMessages(out, messages, format)
+	if err := out.Close(); err != nil {
+		exitWithError(err)
+	}
+}
+
+func writeActivity(out io.Writer, entries []monitor.ActivityEntry, columns []string, format string) {
+	if format == formatJSON || format == formatNDJSON {
+		records := make([]interface{}, len(entries))
+		for i, e := range entries {
+			r, err := newExportRecord(e, columns)
+			if err != nil {
+				exitWithError(err)
+			}
+			records[i] = r
+		}
+		if format == formatJSON {
+			writeJSON(out, records)
+		} else {
+			writeNDJSON(out, records...)
+		}
+		return
+	}
 
-		rows.Scan(&id, &ts, &name, &endpoint, &responseCode, &sessionID)
+	rows := make([][]string, len(entries))
+	for i, e := range entries {
+		row := make([]string, len(columns))
+		for j, c := range columns {
+			row[j] = exportColumns[c](e)
+		}
+		rows[i] = row
+	}
 
-		status := "✓"
-		if responseCode >= 400 {
-			status = "✗"
+	if format == formatTable {
+		w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, strings.Join(columns, "\t"))
+		for _, row := range rows {
+			fmt.Fprintln(w, strings.Join(row, "\t"))
 		}
+		w.Flush()
+		return
+	}
 
-		nameStr := "anonymous"
-		if name.Valid && name.String != "" {
-			nameStr = name.String
+	// CSV output
+	writeCSV(out, columns, rows)
+}
+
+func writeUserMessages(out io.Writer, messages []monitor.UserMessage, format string) {
+	switch format {
+	case formatJSON:
+		writeJSON(out, messages)
+		return
+	case formatNDJSON:
+		records := make([]interface{}, len(messages))
+		for i, m := range messages {
+			records[i] = m
 		}
+		writeNDJSON(out, records...)
+		return
+	}
 
-		fmt.Printf("%s [%s] %-15s %s\n",
-			status,
-			ts.Format("15:04:05"),
-			truncate(nameStr, 15),
-			endpoint.String)
+	header := []string{"message_id", "created_at", "from", "to", "message", "ip_address"}
+	rows := make([][]string, len(messages))
+	for i, m := range messages {
+		rows[i] = []string{m.MessageID, m.CreatedAt.Format(time.RFC3339), m.From, m.To, m.Message, m.IPAddress}
 	}
-	rows.Close()
+
+	if format == formatTable {
+		w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, strings.Join(header, "\t"))
+		for _, row := range rows {
+			fmt.Fprintln(w, strings.Join(row, "\t"))
+		}
+		w.Flush()
+		return
+	}
+
+	writeCSV(out, header, rows)
 }
 
 func truncate(s string, maxLen int) string {
@@ -489,16 +987,414 @@ func truncate(s string, maxLen int) string {
 	return s[:maxLen-3] + "..."
 }
 
-func nullStringOr(ns sql.NullString, def string) string {
-	if ns.Valid {
-		return ns.String
+// writeJSON prints v as an indented JSON document.
+func writeJSON(out io.Writer, v interface{}) {
+	enc := json.NewEncoder(out)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(v); err != nil {
+		exitWithError(err)
+	}
+}
+
+// writeNDJSON prints each record as a single line of JSON.
+func writeNDJSON(out io.Writer, records ...interface{}) {
+	enc := json.NewEncoder(out)
+	for _, r := range records {
+		if err := enc.Encode(r); err != nil {
+			exitWithError(err)
+		}
+	}
+}
+
+// writeCSV prints a header row followed by rows, quoting as needed.
+func writeCSV(out io.Writer, header []string, rows [][]string) {
+	w := csv.NewWriter(out)
+	w.Write(header)
+	w.WriteAll(rows)
+	if err := w.Error(); err != nil {
+		exitWithError(err)
+	}
+}
+
+// openOutput opens path for writing, or stdout for "" and "-". Output is
+// gzipped when compress is set or the path ends in .gz.
+func openOutput(path string, compress bool) (io.WriteCloser, error) {
+	var out io.WriteCloser = nopCloser{os.Stdout}
+	if path != "" && path != "-" {
+		f, err := os.Create(path)
+		if err != nil {
+			return nil, err
+		}
+		out = f
+	}
+
+	if compress || strings.HasSuffix(path, ".gz") {
+		return gzipWriter{gzip.NewWriter(out), out}, nil
+	}
+	return out, nil
+}
+
+type nopCloser struct{ io.Writer }
+
+func (nopCloser) Close() error { return nil }
+
+// gzipWriter closes the compressor before the file underneath it.
+type gzipWriter struct {
+	*gzip.Writer
+	file io.Closer
+}
+
+func (g gzipWriter) Close() error {
+	if err := g.Writer.Close(); err != nil {
+		g.file.Close()
+		return err
+	}
+	return g.file.Close()
+}
+
+// csvTime formats a timestamp for CSV output, leaving zero times empty.
+func csvTime(t time.Time) string {
+	if t.IsZero() {
+		return ""
+	}
+	return t.Format(time.RFC3339)
+}
+
+func runPerf(db *sql.DB, r monitor.Range, saveBaseline bool, loc *time.Location, format string) {
+	if r.Since.IsZero() {
+		// Default: last 2 hours, as in summary mode
+		r.Since = time.Now().Add(-2 * time.Hour)
+	}
+	ctx := context.Background()
+
+	report, err := monitor.LoadPerf(ctx, db, r, monitor.DefaultPerfOptions)
+	if err != nil {
+		exitWithError(err)
+	}
+
+	if saveBaseline && report.Overall.Count == 0 {
+		exitWithError(fmt.Errorf("no requests in the window; baseline not saved"))
+	}
+
+	// The report compares against the previous baseline, so print it
+	// before replacing that.
+	printPerf(report, loc, format)
+
+	if saveBaseline {
+		if err := monitor.SavePerfBaseline(ctx, db, report); err != nil {
+			exitWithError(err)
+		}
+		// Keep stdout clean for machine-readable formats
+		out := os.Stdout
+		if format != formatTable {
+			out = os.Stderr
+		}
+		fmt.Fprintf(out, "\nSaved baseline from %d requests\n", report.Overall.Count)
+	}
+}
+
+func printPerf(report monitor.PerfReport, loc *time.Location, format string) {
+	switch format {
+	case formatJSON:
+		writeJSON(os.Stdout, report)
+		return
+	case formatNDJSON:
+		records := make([]interface{}, 0, len(report.Endpoints)+len(report.Statuses)+len(report.Regressions))
+		for _, e := range report.Endpoints {
+			records = append(records, struct {
+				Section string `json:"section"`
+				monitor.EndpointLatency
+			}{"endpoint", e})
+		}
+		for _, s := range report.Statuses {
+			records = append(records, struct {
+				Section string `json:"section"`
+				monitor.StatusLatency
+			}{"status", s})
+		}
+		for _, reg := range report.Regressions {
+			records = append(records, struct {
+				Section string `json:"section"`
+				monitor.Regression
+			}{"regression", reg})
+		}
+		writeNDJSON(os.Stdout, records...)
+		return
+	case formatCSV:
+		regressed := map[string]bool{}
+		for _, reg := range report.Regressions {
+			regressed[reg.Endpoint] = true
+		}
+		var rows [][]string
+		for _, e := range append([]monitor.EndpointLatency{{Endpoint: monitor.AllEndpoints, LatencyStats: report.Overall}}, report.Endpoints...) {
+			base := ""
+			if b, ok := report.Baseline[e.Endpoint]; ok {
+				base = strconv.Itoa(b.P95)
+			}
+			rows = append(rows, []string{e.Endpoint, strconv.Itoa(e.Count), strconv.Itoa(e.P50),
+				strconv.Itoa(e.P95), strconv.Itoa(e.P99), strconv.Itoa(e.Max), base,
+				strconv.FormatBool(regressed[e.Endpoint])})
+		}
+		writeCSV(os.Stdout, []string{"endpoint", "requests", "p50_ms", "p95_ms", "p99_ms", "max_ms", "baseline_p95_ms", "regressed"}, rows)
+		return
+	}
+
+	fmt.Printf("=== Performance ===\n\n")
+	if report.Overall.Count == 0 {
+		fmt.Println("No requests in this window.")
+		return
+	}
+	o := report.Overall
+	fmt.Printf("Overall: %d requests  p50 %dms  p95 %dms  p99 %dms  max %dms\n\n", o.Count, o.P50, o.P95, o.P99, o.Max)
+
+	fmt.Println("By Endpoint:")
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 3, ' ', 0)
+	fmt.Fprintln(w, "  Endpoint\tRequests\tp50\tp95\tp99\tMax\tBaseline p95")
+	for _, e := range report.Endpoints {
+		base := "-"
+		if b, ok := report.Baseline[e.Endpoint]; ok {
+			base = fmt.Sprintf("%dms", b.P95)
+		}
+		fmt.Fprintf(w, "  %s\t%d\t%dms\t%dms\t%dms\t%dms\t%s\n", e.Endpoint, e.Count, e.P50, e.P95, e.P99, e.Max, base)
+	}
+	w.Flush()
+
+	fmt.Println()
+	fmt.Println("By Status:")
+	w = tabwriter.NewWriter(os.Stdout, 0, 0, 3, ' ', 0)
+	fmt.Fprintln(w, "  Status\tRequests\tp50\tp95\tp99\tMax")
+	for _, s := range report.Statuses {
+		fmt.Fprintf(w, "  %d\t%d\t%dms\t%dms\t%dms\t%dms\n", s.Status, s.Count, s.P50, s.P95, s.P99, s.Max)
+	}
+	w.Flush()
+
+	fmt.Println()
+	fmt.Println("Slowest Requests:")
+	w = tabwriter.NewWriter(os.Stdout, 0, 0, 3, ' ', 0)
+	for _, e := range report.Slowest {
+		name := e.Name
+		if name == "" {
+			name = "anonymous"
+		}
+		fmt.Fprintf(w, "  %s\t%s\t%s\t%d\t%dms\n", e.Timestamp.In(loc).Format("15:04:05"),
+			truncate(name, 20), e.Endpoint, e.ResponseCode, e.ResponseTimeMs)
+	}
+	w.Flush()
+
+	fmt.Println()
+	switch {
+	case report.BaselineRecordedAt == nil:
+		fmt.Println("No baseline recorded; run with -save-baseline during a normal class to record one.")
+	case len(report.Regressions) == 0:
+		fmt.Printf("No regressions against the baseline from %s.\n", report.BaselineRecordedAt.In(loc).Format("2006-01-02 15:04"))
+	default:
+		fmt.Printf("=== Regressions vs baseline from %s ===\n\n", report.BaselineRecordedAt.In(loc).Format("2006-01-02 15:04"))
+		for _, reg := range report.Regressions {
+			endpoint := reg.Endpoint
+			if endpoint == monitor.AllEndpoints {
+				endpoint = "all endpoints"
+			}
+			fmt.Printf("  ✗ %s %s %dms (baseline %dms, %.1fx)\n", endpoint, reg.Metric, reg.CurrentMs, reg.BaselineMs, reg.Factor)
+		}
+	}
+}
+
+// runReport writes the session report as output.html and output.md,
+// named after the session unless -o is given.
+func runReport(db *sql.DB, session, milestonesPath, output string, loc *time.Location) {
+	if session == "" {
+		fmt.Fprintf(os.Stderr, "Report mode needs -session ID\n")
+		os.Exit(1)
+	}
+	milestones := loadMilestones(milestonesPath)
+
+	rep, err := report.Load(context.Background(), db, session, milestones, loc)
+	if err != nil {
+		exitWithError(err)
+	}
+
+	if output == "" {
+		output = "happywatch-" + session
+	}
+	output = strings.TrimSuffix(strings.TrimSuffix(output, ".html"), ".md")
+
+	for _, r := range []struct {
+		ext   string
+		write func(io.Writer, report.Report) error
+	}{
+		{".html", report.WriteHTML},
+		{".md", report.WriteMarkdown},
+	} {
+		path := output + r.ext
+		f, err := os.Create(path)
+		if err != nil {
+			exitWithError(err)
+		}
+		if err := r.write(f, rep); err != nil {
+			f.Close()
+			exitWithError(fmt.Errorf("failed to write %s: %w", path, err))
+		}
+		if err := f.Close(); err != nil {
+			exitWithError(err)
+		}
+		fmt.Printf("Wrote %s\n", path)
+	}
+}
+
+// alertOptions holds the alert mode flags.
+type alertOptions struct {
+	rules    string
+	interval time.Duration
+	bell     bool
+	command  string
+	webhook  string
+	mailTo   string
+	mailFrom string
+	sendmail string
+	loc      *time.Location // to write alert times in
+}
+
+func runAlert(db *sql.DB, opts alertOptions, format string) {
+	rules := alert.DefaultRules
+	if opts.rules != "" {
+		f, err := os.Open(opts.rules)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error opening rules: %v\n", err)
+			os.Exit(1)
+		}
+		rules, err = alert.LoadRules(f)
+		f.Close()
+		if err != nil {
+			exitWithError(err)
+		}
 	}
-	return def
+
+	var notifiers []alert.Notifier
+	switch format {
+	case formatTable:
+		notifiers = append(notifiers, alert.Terminal{W: os.Stdout, Bell: opts.bell})
+	case formatJSON, formatNDJSON:
+		enc := json.NewEncoder(os.Stdout)
+		notifiers = append(notifiers, alert.NotifierFunc(func(ctx context.Context, a alert.Alert) error {
+			return enc.Encode(a)
+		}))
+	case formatCSV:
+		cw := csv.NewWriter(os.Stdout)
+		cw.Write([]string{"time", "state", "rule", "kind", "subject", "value", "message"})
+		cw.Flush()
+		notifiers = append(notifiers, alert.NotifierFunc(func(ctx context.Context, a alert.Alert) error {
+			cw.Write([]string{csvTime(a.Time), a.State(), a.Rule, a.Kind, a.Subject,
+				strconv.FormatFloat(a.Value, 'f', 1, 64), a.Message})
+			cw.Flush()
+			return cw.Error()
+		}))
+	}
+	if opts.command != "" {
+		notifiers = append(notifiers, alert.Command{Command: opts.command})
+	}
+	if opts.webhook != "" {
+		notifiers = append(notifiers, alert.Webhook{URL: opts.webhook})
+	}
+	if opts.mailTo != "" {
+		var to []string
+		for _, addr := range strings.Split(opts.mailTo, ",") {
+			if addr = strings.TrimSpace(addr); addr != "" {
+				to = append(to, addr)
+			}
+		}
+		notifiers = append(notifiers, alert.Sendmail{Path: opts.sendmail, From: opts.mailFrom, To: to})
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	if format == formatTable {
+		ids := make([]string, len(rules))
+		for i, r := range rules {
+			ids[i] = r.ID
+		}
+		fmt.Fprintf(os.Stderr, "Watching %d rules (%s) every %s; Ctrl+C to stop\n",
+			len(rules), strings.Join(ids, ", "), opts.interval)
+	}
+
+	engine := alert.NewEngine(rules, notifiers...)
+	ticker := time.NewTicker(opts.interval)
+	defer ticker.Stop()
+
+	for {
+		_, err := engine.Check(ctx, db, time.Now().In(opts.loc))
+		if err != nil && ctx.Err() == nil {
+			// Keep watching: the database may be locked for a moment or a
+			// webhook briefly down
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func exitWithError(err error) {
+	fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+	os.Exit(1)
 }
 
-func nullInt64Or(ni sql.NullInt64, def int64) int64 {
-	if ni.Valid {
-		return ni.Int64
+// activeWindow is how recently a student must have made a request to count
+// as active in the metrics, as on the dashboard's inactive list.
+const activeWindow = 15 * time.Minute
+
+// runMetrics writes the API's metrics in the Prometheus text format, with
+// student counts added. With -o the file is replaced atomically, as the
+// node_exporter textfile collector needs.
+func runMetrics(db *sql.DB, output string) {
+	ctx := context.Background()
+	snapshot, err := metrics.Load(ctx, db, api.Endpoints())
+	if err != nil {
+		exitWithError(fmt.Errorf("failed to load metrics: %w", err))
+	}
+
+	users, err := monitor.LiveUsers(ctx, db, monitor.Last(time.Hour))
+	if err != nil {
+		exitWithError(fmt.Errorf("failed to load students: %w", err))
+	}
+	active := 0
+	cutoff := time.Now().Add(-activeWindow)
+	for _, u := range users {
+		if u.LastSeen.After(cutoff) {
+			active++
+		}
+	}
+	snapshot.Gauges = []metrics.Gauge{
+		{Name: "happywatch_students_last_hour", Help: "Students who made a request in the last hour.", Value: float64(len(users))},
+		{Name: "happywatch_active_students", Help: "Students who made a request in the last 15 minutes.", Value: float64(active)},
+	}
+
+	if output == "" {
+		if err := metrics.Write(os.Stdout, snapshot); err != nil {
+			exitWithError(err)
+		}
+		return
+	}
+
+	tmp := output + ".tmp"
+	f, err := os.Create(tmp)
+	if err != nil {
+		exitWithError(err)
+	}
+	if err := metrics.Write(f, snapshot); err != nil {
+		f.Close()
+		os.Remove(tmp)
+		exitWithError(fmt.Errorf("failed to write %s: %w", tmp, err))
+	}
+	if err := f.Close(); err != nil {
+		os.Remove(tmp)
+		exitWithError(err)
+	}
+	if err := os.Rename(tmp, output); err != nil {
+		os.Remove(tmp)
+		exitWithError(err)
 	}
-	return def
 }
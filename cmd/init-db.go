@@ -2,68 +2,44 @@ package main
 
 import (
 	"database/sql"
+	"flag"
 	"fmt"
 	"log"
+	"os"
 
+	"github.com/industrial-linguistics/happy-api/internal/health"
+	"github.com/industrial-linguistics/happy-api/internal/i18n"
+	"github.com/industrial-linguistics/happy-api/internal/monitor"
 	_ "github.com/mattn/go-sqlite3"
 )
 
 const dbPath = "/var/www/vhosts/happy.industrial-linguistics.com/data/positive-social.db"
 
-var positiveMessages = []string{
-	"You're doing an amazing job!",
-	"Your code is getting better every day!",
-	"Keep up the excellent work!",
-	"You're making great progress!",
-	"Your debugging skills are impressive!",
-	"That was a clever solution!",
-	"You're really getting the hang of this!",
-	"Your attention to detail is fantastic!",
-	"You're asking all the right questions!",
-	"Great job thinking through that problem!",
-	"Your code is clean and well-organized!",
-	"You're becoming a strong developer!",
-	"That refactoring was spot-on!",
-	"Your test coverage is excellent!",
-	"You're a natural at this!",
-	"Your problem-solving skills shine!",
-	"You write very readable code!",
-	"Your commit messages are clear and helpful!",
-	"You're mastering these concepts quickly!",
-	"Your architecture decisions are sound!",
-	"You're great at breaking down complex problems!",
-	"Your API design is intuitive!",
-	"You're thinking like a senior developer!",
-	"Your code reviews are thoughtful!",
-	"You're building something impressive!",
-	"Your persistence is paying off!",
-	"You're learning at an amazing pace!",
-	"Your error handling is robust!",
-	"You write elegant solutions!",
-	"Your documentation is clear and helpful!",
-	"You're making this look easy!",
-	"Your variable names are descriptive!",
-	"You're following best practices perfectly!",
-	"Your curiosity drives great code!",
-	"You're building confidence with every line!",
-	"Your code is production-ready!",
-	"You understand the fundamentals deeply!",
-	"Your incremental approach is smart!",
-	"You're collaborating effectively!",
-	"Your testing strategy is solid!",
-	"You're thinking about edge cases!",
-	"Your code is maintainable!",
-	"You're writing self-documenting code!",
-	"Your logic is clear and correct!",
-	"You're balancing speed and quality well!",
-	"Your debugging process is methodical!",
-	"You're learning from every mistake!",
-	"Your git workflow is professional!",
-	"You're asking for help at the right times!",
-	"Your code reflects deep understanding!",
-}
-
 func main() {
+	catalogFile := flag.String("catalog", "", "Also import this catalog: one message a line, # for comments")
+	locale := flag.String("locale", "", "Locale of the -catalog messages, e.g. de or pt-BR")
+	flag.Parse()
+
+	catalogs, err := i18n.BuiltIn()
+	if err != nil {
+		log.Fatalf("Error reading the built-in catalogs: %v", err)
+	}
+	if *catalogFile != "" {
+		if *locale == "" {
+			log.Fatal("-catalog needs -locale")
+		}
+		f, err := os.Open(*catalogFile)
+		if err != nil {
+			log.Fatal(err)
+		}
+		messages, err := i18n.ParseCatalog(f)
+		f.Close()
+		if err != nil {
+			log.Fatalf("Error reading %s: %v", *catalogFile, err)
+		}
+		catalogs = append(catalogs, i18n.Catalog{Locale: *locale, Messages: messages})
+	}
+
 	db, err := sql.Open("sqlite3", dbPath)
 	if err != nil {
 		log.Fatal(err)
@@ -76,26 +52,80 @@ func main() {
 		log.Fatalf("Error creating schema: %v", err)
 	}
 
-	// Populate messages
-	for i, msg := range positiveMessages {
-		category := "encouragement"
-		if i%3 == 0 {
-			category = "achievement"
-		} else if i%3 == 1 {
-			category = "persistence"
-		}
+	if err := migrate(db); err != nil {
+		log.Fatalf("Error upgrading schema: %v", err)
+	}
 
-		_, err := db.Exec(`
-            INSERT INTO messages (message, category) VALUES (?, ?)
-        `, msg, category)
+	// /v1/status checks this to tell whether init-db has been run since
+	// the schema last changed
+	if _, err := db.Exec(fmt.Sprintf("PRAGMA user_version = %d", health.SchemaVersion)); err != nil {
+		log.Fatalf("Error setting schema version: %v", err)
+	}
 
-		if err != nil {
-			log.Printf("Error inserting message: %v", err)
+	// Populate messages, skipping any already there so that init-db can be
+	// re-run to add new ones or upgrade the schema
+	added, total := 0, 0
+	for _, c := range catalogs {
+		for i, msg := range c.Messages {
+			category := "encouragement"
+			if i%3 == 0 {
+				category = "achievement"
+			} else if i%3 == 1 {
+				category = "persistence"
+			}
+
+			res, err := db.Exec(`
+                INSERT INTO messages (message, category, locale)
+                SELECT ?, ?, ? WHERE NOT EXISTS (SELECT 1 FROM messages WHERE message = ? AND locale = ?)
+            `, msg, category, c.Locale, msg, c.Locale)
+
+			if err != nil {
+				log.Printf("Error inserting message: %v", err)
+				continue
+			}
+			if n, _ := res.RowsAffected(); n > 0 {
+				added++
+			}
 		}
+		total += len(c.Messages)
 	}
 
 	fmt.Println("Database initialized successfully!")
-	fmt.Printf("Created %d positive messages\n", len(positiveMessages))
+	fmt.Printf("Added %d of %d positive messages in %d locales (schema version %d)\n", added, total, len(catalogs), health.SchemaVersion)
+}
+
+// addedColumns are the columns added to existing tables since the first
+// schema, in order.
+var addedColumns = []struct {
+	table, column, definition string
+}{
+	// Version 2: the error sent with each failed request
+	{"activity_log", "error", "TEXT"},
+	// Version 3: the deprecated alias a request used, if any
+	{"activity_log", "alias", "TEXT"},
+	// Version 4: the language of each message; older ones are English
+	{"messages", "locale", "TEXT NOT NULL DEFAULT 'en'"},
+}
+
+// migrate brings tables made by an older init-db up to date, since
+// CREATE TABLE IF NOT EXISTS leaves them as they were.
+func migrate(db *sql.DB) error {
+	for _, c := range addedColumns {
+		var exists bool
+		err := db.QueryRow(`
+            SELECT COUNT(*) > 0 FROM pragma_table_info(?) WHERE name = ?
+        `, c.table, c.column).Scan(&exists)
+		if err != nil {
+			return err
+		}
+		if exists {
+			continue
+		}
+		if _, err := db.Exec(fmt.Sprintf("ALTER TABLE %s ADD COLUMN %s %s", c.table, c.column, c.definition)); err != nil {
+			return err
+		}
+	}
+	return nil
 }
 
 const schema = `
@@ -103,7 +133,8 @@ CREATE TABLE IF NOT EXISTS messages (
     id INTEGER PRIMARY KEY,
     message TEXT NOT NULL,
     category TEXT,
-    created_at DATETIME DEFAULT CURRENT_TIMESTAMP
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    locale TEXT NOT NULL DEFAULT 'en'
 );
 
 CREATE INDEX IF NOT EXISTS idx_messages_category ON messages(category);
@@ -128,7 +159,9 @@ CREATE TABLE IF NOT EXISTS activity_log (
     ip_address TEXT,
     user_agent TEXT,
     response_code INTEGER,
-    response_time_ms INTEGER
+    response_time_ms INTEGER,
+    error TEXT,
+    alias TEXT
 );
 
 CREATE INDEX IF NOT EXISTS idx_activity_timestamp ON activity_log(timestamp);
@@ -143,4 +176,4 @@ CREATE TABLE IF NOT EXISTS request_stats (
 );
 
 CREATE INDEX IF NOT EXISTS idx_stats_bucket ON request_stats(minute_bucket);
-`
+` + monitor.RosterSchema + monitor.PerfBaselineSchema
@@ -6,3 +6,5 @@ require (
 	github.com/mattn/go-sqlite3 v1.14.18
 	golang.org/x/term v0.27.0
 )
+
+require golang.org/x/sys v0.28.0 // indirect
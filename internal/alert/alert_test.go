@@ -0,0 +1,331 @@
+package alert
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	_ "github.com/mattn/go-sqlite3"
+)
+
+var fixtureNow = time.Now().UTC().Truncate(time.Second)
+
+// openFixture returns an in-memory activity_log on a single connection.
+func openFixture(t *testing.T) *sql.DB {
+	t.Helper()
+
+	db, err := sql.Open("sqlite3", ":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	db.SetMaxOpenConns(1)
+	t.Cleanup(func() { db.Close() })
+
+	if _, err := db.Exec(`
+        CREATE TABLE activity_log (
+            id INTEGER PRIMARY KEY AUTOINCREMENT,
+            timestamp DATETIME DEFAULT CURRENT_TIMESTAMP,
+            endpoint TEXT NOT NULL,
+            name TEXT,
+            session_id TEXT,
+            ip_address TEXT,
+            user_agent TEXT,
+            response_code INTEGER,
+            response_time_ms INTEGER
+        )
+    `); err != nil {
+		t.Fatal(err)
+	}
+	return db
+}
+
+// logRequests logs n requests by name, ago before fixtureNow.
+func logRequests(t *testing.T, db *sql.DB, ago time.Duration, name string, code, n int) {
+	t.Helper()
+	for i := 0; i < n; i++ {
+		_, err := db.Exec(`
+            INSERT INTO activity_log (timestamp, endpoint, name, response_code, response_time_ms)
+            VALUES (?, '/automessage', NULLIF(?, ''), ?, 5)
+        `, fixtureNow.Add(-ago).Format("2006-01-02 15:04:05"), name, code)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func ruleIDs(alerts []Alert) []string {
+	var ids []string
+	for _, a := range alerts {
+		id := a.Rule
+		if a.Subject != "" {
+			id += ":" + a.Subject
+		}
+		if a.Resolved {
+			id += " resolved"
+		}
+		ids = append(ids, id)
+	}
+	return ids
+}
+
+func TestEvaluate(t *testing.T) {
+	db := openFixture(t)
+	ctx := context.Background()
+
+	// Nothing logged: only the no-traffic rule fires
+	alerts, err := Evaluate(ctx, db, DefaultRules, fixtureNow)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := ruleIDs(alerts), []string{"quiet"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("empty log fired %v, want %v", got, want)
+	}
+
+	logRequests(t, db, time.Hour, "dan", 200, 3)
+	logRequests(t, db, 20*time.Minute, "kevin", 200, 1)
+	logRequests(t, db, time.Minute, "alice", 200, 15)
+	logRequests(t, db, time.Minute, "alice", 429, 10)
+
+	alerts, err = Evaluate(ctx, db, DefaultRules, fixtureNow)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"errors", "inactive:kevin", "inactive:dan", "rate-limit"}
+	if got := ruleIDs(alerts); !reflect.DeepEqual(got, want) {
+		t.Fatalf("fired %v, want %v", got, want)
+	}
+	if a := alerts[0]; a.Value != 40 || !strings.Contains(a.Message, "10 of 25 requests") {
+		t.Errorf("error rate alert = %+v, want 40%% of 25 requests", a)
+	}
+	if a := alerts[1]; a.Value != 20 || !strings.Contains(a.Message, "for 20m") {
+		t.Errorf("inactive alert = %+v, want 20 minutes", a)
+	}
+
+	// Below MinRequests the error rate is not judged
+	rules := []Rule{{ID: "errors", Kind: KindErrorRate, Window: Duration(5 * time.Minute), Threshold: 25, MinRequests: 50}}
+	if alerts, err := Evaluate(ctx, db, rules, fixtureNow); err != nil || len(alerts) != 0 {
+		t.Errorf("fired %v (%v) with too few requests", ruleIDs(alerts), err)
+	}
+}
+
+func TestEngineNotifiesChanges(t *testing.T) {
+	db := openFixture(t)
+	ctx := context.Background()
+
+	var got []Alert
+	record := NotifierFunc(func(ctx context.Context, a Alert) error {
+		got = append(got, a)
+		return nil
+	})
+	rules := []Rule{{ID: "inactive", Kind: KindInactive, Window: Duration(15 * time.Minute)}}
+	e := NewEngine(rules, record)
+
+	logRequests(t, db, 20*time.Minute, "kevin", 200, 1)
+	for i := 0; i < 2; i++ {
+		if _, err := e.Check(ctx, db, fixtureNow); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if ids := ruleIDs(got); !reflect.DeepEqual(ids, []string{"inactive:kevin"}) {
+		t.Fatalf("after two checks notified %v, want one firing alert", ids)
+	}
+
+	logRequests(t, db, 0, "kevin", 200, 1)
+	changed, err := e.Check(ctx, db, fixtureNow)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ids := ruleIDs(changed); !reflect.DeepEqual(ids, []string{"inactive:kevin resolved"}) {
+		t.Errorf("after kevin came back got %v, want it resolved", ids)
+	}
+	if len(e.Active()) != 0 {
+		t.Errorf("still active: %v", ruleIDs(e.Active()))
+	}
+}
+
+func TestEngineKeepsInactiveUntilSeen(t *testing.T) {
+	db := openFixture(t)
+	ctx := context.Background()
+
+	var got []Alert
+	record := NotifierFunc(func(ctx context.Context, a Alert) error {
+		got = append(got, a)
+		return nil
+	})
+	rules := []Rule{{ID: "inactive", Kind: KindInactive, Window: Duration(15 * time.Minute)}}
+	e := NewEngine(rules, record)
+
+	logRequests(t, db, 3*time.Hour, "kevin", 200, 1)
+	if _, err := e.Check(ctx, db, fixtureNow); err != nil {
+		t.Fatal(err)
+	}
+
+	// Kevin's last request falls out of the class window
+	later := fixtureNow.Add(2 * time.Hour)
+	for i := 0; i < 2; i++ {
+		if _, err := e.Check(ctx, db, later); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if ids := ruleIDs(got); !reflect.DeepEqual(ids, []string{"inactive:kevin"}) {
+		t.Fatalf("after kevin aged out notified %v, want only the firing alert", ids)
+	}
+	if ids := ruleIDs(e.Active()); !reflect.DeepEqual(ids, []string{"inactive:kevin"}) {
+		t.Errorf("active = %v, want kevin still inactive", ids)
+	}
+
+	logRequests(t, db, -2*time.Hour, "kevin", 200, 1)
+	changed, err := e.Check(ctx, db, later)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ids := ruleIDs(changed); !reflect.DeepEqual(ids, []string{"inactive:kevin resolved"}) {
+		t.Errorf("after kevin came back got %v, want it resolved", ids)
+	}
+}
+
+func TestLoadRules(t *testing.T) {
+	rules, err := LoadRules(strings.NewReader(`[
+        {"id": "slow", "kind": "inactive", "window": "30m"},
+        {"id": "500s", "kind": "status_spike", "window": "1m", "status": 500, "threshold": 3}
+    ]`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rules[0].window() != 30*time.Minute || rules[1].status() != 500 {
+		t.Errorf("parsed %+v", rules)
+	}
+
+	for _, bad := range []string{
+		`[{"id": "a", "kind": "inactive"}]`,
+		`[{"id": "a", "kind": "nope", "window": "5m"}]`,
+		`[{"id": "a", "kind": "error_rate", "window": "5m", "threshold": 150}]`,
+		`[{"id": "a", "kind": "inactive", "window": "5m"}, {"id": "a", "kind": "no_traffic", "window": "5m"}]`,
+		`[{"id": "a", "kind": "inactive", "window": 300}]`,
+	} {
+		if _, err := LoadRules(strings.NewReader(bad)); err == nil {
+			t.Errorf("LoadRules(%s) succeeded", bad)
+		}
+	}
+}
+
+var testAlert = Alert{
+	Rule:    "inactive",
+	Kind:    KindInactive,
+	Subject: "Zoë",
+	Message: "Zoë has made no requests for 20m (last seen 09:40)",
+	Value:   20,
+	Time:    fixtureNow,
+}
+
+func TestWebhookNotifier(t *testing.T) {
+	var received Alert
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost || r.Header.Get("Content-Type") != "application/json" {
+			t.Errorf("got %s with Content-Type %q", r.Method, r.Header.Get("Content-Type"))
+		}
+		if err := json.NewDecoder(r.Body).Decode(&received); err != nil {
+			t.Error(err)
+		}
+		if received.Subject == "fail" {
+			http.Error(w, "nope", http.StatusInternalServerError)
+		}
+	}))
+	defer srv.Close()
+
+	w := Webhook{URL: srv.URL}
+	if err := w.Notify(context.Background(), testAlert); err != nil {
+		t.Fatal(err)
+	}
+	if received.Rule != "inactive" || received.Subject != "Zoë" || !received.Time.Equal(fixtureNow) {
+		t.Errorf("server received %+v", received)
+	}
+
+	failing := testAlert
+	failing.Subject = "fail"
+	if err := w.Notify(context.Background(), failing); err == nil || !strings.Contains(err.Error(), "500") {
+		t.Errorf("error from a 500 = %v", err)
+	}
+}
+
+func TestTerminalNotifier(t *testing.T) {
+	var out strings.Builder
+	n := Terminal{W: &out, Bell: true}
+	a := Alert{Rule: "inactive", Subject: "kev\x1b[2Jin", Message: "kev\x1b[2Jin has made no requests for 20m",
+		Time: time.Date(2026, 10, 18, 9, 30, 0, 0, time.UTC)}
+	if err := n.Notify(context.Background(), a); err != nil {
+		t.Fatal(err)
+	}
+	want := "\a[09:30:00] FIRING inactive: kev\\x1b[2Jin has made no requests for 20m\n"
+	if out.String() != want {
+		t.Errorf("wrote %q, want %q", out.String(), want)
+	}
+}
+
+func TestCommandNotifier(t *testing.T) {
+	out := filepath.Join(t.TempDir(), "out")
+	c := Command{Command: `printf '%s %s\n' "$HAPPY_ALERT_STATE" "$HAPPY_ALERT_SUBJECT" > ` + out + ` && cat >> ` + out}
+	if err := c.Notify(context.Background(), testAlert); err != nil {
+		t.Fatal(err)
+	}
+
+	b, err := os.ReadFile(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	first, body, _ := strings.Cut(string(b), "\n")
+	if first != "firing Zoë" {
+		t.Errorf("environment gave %q", first)
+	}
+	var a Alert
+	if err := json.Unmarshal([]byte(body), &a); err != nil || a.Message != testAlert.Message {
+		t.Errorf("stdin gave %q (%v)", body, err)
+	}
+
+	if err := (Command{Command: "echo broken >&2; exit 3"}).Notify(context.Background(), testAlert); err == nil || !strings.Contains(err.Error(), "broken") {
+		t.Errorf("failing command returned %v", err)
+	}
+}
+
+func TestSendmailNotifier(t *testing.T) {
+	dir := t.TempDir()
+	out := filepath.Join(dir, "mail")
+	sendmail := filepath.Join(dir, "sendmail")
+	script := "#!/bin/sh\necho \"$@\" > " + out + "\ncat >> " + out + "\n"
+	if err := os.WriteFile(sendmail, []byte(script), 0o755); err != nil {
+		t.Fatal(err)
+	}
+
+	s := Sendmail{Path: sendmail, From: "happywatch@example.com", To: []string{"kim@example.com", "lee@example.com"}}
+	if err := s.Notify(context.Background(), testAlert); err != nil {
+		t.Fatal(err)
+	}
+
+	f, err := os.Open(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	b, _ := io.ReadAll(f)
+	mail := string(b)
+
+	for _, want := range []string{
+		"-i -- kim@example.com lee@example.com\n",
+		"To: kim@example.com, lee@example.com\r\n",
+		"Subject: =?utf-8?q?[happywatch]_FIRING_inactive:_Zo=C3=AB_has",
+		"\r\n\r\nZoë has made no requests for 20m",
+	} {
+		if !strings.Contains(mail, want) {
+			t.Errorf("mail is missing %q:\n%s", want, mail)
+		}
+	}
+}
@@ -0,0 +1,99 @@
+package alert
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/industrial-linguistics/happy-api/internal/monitor"
+)
+
+// Engine evaluates rules on each check and notifies when an alert starts
+// firing and when it resolves, rather than on every check it stays true.
+type Engine struct {
+	rules     []Rule
+	notifiers []Notifier
+	active    map[string]Alert
+}
+
+// NewEngine returns an engine that sends alerts from rules to notifiers.
+func NewEngine(rules []Rule, notifiers ...Notifier) *Engine {
+	return &Engine{
+		rules:     rules,
+		notifiers: notifiers,
+		active:    map[string]Alert{},
+	}
+}
+
+// Check evaluates the rules at now and notifies about the alerts that have
+// started firing or resolved since the previous check, which it returns.
+// An inactive alert only resolves once its student makes another request.
+// A notifier that fails does not stop the others; their errors are
+// returned together.
+func (e *Engine) Check(ctx context.Context, db *sql.DB, now time.Time) ([]Alert, error) {
+	firing, err := Evaluate(ctx, db, e.rules, now)
+	if err != nil {
+		return nil, err
+	}
+
+	var changed []Alert
+	current := map[string]Alert{}
+	for _, a := range firing {
+		current[a.key()] = a
+		if _, ok := e.active[a.key()]; !ok {
+			changed = append(changed, a)
+		}
+	}
+
+	var resolved []Alert
+	for key, a := range e.active {
+		if _, ok := current[key]; ok {
+			continue
+		}
+		if a.Kind == KindInactive {
+			// A student quiet for longer than the class window drops out
+			// of the rule without having come back.
+			seen, err := monitor.LastSeen(ctx, db, a.Subject)
+			if err != nil {
+				return nil, err
+			}
+			if !seen.After(a.lastSeen) {
+				current[key] = a
+				continue
+			}
+		}
+		a.Resolved = true
+		a.Time = now
+		resolved = append(resolved, a)
+	}
+	sort.Slice(resolved, func(i, j int) bool {
+		return resolved[i].key() < resolved[j].key()
+	})
+	changed = append(changed, resolved...)
+	e.active = current
+
+	var errs []error
+	for _, a := range changed {
+		for _, n := range e.notifiers {
+			if err := n.Notify(ctx, a); err != nil {
+				errs = append(errs, fmt.Errorf("%s alert %s: %w", a.State(), a.Rule, err))
+			}
+		}
+	}
+	return changed, errors.Join(errs...)
+}
+
+// Active returns the alerts that were firing at the last check.
+func (e *Engine) Active() []Alert {
+	alerts := make([]Alert, 0, len(e.active))
+	for _, a := range e.active {
+		alerts = append(alerts, a)
+	}
+	sort.Slice(alerts, func(i, j int) bool {
+		return alerts[i].key() < alerts[j].key()
+	})
+	return alerts
+}
@@ -0,0 +1,174 @@
+package alert
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"os"
+	"os/exec"
+	"strings"
+	"time"
+
+	"github.com/industrial-linguistics/happy-api/internal/monitor"
+)
+
+// Notifier delivers an alert somewhere the instructor will see it.
+type Notifier interface {
+	Notify(ctx context.Context, a Alert) error
+}
+
+// NotifierFunc adapts a function to a Notifier.
+type NotifierFunc func(ctx context.Context, a Alert) error
+
+// Notify calls f.
+func (f NotifierFunc) Notify(ctx context.Context, a Alert) error {
+	return f(ctx, a)
+}
+
+// Summary is a one-line description of the alert for terminals and mail
+// subjects.
+func (a Alert) Summary() string {
+	state := "FIRING"
+	if a.Resolved {
+		state = "RESOLVED"
+	}
+	return fmt.Sprintf("%s %s: %s", state, a.Rule, a.Message)
+}
+
+// Terminal writes each alert as a line, ringing the terminal bell when
+// Bell is set and the alert is firing. The time is shown in the alert's
+// location, and control characters in the message are escaped.
+type Terminal struct {
+	W    io.Writer
+	Bell bool
+}
+
+// Notify writes the alert.
+func (t Terminal) Notify(ctx context.Context, a Alert) error {
+	bell := ""
+	if t.Bell && !a.Resolved {
+		bell = "\a"
+	}
+	_, err := fmt.Fprintf(t.W, "%s[%s] %s\n", bell, a.Time.Format("15:04:05"), monitor.Printable(a.Summary()))
+	return err
+}
+
+// Command runs a shell command for each alert. The alert is written to the
+// command's standard input as JSON and is also available in the
+// environment as HAPPY_ALERT_RULE, HAPPY_ALERT_KIND, HAPPY_ALERT_SUBJECT,
+// HAPPY_ALERT_STATE and HAPPY_ALERT_MESSAGE.
+type Command struct {
+	Command string
+}
+
+// Notify runs the command and waits for it to finish.
+func (c Command) Notify(ctx context.Context, a Alert) error {
+	body, err := json.Marshal(a)
+	if err != nil {
+		return err
+	}
+
+	cmd := exec.CommandContext(ctx, "/bin/sh", "-c", c.Command)
+	cmd.Stdin = bytes.NewReader(body)
+	cmd.Env = append(os.Environ(),
+		"HAPPY_ALERT_RULE="+a.Rule,
+		"HAPPY_ALERT_KIND="+a.Kind,
+		"HAPPY_ALERT_SUBJECT="+a.Subject,
+		"HAPPY_ALERT_STATE="+a.State(),
+		"HAPPY_ALERT_MESSAGE="+a.Message,
+	)
+	if out, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("alert command failed: %w: %s", err, strings.TrimSpace(string(out)))
+	}
+	return nil
+}
+
+// Webhook POSTs each alert as JSON to URL.
+type Webhook struct {
+	URL string
+	// Client defaults to one with a 10 second timeout.
+	Client *http.Client
+}
+
+var webhookClient = &http.Client{Timeout: 10 * time.Second}
+
+// Notify posts the alert and expects a 2xx response.
+func (w Webhook) Notify(ctx context.Context, a Alert) error {
+	body, err := json.Marshal(a)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, w.URL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "happywatch")
+
+	client := w.Client
+	if client == nil {
+		client = webhookClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, resp.Body)
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("webhook returned %s", resp.Status)
+	}
+	return nil
+}
+
+// DefaultSendmail is where OpenBSD and most Linux systems install the
+// sendmail-compatible mail submission program.
+const DefaultSendmail = "/usr/sbin/sendmail"
+
+// Sendmail emails each alert to To through a local sendmail binary.
+type Sendmail struct {
+	// Path defaults to DefaultSendmail.
+	Path string
+	// From is optional; sendmail fills in the current user when it is
+	// empty.
+	From string
+	To   []string
+}
+
+// Notify pipes the message to sendmail and waits for it to be accepted.
+func (s Sendmail) Notify(ctx context.Context, a Alert) error {
+	path := s.Path
+	if path == "" {
+		path = DefaultSendmail
+	}
+
+	var msg bytes.Buffer
+	if s.From != "" {
+		fmt.Fprintf(&msg, "From: %s\r\n", s.From)
+	}
+	fmt.Fprintf(&msg, "To: %s\r\n", strings.Join(s.To, ", "))
+	fmt.Fprintf(&msg, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", "[happywatch] "+a.Summary()))
+	fmt.Fprintf(&msg, "Date: %s\r\n", a.Time.Format(time.RFC1123Z))
+	msg.WriteString("MIME-Version: 1.0\r\n")
+	msg.WriteString("Content-Type: text/plain; charset=utf-8\r\n")
+	msg.WriteString("\r\n")
+	fmt.Fprintf(&msg, "%s\r\n\r\n", a.Message)
+	fmt.Fprintf(&msg, "Rule:  %s (%s)\r\n", a.Rule, a.Kind)
+	fmt.Fprintf(&msg, "State: %s\r\n", a.State())
+	fmt.Fprintf(&msg, "Time:  %s\r\n", a.Time.Format("2006-01-02 15:04:05 MST"))
+
+	// -i: a line with a single dot does not end the message
+	args := append([]string{"-i", "--"}, s.To...)
+	cmd := exec.CommandContext(ctx, path, args...)
+	cmd.Stdin = &msg
+	if out, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("sendmail failed: %w: %s", err, strings.TrimSpace(string(out)))
+	}
+	return nil
+}
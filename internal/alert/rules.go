@@ -0,0 +1,269 @@
+// Package alert evaluates rules over activity_log and sends the alerts
+// they raise to notifiers, so the instructor hears about a problem without
+// watching the live screen.
+package alert
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/industrial-linguistics/happy-api/internal/monitor"
+)
+
+// Rule kinds
+const (
+	// KindErrorRate fires when the percentage of 4xx and 5xx responses in
+	// the window reaches Threshold.
+	KindErrorRate = "error_rate"
+	// KindInactive fires for each student seen in class who has made no
+	// request for Window.
+	KindInactive = "inactive"
+	// KindStatusSpike fires when Threshold or more responses in the window
+	// had the rule's Status, 429 unless set.
+	KindStatusSpike = "status_spike"
+	// KindNoTraffic fires when there were no requests at all in the window.
+	KindNoTraffic = "no_traffic"
+)
+
+// classWindow is how far back inactive rules look for students who were in
+// class, as in happywatch's students mode.
+const classWindow = 4 * time.Hour
+
+// Duration is a time.Duration written as a string such as "5m" in JSON.
+type Duration time.Duration
+
+// UnmarshalJSON parses a duration string.
+func (d *Duration) UnmarshalJSON(b []byte) error {
+	var s string
+	if err := json.Unmarshal(b, &s); err != nil {
+		return fmt.Errorf("duration must be a string such as \"5m\": %w", err)
+	}
+	v, err := time.ParseDuration(s)
+	if err != nil {
+		return err
+	}
+	*d = Duration(v)
+	return nil
+}
+
+// MarshalJSON writes the duration as a string.
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(shortDuration(time.Duration(d)))
+}
+
+// Rule is a declarative alert condition.
+type Rule struct {
+	ID   string `json:"id"`
+	Kind string `json:"kind"`
+	// Window is how far back the rule looks, or for inactive rules how
+	// long a student must have been quiet.
+	Window Duration `json:"window"`
+	// Threshold is the error rate percentage for error_rate rules and the
+	// number of responses for status_spike rules.
+	Threshold float64 `json:"threshold,omitempty"`
+	// Status is the response code a status_spike rule counts; zero means
+	// 429.
+	Status int `json:"status,omitempty"`
+	// MinRequests stops an error_rate rule firing on a handful of
+	// requests.
+	MinRequests int `json:"min_requests,omitempty"`
+}
+
+// DefaultRules cover the problems instructors most often miss: a broken
+// endpoint, a student who has stalled, students hammering the rate limit,
+// and the API going quiet altogether.
+var DefaultRules = []Rule{
+	{ID: "errors", Kind: KindErrorRate, Window: Duration(5 * time.Minute), Threshold: 25, MinRequests: 20},
+	{ID: "inactive", Kind: KindInactive, Window: Duration(15 * time.Minute)},
+	{ID: "rate-limit", Kind: KindStatusSpike, Window: Duration(5 * time.Minute), Status: 429, Threshold: 10},
+	{ID: "quiet", Kind: KindNoTraffic, Window: Duration(10 * time.Minute)},
+}
+
+// LoadRules reads a JSON array of rules.
+func LoadRules(r io.Reader) ([]Rule, error) {
+	var rules []Rule
+	if err := json.NewDecoder(r).Decode(&rules); err != nil {
+		return nil, fmt.Errorf("failed to parse rules: %w", err)
+	}
+
+	seen := map[string]bool{}
+	for i, rule := range rules {
+		if rule.ID == "" {
+			return nil, fmt.Errorf("rule %d has no id", i+1)
+		}
+		if seen[rule.ID] {
+			return nil, fmt.Errorf("duplicate rule id %q", rule.ID)
+		}
+		seen[rule.ID] = true
+		if rule.Window <= 0 {
+			return nil, fmt.Errorf("rule %q needs a positive window", rule.ID)
+		}
+		switch rule.Kind {
+		case KindErrorRate:
+			if rule.Threshold <= 0 || rule.Threshold > 100 {
+				return nil, fmt.Errorf("rule %q needs a threshold between 0 and 100", rule.ID)
+			}
+		case KindStatusSpike:
+			if rule.Threshold < 1 {
+				return nil, fmt.Errorf("rule %q needs a threshold of at least 1", rule.ID)
+			}
+		case KindInactive, KindNoTraffic:
+		default:
+			return nil, fmt.Errorf("rule %q has unknown kind %q", rule.ID, rule.Kind)
+		}
+	}
+	return rules, nil
+}
+
+func (r Rule) window() time.Duration {
+	return time.Duration(r.Window)
+}
+
+func (r Rule) status() int {
+	if r.Status != 0 {
+		return r.Status
+	}
+	return 429
+}
+
+// Alert is a rule that is firing, or has stopped firing when Resolved is
+// set.
+type Alert struct {
+	Rule string `json:"rule"`
+	Kind string `json:"kind"`
+	// Subject is the student an inactive alert is about; other kinds
+	// leave it empty.
+	Subject  string    `json:"subject,omitempty"`
+	Message  string    `json:"message"`
+	Value    float64   `json:"value"`
+	Resolved bool      `json:"resolved"`
+	Time     time.Time `json:"time"` // of the check, in its location
+
+	// lastSeen is when the subject of an inactive alert last made a
+	// request.
+	lastSeen time.Time
+}
+
+// State is "firing" or "resolved".
+func (a Alert) State() string {
+	if a.Resolved {
+		return "resolved"
+	}
+	return "firing"
+}
+
+// key identifies an alert across checks.
+func (a Alert) key() string {
+	return a.Rule + "\x00" + a.Subject
+}
+
+// Evaluate returns an alert for every rule that is firing at now. Times in
+// alert messages are written in now's location.
+func Evaluate(ctx context.Context, db *sql.DB, rules []Rule, now time.Time) ([]Alert, error) {
+	var alerts []Alert
+
+	// Several rules usually share a window
+	counts := map[time.Duration]map[int]int{}
+	statusCounts := func(w time.Duration) (map[int]int, error) {
+		if c, ok := counts[w]; ok {
+			return c, nil
+		}
+		c, err := monitor.LoadStatusCounts(ctx, db, monitor.Range{Since: now.Add(-w)})
+		if err != nil {
+			return nil, err
+		}
+		counts[w] = c
+		return c, nil
+	}
+
+	for _, rule := range rules {
+		w := rule.window()
+		fire := func(subject, message string, value float64) *Alert {
+			alerts = append(alerts, Alert{
+				Rule:    rule.ID,
+				Kind:    rule.Kind,
+				Subject: subject,
+				Message: message,
+				Value:   value,
+				Time:    now,
+			})
+			return &alerts[len(alerts)-1]
+		}
+
+		switch rule.Kind {
+		case KindErrorRate:
+			c, err := statusCounts(w)
+			if err != nil {
+				return nil, err
+			}
+			var total, errors int
+			for code, n := range c {
+				total += n
+				if code >= 400 {
+					errors += n
+				}
+			}
+			if total == 0 || total < rule.MinRequests {
+				continue
+			}
+			rate := float64(errors) / float64(total) * 100
+			if rate >= rule.Threshold {
+				fire("", fmt.Sprintf("Error rate %.1f%% over the last %s (%d of %d requests)",
+					rate, shortDuration(w), errors, total), rate)
+			}
+
+		case KindStatusSpike:
+			c, err := statusCounts(w)
+			if err != nil {
+				return nil, err
+			}
+			if n := c[rule.status()]; float64(n) >= rule.Threshold {
+				fire("", fmt.Sprintf("%d responses with status %d in the last %s",
+					n, rule.status(), shortDuration(w)), float64(n))
+			}
+
+		case KindNoTraffic:
+			c, err := statusCounts(w)
+			if err != nil {
+				return nil, err
+			}
+			if len(c) == 0 {
+				fire("", fmt.Sprintf("No requests in the last %s", shortDuration(w)), 0)
+			}
+
+		case KindInactive:
+			students, err := monitor.LoadInactiveStudents(ctx, db,
+				monitor.Range{Since: now.Add(-classWindow)}, now.Add(-w))
+			if err != nil {
+				return nil, err
+			}
+			for _, s := range students {
+				quiet := now.Sub(s.LastSeen).Truncate(time.Minute)
+				a := fire(s.Name, fmt.Sprintf("%s has made no requests for %s (last seen %s)",
+					s.Name, shortDuration(quiet), s.LastSeen.In(now.Location()).Format("15:04")),
+					quiet.Minutes())
+				a.lastSeen = s.LastSeen
+			}
+		}
+	}
+
+	return alerts, nil
+}
+
+// shortDuration formats d without trailing zero units, e.g. "5m" rather
+// than "5m0s".
+func shortDuration(d time.Duration) string {
+	s := d.String()
+	if strings.HasSuffix(s, "m0s") {
+		s = strings.TrimSuffix(s, "0s")
+	}
+	if strings.HasSuffix(s, "h0m") {
+		s = strings.TrimSuffix(s, "0m")
+	}
+	return s
+}
@@ -0,0 +1,638 @@
+// Package api implements the positive social network API. Server is an
+// http.Handler, so message-api can run it under CGI or as an HTTP server.
+package api
+
+import (
+	"context"
+	"crypto/rand"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/industrial-linguistics/happy-api/internal/health"
+	"github.com/industrial-linguistics/happy-api/internal/i18n"
+	"github.com/industrial-linguistics/happy-api/internal/metrics"
+)
+
+const (
+	maxNameLen    = 50
+	maxMessageLen = 500
+	rateLimit     = 100 // requests per minute per IP
+
+	// sqliteTimeFormat is how CURRENT_TIMESTAMP stores times, in UTC
+	sqliteTimeFormat = "2006-01-02 15:04:05"
+)
+
+// Server routes each request to a handler. Under CGI it serves a single
+// request; in server mode it serves them all.
+type Server struct {
+	DB *sql.DB
+	// DataDir holds the database; /v1/status checks its free space.
+	DataDir string
+	Build   BuildInfo
+
+	// AllowedOrigins are the origins whose pages may call the API with
+	// credentials. When empty, any page may call it without them.
+	AllowedOrigins []string
+
+	// Counters keeps the metrics in server mode. Under CGI it is nil and
+	// /v1/metrics derives them from the database instead.
+	Counters *metrics.Counters
+
+	catalog catalog
+
+	// clock and messageIDs replace time.Now and random message IDs in
+	// the golden tests.
+	clock      func() time.Time
+	messageIDs func() string
+}
+
+type handler struct {
+	*Server
+	w       http.ResponseWriter
+	r       *http.Request
+	version *apiVersion
+
+	// format is the representation negotiated for the response body
+	format format
+
+	// languages are the locales the request prefers, from lang= and
+	// Accept-Language
+	languages []string
+
+	// name and sessionID identify the student once a handler has parsed
+	// them, so that errors are attributed in activity_log too.
+	name      string
+	sessionID string
+
+	// errMsg is the error sent to the client, if any
+	errMsg string
+
+	// alias is the endpoint requested when it was an alias of the one
+	// logged
+	alias string
+}
+
+type MessageResponse struct {
+	Name      string    `json:"name" xml:"name"`
+	Message   string    `json:"message" xml:"text"`
+	Timestamp time.Time `json:"timestamp" xml:"timestamp"`
+	MessageID string    `json:"message_id" xml:"id,attr"`
+	Sequence  int       `json:"sequence" xml:"sequence"`
+}
+
+type PostMessageRequest struct {
+	From      string `json:"from"`
+	To        string `json:"to"`
+	Message   string `json:"message"`
+	SessionID string `json:"session_id,omitempty"`
+}
+
+// Delivery is the v2 response to sending a message.
+type Delivery struct {
+	MessageID string    `json:"message_id"`
+	From      string    `json:"from"`
+	To        string    `json:"to"`
+	Message   string    `json:"message"`
+	Status    string    `json:"status"`
+	Timestamp time.Time `json:"timestamp"`
+}
+
+// Inbox is a recipient's messages, newest first.
+type Inbox struct {
+	Recipient string            `json:"recipient" xml:"recipient,attr"`
+	Count     int               `json:"count" xml:"count,attr"`
+	Messages  []ReceivedMessage `json:"messages" xml:"message"`
+}
+
+type ReceivedMessage struct {
+	MessageID string    `json:"message_id" xml:"id,attr"`
+	From      string    `json:"from" xml:"from"`
+	Message   string    `json:"message" xml:"text"`
+	Timestamp time.Time `json:"timestamp" xml:"timestamp"`
+}
+
+type ErrorResponse struct {
+	Error     string    `json:"error"`
+	Timestamp time.Time `json:"timestamp"`
+}
+
+type StatusResponse struct {
+	Status  string    `json:"status"` // "ok" or "unavailable"
+	Version string    `json:"version"`
+	Build   BuildInfo `json:"build"`
+	*Readiness
+	Timestamp time.Time `json:"timestamp"`
+}
+
+// Readiness is the part of the status that needs the database, left out
+// of liveness probes.
+type Readiness struct {
+	Checks         []health.Check `json:"checks"`
+	RequestsToday  int            `json:"requests_today"`
+	EndpointsToday map[string]int `json:"endpoints_today"`
+}
+
+type BuildInfo struct {
+	Version   string `json:"version"`
+	Commit    string `json:"commit"`
+	BuildDate string `json:"build_date"`
+	GoVersion string `json:"go_version"`
+}
+
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	// Split the version from the endpoint (e.g., "/v1/status" -> v1,
+	// "/status"). Paths outside every version are answered as v1.
+	version, endpoint := splitVersion(r.URL.Path)
+	h := &handler{Server: s, w: w, r: r, version: version}
+	h.languages = i18n.Preferences(r.URL.Query().Get("lang"), r.Header.Get("Accept-Language"))
+
+	// Preflights are the browser's rather than the student's, so they
+	// are not logged
+	if r.Method == http.MethodOptions && h.handlePreflight(endpoint) {
+		return
+	}
+
+	startTime := time.Now()
+
+	// Route request
+	var statusCode int
+	rt, ok := version.findRoute(r.Method, endpoint)
+	if !ok {
+		statusCode = h.handleNotFound()
+	} else {
+		if rt.aliasOf != "" {
+			h.alias, endpoint = endpoint, rt.aliasOf
+		}
+		if rt.deprecated != nil {
+			rt.deprecated.setHeaders(w.Header(), version.prefix+endpoint)
+		}
+		statusCode = rt.handle(h)
+		if rt.unlogged {
+			return
+		}
+	}
+
+	elapsed := time.Since(startTime)
+	if s.Counters != nil {
+		label := endpoint
+		if !isEndpoint(label) {
+			label = metrics.OtherEndpoint
+		}
+		s.Counters.ObserveRequest(label, statusCode, h.errMsg, elapsed)
+	}
+
+	// Log activity
+	h.logActivity(endpoint, statusCode, int(elapsed.Milliseconds()))
+}
+
+func (h *handler) handleGetAutoMessage() int {
+	values, err := url.ParseQuery(h.r.URL.RawQuery)
+	if err != nil {
+		h.sendError(400, "Invalid query string")
+		return 400
+	}
+	if !h.negotiate(values) {
+		return 400
+	}
+
+	name := values.Get("name")
+	if name == "" {
+		h.sendError(400, "name parameter required")
+		return 400
+	}
+
+	if len(name) > maxNameLen {
+		h.sendError(400, "name too long")
+		return 400
+	}
+
+	h.name = name
+	h.sessionID = values.Get("session_id")
+
+	// Check rate limit
+	ip := h.remoteAddr()
+	if !h.checkRateLimit(ip) {
+		h.sendError(429, "Rate limit exceeded")
+		return 429
+	}
+
+	// Get random message in the student's language
+	message, locale, err := h.randomMessage(h.languages)
+	if err != nil {
+		log.Printf("Error fetching message: %v", err)
+		h.countDBError()
+		h.sendError(500, "Internal server error")
+		return 500
+	}
+
+	// Get sequence number for this name
+	var sequence int
+	h.DB.QueryRow(`
+        SELECT COUNT(*) FROM activity_log
+        WHERE name = ? AND endpoint = '/automessage' AND response_code = 200
+    `, name).Scan(&sequence)
+	sequence++ // This is their nth request
+
+	messageID := h.newMessageID()
+
+	response := MessageResponse{
+		Name:      name,
+		Message:   message,
+		Timestamp: h.now(),
+		MessageID: messageID,
+		Sequence:  sequence,
+	}
+
+	h.w.Header().Set("Content-Language", locale)
+	h.w.Header().Add("Vary", "Accept-Language")
+	h.send(200, response)
+	return 200
+}
+
+func (h *handler) handlePostMessage() int {
+	_, messageID, code := h.saveMessage()
+	if code != 201 {
+		return code
+	}
+
+	response := map[string]interface{}{
+		"message_id": messageID,
+		"timestamp":  h.now(),
+		"status":     "delivered",
+	}
+
+	h.sendJSON(201, response)
+	return 201
+}
+
+// saveMessage validates and stores a message from the request body,
+// returning it with its ID and 201, or the status of the error it sent.
+func (h *handler) saveMessage() (PostMessageRequest, string, int) {
+	var req PostMessageRequest
+	if err := json.NewDecoder(h.r.Body).Decode(&req); err != nil {
+		h.sendError(400, "Invalid JSON")
+		return req, "", 400
+	}
+
+	if len(req.From) <= maxNameLen {
+		h.name = req.From
+	}
+	h.sessionID = req.SessionID
+
+	// Validation
+	if req.From == "" || req.To == "" || req.Message == "" {
+		h.sendError(400, "from, to, and message are required")
+		return req, "", 400
+	}
+
+	if len(req.Message) > maxMessageLen {
+		h.sendError(400, "message too long")
+		return req, "", 400
+	}
+
+	// Basic positivity check (simple keyword filter)
+	if !i18n.IsPositive(req.Message) {
+		h.sendError(400, metrics.ModerationError)
+		return req, "", 400
+	}
+
+	ip := h.remoteAddr()
+	messageID := h.newMessageID()
+
+	_, err := h.DB.Exec(`
+        INSERT INTO user_messages (message_id, from_user, to_user, message, ip_address)
+        VALUES (?, ?, ?, ?, ?)
+    `, messageID, req.From, req.To, req.Message, ip)
+
+	if err != nil {
+		log.Printf("Error saving message: %v", err)
+		h.countDBError()
+		h.sendError(500, "Internal server error")
+		return req, "", 500
+	}
+
+	return req, messageID, 201
+}
+
+func (h *handler) handleGetMessages() int {
+	inbox, code := h.loadInbox()
+	if code != 200 {
+		return code
+	}
+	if h.format.name != "json" {
+		h.send(200, inbox)
+		return 200
+	}
+
+	// An empty inbox has always been sent as "messages": null
+	var messages []map[string]interface{}
+	for _, m := range inbox.Messages {
+		messages = append(messages, map[string]interface{}{
+			"message_id": m.MessageID,
+			"from":       m.From,
+			"message":    m.Message,
+			"timestamp":  m.Timestamp,
+		})
+	}
+
+	response := map[string]interface{}{
+		"recipient": inbox.Recipient,
+		"count":     len(messages),
+		"messages":  messages,
+	}
+
+	h.sendJSON(200, response)
+	return 200
+}
+
+// loadInbox fetches the messages sent to the recipient the query names,
+// newest first, returning them and 200 or the status of the error it sent.
+func (h *handler) loadInbox() (Inbox, int) {
+	values, err := url.ParseQuery(h.r.URL.RawQuery)
+	if err != nil {
+		h.sendError(400, "Invalid query string")
+		return Inbox{}, 400
+	}
+	if !h.negotiate(values) {
+		return Inbox{}, 400
+	}
+
+	recipient := values.Get("recipient")
+	if recipient == "" {
+		h.sendError(400, "recipient parameter required")
+		return Inbox{}, 400
+	}
+
+	if len(recipient) > maxNameLen {
+		h.sendError(400, "recipient name too long")
+		return Inbox{}, 400
+	}
+
+	h.name = recipient
+	h.sessionID = values.Get("session_id")
+	ip := h.remoteAddr()
+
+	// Check rate limit
+	if !h.checkRateLimit(ip) {
+		h.sendError(429, "Rate limit exceeded")
+		return Inbox{}, 429
+	}
+
+	limit := 10
+	if l := values.Get("limit"); l != "" {
+		fmt.Sscanf(l, "%d", &limit)
+		if limit > 50 {
+			limit = 50
+		}
+	}
+
+	// Clients poll, so let them and the CDN revalidate instead
+	etag, modified, err := h.inboxValidators(recipient, limit)
+	if err != nil {
+		log.Printf("Error checking messages: %v", err)
+		h.countDBError()
+		h.sendError(500, "Internal server error")
+		return Inbox{}, 500
+	}
+	h.w.Header().Set("Cache-Control", "no-cache")
+	if h.notModified(etag, modified) {
+		h.setCORS()
+		h.w.WriteHeader(304)
+		return Inbox{}, 304
+	}
+
+	// Get messages sent to this recipient
+	rows, err := h.DB.Query(`
+        SELECT message_id, from_user, message, created_at
+        FROM user_messages
+        WHERE to_user = ?
+        ORDER BY created_at DESC
+        LIMIT ?
+    `, recipient, limit)
+
+	if err != nil {
+		log.Printf("Error fetching messages: %v", err)
+		h.countDBError()
+		h.sendError(500, "Internal server error")
+		return Inbox{}, 500
+	}
+	defer rows.Close()
+
+	inbox := Inbox{Recipient: recipient, Messages: []ReceivedMessage{}}
+	for rows.Next() {
+		var m ReceivedMessage
+		rows.Scan(&m.MessageID, &m.From, &m.Message, &m.Timestamp)
+		inbox.Messages = append(inbox.Messages, m)
+	}
+	inbox.Count = len(inbox.Messages)
+
+	return inbox, 200
+}
+
+// handleStatus reports build information and, unless probe=live asks only
+// whether the API is up, checks that it can serve requests. Any failing
+// check makes it a 503 so that load balancers and monitors stop trusting
+// it.
+func (h *handler) handleStatus() int {
+	values, err := url.ParseQuery(h.r.URL.RawQuery)
+	if err != nil {
+		h.sendError(400, "Invalid query string")
+		return 400
+	}
+
+	response := StatusResponse{
+		Status:    "ok",
+		Version:   h.Build.Version,
+		Build:     h.Build,
+		Timestamp: h.now(),
+	}
+
+	switch probe := values.Get("probe"); probe {
+	case "live":
+		h.w.Header().Set("Cache-Control", statusMaxAge)
+		h.sendJSON(200, response)
+		return 200
+	case "", "ready":
+	default:
+		h.sendError(400, "probe must be live or ready")
+		return 400
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	ready := &Readiness{
+		Checks: health.Run(ctx, h.DB, health.Options{
+			DataDir:      h.DataDir,
+			MinFreeBytes: health.DefaultMinFreeBytes,
+		}),
+		EndpointsToday: map[string]int{},
+	}
+	response.Readiness = ready
+
+	// Timestamps are stored in UTC, so "today" is the UTC day
+	midnight := time.Now().UTC().Truncate(24 * time.Hour)
+	rows, err := h.DB.QueryContext(ctx, `
+        SELECT endpoint, COUNT(*) FROM activity_log
+        WHERE timestamp >= ?
+        GROUP BY endpoint
+    `, midnight.Format(sqliteTimeFormat))
+	if err == nil {
+		defer rows.Close()
+		for rows.Next() {
+			var endpoint string
+			var count int
+			if rows.Scan(&endpoint, &count) == nil {
+				ready.EndpointsToday[endpoint] = count
+				ready.RequestsToday += count
+			}
+		}
+	}
+
+	code := 200
+	h.w.Header().Set("Cache-Control", statusMaxAge)
+	if !health.Healthy(ready.Checks) {
+		response.Status = "unavailable"
+		code = 503
+		// Recovery should be seen at once
+		h.w.Header().Set("Cache-Control", "no-store")
+	}
+	h.sendJSON(code, response)
+	return code
+}
+
+// handleMetrics writes the metrics in the Prometheus text format, from
+// memory in server mode and from the database under CGI.
+func (h *handler) handleMetrics() int {
+	ctx, cancel := context.WithTimeout(h.r.Context(), 5*time.Second)
+	defer cancel()
+
+	var snapshot metrics.Snapshot
+	var err error
+	if h.Counters != nil {
+		snapshot = h.Counters.Snapshot()
+		err = metrics.LoadRateLimit(ctx, h.DB, time.Now(), &snapshot)
+	} else {
+		snapshot, err = metrics.Load(ctx, h.DB, Endpoints())
+	}
+	if err != nil {
+		log.Printf("Error loading metrics: %v", err)
+		h.countDBError()
+		h.sendError(500, "Internal server error")
+		return 500
+	}
+
+	h.w.Header().Set("Content-Type", metrics.ContentType)
+	h.w.WriteHeader(200)
+	metrics.Write(h.w, snapshot)
+	return 200
+}
+
+func (h *handler) handleNotFound() int {
+	h.sendError(404, "Endpoint not found")
+	return 404
+}
+
+func (h *handler) sendJSON(code int, data interface{}) {
+	h.w.Header().Set("Content-Type", "application/json")
+	h.setCORS()
+	h.w.WriteHeader(code)
+	json.NewEncoder(h.w).Encode(data)
+}
+
+// sendError sends message, in English, translated for the student. The
+// English is what is logged.
+func (h *handler) sendError(code int, message string) {
+	h.errMsg = message
+	text, locale := i18n.Error(h.languages, message)
+	h.w.Header().Set("Content-Language", locale)
+	h.w.Header().Add("Vary", "Accept-Language")
+	h.sendJSON(code, ErrorResponse{
+		Error:     text,
+		Timestamp: h.now(),
+	})
+}
+
+func (h *handler) checkRateLimit(ip string) bool {
+	bucket := time.Now().UTC().Format("2006-01-02 15:04")
+
+	var count int
+	h.DB.QueryRow(`
+        SELECT request_count FROM request_stats
+        WHERE ip_address = ? AND minute_bucket = ?
+    `, ip, bucket).Scan(&count)
+
+	if count >= rateLimit {
+		return false
+	}
+
+	_, err := h.DB.Exec(`
+        INSERT INTO request_stats (ip_address, minute_bucket, request_count)
+        VALUES (?, ?, 1)
+        ON CONFLICT(ip_address, minute_bucket)
+        DO UPDATE SET request_count = request_count + 1
+    `, ip, bucket)
+	if err != nil {
+		log.Printf("Error counting request: %v", err)
+		h.countDBError()
+	}
+
+	return true
+}
+
+// logActivity writes the single activity_log row for this request, with
+// the student's name and session when the handler got far enough to parse
+// them, the error it was sent and the alias it used.
+func (h *handler) logActivity(endpoint string, statusCode, responseTimeMs int) {
+	_, err := h.DB.Exec(`
+        INSERT INTO activity_log
+        (endpoint, name, session_id, ip_address, user_agent, response_code, response_time_ms, error, alias)
+        VALUES (?, NULLIF(?, ''), NULLIF(?, ''), ?, ?, ?, ?, NULLIF(?, ''), NULLIF(?, ''))
+    `, endpoint, h.name, h.sessionID, h.remoteAddr(), h.r.UserAgent(), statusCode, responseTimeMs, h.errMsg, h.alias)
+	if err != nil {
+		log.Printf("Error logging activity: %v", err)
+		h.countDBError()
+	}
+}
+
+// remoteAddr is the client's IP address, without the port the HTTP server
+// (but not CGI) adds.
+func (h *handler) remoteAddr() string {
+	if host, _, err := net.SplitHostPort(h.r.RemoteAddr); err == nil {
+		return host
+	}
+	return h.r.RemoteAddr
+}
+
+// countDBError counts a failed database operation in server mode. Under
+// CGI, failures are counted from the 500s in activity_log instead.
+func (h *handler) countDBError() {
+	if h.Counters != nil {
+		h.Counters.DBError()
+	}
+}
+
+// now is the time to put in a response, in UTC at the precision of the
+// request's API version.
+func (h *handler) now() time.Time {
+	now := time.Now
+	if h.clock != nil {
+		now = h.clock
+	}
+	return now().UTC().Truncate(h.version.precision)
+}
+
+func (h *handler) newMessageID() string {
+	if h.messageIDs != nil {
+		return h.messageIDs()
+	}
+	b := make([]byte, 8)
+	rand.Read(b)
+	return fmt.Sprintf("msg_%x", b)
+}
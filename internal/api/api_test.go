@@ -0,0 +1,666 @@
+package api
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"mime"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/industrial-linguistics/happy-api/internal/health"
+	_ "github.com/mattn/go-sqlite3"
+)
+
+// fixtureSchema is the part of init-db's schema the API uses.
+const fixtureSchema = `
+CREATE TABLE messages (id INTEGER PRIMARY KEY, message TEXT NOT NULL, category TEXT, locale TEXT NOT NULL DEFAULT 'en');
+CREATE TABLE user_messages (
+    message_id TEXT PRIMARY KEY,
+    from_user TEXT NOT NULL,
+    to_user TEXT NOT NULL,
+    message TEXT NOT NULL,
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    ip_address TEXT
+);
+CREATE TABLE activity_log (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    timestamp DATETIME DEFAULT CURRENT_TIMESTAMP,
+    endpoint TEXT NOT NULL,
+    name TEXT,
+    session_id TEXT,
+    ip_address TEXT,
+    user_agent TEXT,
+    response_code INTEGER,
+    response_time_ms INTEGER,
+    error TEXT,
+    alias TEXT
+);
+CREATE TABLE request_stats (
+    ip_address TEXT NOT NULL,
+    minute_bucket TEXT NOT NULL,
+    request_count INTEGER DEFAULT 1,
+    PRIMARY KEY (ip_address, minute_bucket)
+);
+INSERT INTO messages (message) VALUES ('Keep going!'), ('Nice work!');
+INSERT INTO messages (message, locale) VALUES ('Weiter so!', 'de');
+INSERT INTO user_messages (message_id, from_user, to_user, message) VALUES
+    ('msg_1', 'Ann', 'Bob', 'Great test coverage!');
+`
+
+// newServer returns a server on an in-memory database at schema version,
+// with the rate limit already used up for 10.0.0.99.
+func newServer(t *testing.T, version int) *Server {
+	t.Helper()
+
+	db, err := sql.Open("sqlite3", ":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	db.SetMaxOpenConns(1)
+	t.Cleanup(func() { db.Close() })
+
+	if _, err := db.Exec(fixtureSchema); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.Exec(fmt.Sprintf(`PRAGMA user_version = %d`, version)); err != nil {
+		t.Fatal(err)
+	}
+	_, err = db.Exec(`INSERT INTO request_stats VALUES ('10.0.0.99', ?, ?)`,
+		time.Now().UTC().Format("2006-01-02 15:04"), rateLimit)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return &Server{DB: db, DataDir: t.TempDir(), Build: BuildInfo{Version: "test"}}
+}
+
+// replays are requests covering every response the spec documents.
+var replays = []struct {
+	name   string
+	server string // "", or "broken" for a closed database, or "stale" for an old schema
+	method string
+	target string
+	body   string
+	addr   string
+	header string // "Name: value"
+	status int
+}{
+	{name: "automessage", method: "GET", target: "/v1/automessage?name=Ann&session_id=s1", status: 200},
+	{name: "automessage without name", method: "GET", target: "/v1/automessage", status: 400},
+	{name: "automessage text", method: "GET", target: "/v1/automessage?name=Ann&format=text", status: 200},
+	{name: "automessage html", method: "GET", target: "/v1/automessage?name=Ann", header: "Accept: text/html", status: 200},
+	{name: "automessage xml", method: "GET", target: "/v1/automessage?name=Ann&format=xml", status: 200},
+	{name: "automessage bad format", method: "GET", target: "/v1/automessage?name=Ann&format=yaml", status: 400},
+	{name: "automessage rate limited", method: "GET", target: "/v1/automessage?name=Ann", addr: "10.0.0.99:1234", status: 429},
+	{name: "automessage database down", server: "broken", method: "GET", target: "/v1/automessage?name=Ann", status: 500},
+	{name: "message alias", method: "GET", target: "/v1/message?name=Ann", status: 200},
+	{name: "message alias without name", method: "GET", target: "/v1/message", status: 400},
+	{name: "message alias rate limited", method: "GET", target: "/v1/message?name=Ann", addr: "10.0.0.99:1234", status: 429},
+	{name: "message alias database down", server: "broken", method: "GET", target: "/v1/message?name=Ann", status: 500},
+	{name: "send", method: "POST", target: "/v1/message", body: `{"from":"Ann","to":"Bob","message":"Nice work!"}`, status: 201},
+	{name: "send negative", method: "POST", target: "/v1/message", body: `{"from":"Ann","to":"Bob","message":"awful"}`, status: 400},
+	{name: "send bad JSON", method: "POST", target: "/v1/message", body: `{`, status: 400},
+	{name: "send database down", server: "broken", method: "POST", target: "/v1/message", body: `{"from":"Ann","to":"Bob","message":"Nice work!"}`, status: 500},
+	{name: "messages", method: "GET", target: "/v1/messages?recipient=Bob&limit=5", status: 200},
+	{name: "messages none", method: "GET", target: "/v1/messages?recipient=Nobody", status: 200},
+	{name: "messages text", method: "GET", target: "/v1/messages?recipient=Bob", header: "Accept: text/plain", status: 200},
+	{name: "messages xml", method: "GET", target: "/v1/messages?recipient=Bob&format=xml", status: 200},
+	{name: "messages not modified", method: "GET", target: "/v1/messages?recipient=Bob", header: "If-None-Match: *", status: 304},
+	{name: "messages without recipient", method: "GET", target: "/v1/messages", status: 400},
+	{name: "messages rate limited", method: "GET", target: "/v1/messages?recipient=Bob", addr: "10.0.0.99:1234", status: 429},
+	{name: "messages database down", server: "broken", method: "GET", target: "/v1/messages?recipient=Bob", status: 500},
+	{name: "status", method: "GET", target: "/v1/status", status: 200},
+	{name: "status live", method: "GET", target: "/v1/status?probe=live", status: 200},
+	{name: "status bad probe", method: "GET", target: "/v1/status?probe=deep", status: 400},
+	{name: "status stale schema", server: "stale", method: "GET", target: "/v1/status", status: 503},
+	{name: "metrics", method: "GET", target: "/v1/metrics", status: 200},
+	{name: "metrics database down", server: "broken", method: "GET", target: "/v1/metrics", status: 500},
+	{name: "openapi", method: "GET", target: "/v1/openapi.json", status: 200},
+
+	{name: "v2 automessage", method: "GET", target: "/v2/automessage?name=Ann&session_id=s1", status: 200},
+	{name: "v2 automessage without name", method: "GET", target: "/v2/automessage", status: 400},
+	{name: "v2 automessage rate limited", method: "GET", target: "/v2/automessage?name=Ann", addr: "10.0.0.99:1234", status: 429},
+	{name: "v2 automessage database down", server: "broken", method: "GET", target: "/v2/automessage?name=Ann", status: 500},
+	{name: "v2 send", method: "POST", target: "/v2/message", body: `{"from":"Ann","to":"Bob","message":"Nice work!"}`, status: 201},
+	{name: "v2 send negative", method: "POST", target: "/v2/message", body: `{"from":"Ann","to":"Bob","message":"awful"}`, status: 400},
+	{name: "v2 send database down", server: "broken", method: "POST", target: "/v2/message", body: `{"from":"Ann","to":"Bob","message":"Nice work!"}`, status: 500},
+	{name: "v2 messages", method: "GET", target: "/v2/messages?recipient=Bob&limit=5", status: 200},
+	{name: "v2 messages html", method: "GET", target: "/v2/messages?recipient=Bob&format=html", status: 200},
+	{name: "v2 messages not modified", method: "GET", target: "/v2/messages?recipient=Bob", header: "If-None-Match: *", status: 304},
+	{name: "v2 messages without recipient", method: "GET", target: "/v2/messages", status: 400},
+	{name: "v2 messages rate limited", method: "GET", target: "/v2/messages?recipient=Bob", addr: "10.0.0.99:1234", status: 429},
+	{name: "v2 messages database down", server: "broken", method: "GET", target: "/v2/messages?recipient=Bob", status: 500},
+	{name: "v2 status", method: "GET", target: "/v2/status", status: 200},
+	{name: "v2 status bad probe", method: "GET", target: "/v2/status?probe=deep", status: 400},
+	{name: "v2 status stale schema", server: "stale", method: "GET", target: "/v2/status", status: 503},
+	{name: "v2 openapi", method: "GET", target: "/v2/openapi.json", status: 200},
+}
+
+// TestOpenAPI replays requests against the handlers and checks that each
+// response is documented in its version's spec, and that every documented
+// response was seen.
+func TestOpenAPI(t *testing.T) {
+	for _, v := range versions {
+		t.Run(v.prefix[1:], func(t *testing.T) { testOpenAPI(t, v) })
+	}
+}
+
+func testOpenAPI(t *testing.T, v *apiVersion) {
+	var spec map[string]interface{}
+	if err := json.Unmarshal(v.spec, &spec); err != nil {
+		t.Fatalf("openapi.json: %v", err)
+	}
+	paths := spec["paths"].(map[string]interface{})
+
+	servers := map[string]*Server{
+		"":       newServer(t, health.SchemaVersion),
+		"broken": newServer(t, health.SchemaVersion),
+		"stale":  newServer(t, health.SchemaVersion-1),
+	}
+	servers["broken"].DB.Close()
+
+	seen := map[string]bool{}
+	for _, tc := range replays {
+		if !strings.HasPrefix(tc.target, v.prefix+"/") {
+			continue
+		}
+		t.Run(tc.name, func(t *testing.T) {
+			req := httptest.NewRequest(tc.method, tc.target, strings.NewReader(tc.body))
+			if tc.addr != "" {
+				req.RemoteAddr = tc.addr
+			}
+			if name, value, ok := strings.Cut(tc.header, ": "); ok {
+				req.Header.Set(name, value)
+			}
+			rec := httptest.NewRecorder()
+			servers[tc.server].ServeHTTP(rec, req)
+
+			if rec.Code != tc.status {
+				t.Fatalf("status %d, want %d: %s", rec.Code, tc.status, rec.Body)
+			}
+
+			path := strings.TrimPrefix(req.URL.Path, v.prefix)
+			op, ok := lookup(paths, path, strings.ToLower(tc.method))
+			if !ok {
+				t.Fatalf("%s %s is not in the spec", tc.method, path)
+			}
+			responses := op["responses"].(map[string]interface{})
+			code := fmt.Sprint(rec.Code)
+			resp, ok := lookup(responses, code)
+			if !ok {
+				t.Fatalf("status %s is not documented for %s %s", code, tc.method, path)
+			}
+			seen[tc.method+" "+path+" "+code] = true
+
+			deprecated, _ := op["deprecated"].(bool)
+			for _, header := range []string{"Deprecation", "Sunset"} {
+				if got := rec.Header().Get(header) != ""; got != deprecated {
+					t.Errorf("%s header sent: %v, operation deprecated: %v", header, got, deprecated)
+				}
+			}
+			resp = resolve(spec, resp)
+			if _, ok := resp["content"]; !ok {
+				if rec.Body.Len() > 0 {
+					t.Errorf("%s %s %s is documented without content, but has a body", tc.method, path, code)
+				}
+				return
+			}
+
+			mediaType, _, err := mime.ParseMediaType(rec.Header().Get("Content-Type"))
+			if err != nil {
+				t.Fatalf("Content-Type: %v", err)
+			}
+			content, ok := lookup(resp, "content", mediaType)
+			if !ok {
+				t.Fatalf("%s is not documented for %s %s %s", mediaType, tc.method, path, code)
+			}
+			if mediaType != "application/json" {
+				return
+			}
+
+			dec := json.NewDecoder(rec.Body)
+			dec.UseNumber()
+			var body interface{}
+			if err := dec.Decode(&body); err != nil {
+				t.Fatalf("response is not JSON: %v", err)
+			}
+			schema := content["schema"].(map[string]interface{})
+			for _, problem := range validate(spec, schema, body, "response") {
+				t.Error(problem)
+			}
+		})
+	}
+
+	var missing []string
+	for path, item := range paths {
+		for method, op := range item.(map[string]interface{}) {
+			responses := op.(map[string]interface{})["responses"].(map[string]interface{})
+			for code := range responses {
+				key := strings.ToUpper(method) + " " + path + " " + code
+				if !seen[key] {
+					missing = append(missing, key)
+				}
+			}
+		}
+	}
+	sort.Strings(missing)
+	for _, key := range missing {
+		t.Errorf("no replay covers %s", key)
+	}
+}
+
+// TestOpenAPIRoutes checks that each version's spec and routes agree on
+// the operations and which are deprecated, and that a replay checks every
+// route's responses against the spec.
+func TestOpenAPIRoutes(t *testing.T) {
+	replayed := map[string]bool{}
+	for _, tc := range replays {
+		path, _, _ := strings.Cut(tc.target, "?")
+		replayed[tc.method+" "+path] = true
+	}
+
+	for _, v := range versions {
+		var spec struct {
+			Servers []struct {
+				URL string `json:"url"`
+			} `json:"servers"`
+			Paths map[string]map[string]struct {
+				Deprecated bool `json:"deprecated"`
+			} `json:"paths"`
+		}
+		if err := json.Unmarshal(v.spec, &spec); err != nil {
+			t.Fatalf("%s: %v", v.prefix, err)
+		}
+		for _, server := range spec.Servers {
+			if !strings.HasSuffix(server.URL, v.prefix) {
+				t.Errorf("%s: the spec's server is %s", v.prefix, server.URL)
+			}
+		}
+		for path, ops := range spec.Paths {
+			for method := range ops {
+				if _, ok := v.findRoute(strings.ToUpper(method), path); !ok {
+					t.Errorf("%s: the spec documents %s %s, which is not routed", v.prefix, strings.ToUpper(method), path)
+				}
+			}
+		}
+		for _, rt := range v.routes {
+			op, ok := spec.Paths[rt.endpoint][strings.ToLower(rt.method)]
+			if !ok {
+				t.Errorf("%s: %s %s is not documented in the spec", v.prefix, rt.method, rt.endpoint)
+				continue
+			}
+			if op.Deprecated != (rt.deprecated != nil) {
+				t.Errorf("%s: %s %s: deprecated in the spec is %v", v.prefix, rt.method, rt.endpoint, op.Deprecated)
+			}
+			if !replayed[rt.method+" "+v.prefix+rt.endpoint] {
+				t.Errorf("%s: no replay checks %s %s against the spec", v.prefix, rt.method, rt.endpoint)
+			}
+		}
+	}
+}
+
+// TestAlias checks that an alias is served and logged as its endpoint,
+// with the alias recorded.
+func TestAlias(t *testing.T) {
+	s := newServer(t, health.SchemaVersion)
+	for _, target := range []string{"/v1/automessage?name=Ann", "/v1/message?name=Ann"} {
+		s.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", target, nil))
+	}
+
+	rec := httptest.NewRecorder()
+	s.ServeHTTP(rec, httptest.NewRequest("GET", "/v1/message?name=Ann", nil))
+	var resp MessageResponse
+	if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil {
+		t.Fatal(err)
+	}
+	if resp.Sequence != 3 {
+		t.Errorf("sequence %d, want 3: the alias should count as /automessage", resp.Sequence)
+	}
+	if link := rec.Header().Get("Link"); link != `</v1/automessage>; rel="successor-version"` {
+		t.Errorf("Link %q", link)
+	}
+
+	var aliased int
+	err := s.DB.QueryRow(`
+        SELECT COUNT(*) FROM activity_log WHERE endpoint = '/automessage' AND alias = '/message'
+    `).Scan(&aliased)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if aliased != 2 {
+		t.Errorf("%d requests logged with the alias, want 2", aliased)
+	}
+}
+
+func TestNotFound(t *testing.T) {
+	s := newServer(t, health.SchemaVersion)
+	for _, target := range []string{"DELETE /v1/status", "GET /v1/nothing", "GET /v2/message?name=Ann", "GET /v2/metrics", "GET /v3/status"} {
+		method, path, _ := strings.Cut(target, " ")
+		rec := httptest.NewRecorder()
+		s.ServeHTTP(rec, httptest.NewRequest(method, path, nil))
+		if rec.Code != http.StatusNotFound {
+			t.Errorf("%s: status %d, want 404", target, rec.Code)
+		}
+	}
+}
+
+// TestCORS checks preflights and the origin headers with and without an
+// allow-list.
+func TestCORS(t *testing.T) {
+	tests := []struct {
+		name        string
+		allowed     []string
+		method      string
+		target      string
+		origin      string
+		status      int
+		allowOrigin string
+		credentials bool
+		methods     string
+	}{
+		{name: "any origin", method: "GET", target: "/v1/status?probe=live", origin: "https://student.example", status: 200, allowOrigin: "*"},
+		{name: "any origin preflight", method: "OPTIONS", target: "/v1/message", origin: "https://student.example", status: 204, allowOrigin: "*", methods: "GET, POST, OPTIONS"},
+		{name: "v2 preflight", method: "OPTIONS", target: "/v2/message", origin: "https://student.example", status: 204, allowOrigin: "*", methods: "POST, OPTIONS"},
+		{name: "preflight not served", method: "OPTIONS", target: "/v1/nothing", origin: "https://student.example", status: 404, allowOrigin: "*"},
+		{name: "listed origin", allowed: []string{"https://course.example/", "https://student.example"}, method: "POST", target: "/v1/message", origin: "https://course.example", status: 400, allowOrigin: "https://course.example", credentials: true},
+		{name: "listed origin preflight", allowed: []string{"https://course.example"}, method: "OPTIONS", target: "/v1/messages", origin: "https://course.example", status: 204, allowOrigin: "https://course.example", credentials: true, methods: "GET, OPTIONS"},
+		{name: "unlisted origin", allowed: []string{"https://course.example"}, method: "GET", target: "/v1/status?probe=live", origin: "https://evil.example", status: 200},
+		{name: "unlisted origin preflight", allowed: []string{"https://course.example"}, method: "OPTIONS", target: "/v1/message", origin: "https://evil.example", status: 204},
+		{name: "no origin", allowed: []string{"https://course.example"}, method: "GET", target: "/v1/status?probe=live", status: 200},
+		{name: "wildcard in list", allowed: []string{"*"}, method: "GET", target: "/v1/status?probe=live", origin: "https://evil.example", status: 200, allowOrigin: "*"},
+		{name: "wildcard beside listed origin", allowed: []string{"*", "https://course.example"}, method: "GET", target: "/v1/status?probe=live", origin: "https://course.example", status: 200, allowOrigin: "https://course.example", credentials: true},
+		{name: "wildcard beside unlisted origin", allowed: []string{"https://course.example", "*"}, method: "OPTIONS", target: "/v1/message", origin: "https://evil.example", status: 204, allowOrigin: "*", methods: "GET, POST, OPTIONS"},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			s := newServer(t, health.SchemaVersion)
+			s.AllowedOrigins = tc.allowed
+			req := httptest.NewRequest(tc.method, tc.target, nil)
+			if tc.origin != "" {
+				req.Header.Set("Origin", tc.origin)
+			}
+			rec := httptest.NewRecorder()
+			s.ServeHTTP(rec, req)
+
+			if rec.Code != tc.status {
+				t.Errorf("status %d, want %d", rec.Code, tc.status)
+			}
+			h := rec.Header()
+			if got := h.Get("Access-Control-Allow-Origin"); got != tc.allowOrigin {
+				t.Errorf("Access-Control-Allow-Origin %q, want %q", got, tc.allowOrigin)
+			}
+			if got := h.Get("Access-Control-Allow-Credentials") == "true"; got != tc.credentials {
+				t.Errorf("credentials allowed: %v, want %v", got, tc.credentials)
+			}
+			if got := h.Get("Access-Control-Allow-Methods"); got != tc.methods {
+				t.Errorf("Access-Control-Allow-Methods %q, want %q", got, tc.methods)
+			}
+			if tc.methods != "" && !strings.Contains(h.Get("Access-Control-Allow-Headers"), "Content-Type") {
+				t.Errorf("Access-Control-Allow-Headers %q does not allow Content-Type", h.Get("Access-Control-Allow-Headers"))
+			}
+			if vary := strings.Contains(strings.Join(h.Values("Vary"), ", "), "Origin"); vary != (len(tc.allowed) > 0) {
+				t.Errorf("Vary: Origin sent: %v, with an allow-list: %v", vary, len(tc.allowed) > 0)
+			}
+		})
+	}
+
+	// Preflights are not logged as student activity
+	s := newServer(t, health.SchemaVersion)
+	s.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("OPTIONS", "/v1/message", nil))
+	var logged int
+	if err := s.DB.QueryRow(`SELECT COUNT(*) FROM activity_log`).Scan(&logged); err != nil {
+		t.Fatal(err)
+	}
+	if logged != 0 {
+		t.Errorf("%d preflights logged, want 0", logged)
+	}
+}
+
+func TestParseOrigins(t *testing.T) {
+	got := ParseOrigins(" https://a.example, https://b.example\thttps://c.example,,")
+	want := []string{"https://a.example", "https://b.example", "https://c.example"}
+	if fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Errorf("ParseOrigins = %q, want %q", got, want)
+	}
+}
+
+// TestConditionalMessages checks that a client revalidating its messages
+// gets a 304 until a message is sent to it.
+func TestConditionalMessages(t *testing.T) {
+	s := newServer(t, health.SchemaVersion)
+	get := func(target, ifNoneMatch string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("GET", target, nil)
+		if ifNoneMatch != "" {
+			req.Header.Set("If-None-Match", ifNoneMatch)
+		}
+		rec := httptest.NewRecorder()
+		s.ServeHTTP(rec, req)
+		return rec
+	}
+
+	first := get("/v1/messages?recipient=Bob", "")
+	etag := first.Header().Get("ETag")
+	if first.Code != 200 || etag == "" {
+		t.Fatalf("status %d, ETag %q", first.Code, etag)
+	}
+	for _, inm := range []string{etag, "W/" + etag, `"other", ` + etag} {
+		if rec := get("/v1/messages?recipient=Bob", inm); rec.Code != 304 || rec.Body.Len() > 0 {
+			t.Errorf("If-None-Match %s: status %d, body %q, want an empty 304", inm, rec.Code, rec.Body)
+		}
+	}
+	for _, target := range []string{"/v1/messages?recipient=Bob&limit=5", "/v2/messages?recipient=Bob"} {
+		if rec := get(target, etag); rec.Code != 200 {
+			t.Errorf("%s: status %d with v1's ETag, want 200", target, rec.Code)
+		}
+	}
+
+	s.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("POST", "/v1/message",
+		strings.NewReader(`{"from":"Cat","to":"Bob","message":"Nice work!"}`)))
+	rec := get("/v1/messages?recipient=Bob", etag)
+	if rec.Code != 200 {
+		t.Fatalf("status %d after a new message, want 200", rec.Code)
+	}
+	if rec.Header().Get("ETag") == etag {
+		t.Error("the ETag did not change with a new message")
+	}
+}
+
+// TestCatalog checks that GET /automessage keeps the message catalog in
+// memory between requests.
+func TestCatalog(t *testing.T) {
+	s := newServer(t, health.SchemaVersion)
+	for i := 0; i < 2; i++ {
+		rec := httptest.NewRecorder()
+		s.ServeHTTP(rec, httptest.NewRequest("GET", "/v1/automessage?name=Ann", nil))
+		if rec.Code != 200 {
+			t.Fatalf("request %d: status %d: %s", i+1, rec.Code, rec.Body)
+		}
+		// Only the cached catalog can answer the second request
+		if _, err := s.DB.Exec(`DELETE FROM messages`); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	s.catalog.loaded = time.Now().Add(-catalogTTL - time.Second)
+	rec := httptest.NewRecorder()
+	s.ServeHTTP(rec, httptest.NewRequest("GET", "/v1/automessage?name=Ann", nil))
+	if rec.Code != 500 {
+		t.Errorf("status %d with an expired cache and an empty catalog, want 500", rec.Code)
+	}
+}
+
+func TestPreferredFormat(t *testing.T) {
+	tests := []struct {
+		accept string
+		want   string
+	}{
+		{"*/*", "json"},
+		{"application/json", "json"},
+		{"text/plain", "text"},
+		{"text/*", "text"},
+		{"text/xml", "xml"},
+		{"application/xml, application/json;q=0.5", "xml"},
+		{"text/plain;q=0.4, text/html;q=0.9", "html"},
+		{"text/html,application/xhtml+xml,application/xml;q=0.9,*/*;q=0.8", "html"},
+		{"text/*;q=0.1, text/plain", "text"},
+		{"text/plain;q=0, */*", "json"},
+		{"image/png", "json"},
+		{"nonsense;;", "json"},
+	}
+	for _, tc := range tests {
+		if got := preferredFormat(tc.accept).name; got != tc.want {
+			t.Errorf("preferredFormat(%q) = %s, want %s", tc.accept, got, tc.want)
+		}
+	}
+}
+
+// TestPreferredMediaType covers how the happywatch dashboard chooses
+// between its HTML page and JSON.
+func TestPreferredMediaType(t *testing.T) {
+	tests := []struct {
+		accept string
+		want   string
+	}{
+		{"", "text/html"},
+		{"*/*", "text/html"},
+		{"application/json", "application/json"},
+		{"application/json, text/html", "text/html"},
+		{"text/html;q=0.5, application/json", "application/json"},
+		{"text/*;q=0.5, application/json", "application/json"},
+		{"text/html,application/xhtml+xml,application/xml;q=0.9,*/*;q=0.8", "text/html"},
+		{"text/html;q=0.1, */*", "application/json"},
+		{"image/png", "text/html"},
+	}
+	for _, tc := range tests {
+		if got := PreferredMediaType(tc.accept, "text/html", "application/json"); got != tc.want {
+			t.Errorf("PreferredMediaType(%q) = %s, want %s", tc.accept, got, tc.want)
+		}
+	}
+}
+
+// lookup follows keys through nested JSON objects.
+func lookup(v map[string]interface{}, keys ...string) (map[string]interface{}, bool) {
+	for _, k := range keys {
+		next, ok := v[k].(map[string]interface{})
+		if !ok {
+			return nil, false
+		}
+		v = next
+	}
+	return v, true
+}
+
+// resolve follows a local $ref such as "#/components/schemas/Error".
+func resolve(spec, v map[string]interface{}) map[string]interface{} {
+	ref, ok := v["$ref"].(string)
+	if !ok {
+		return v
+	}
+	target, ok := lookup(spec, strings.Split(strings.TrimPrefix(ref, "#/"), "/")...)
+	if !ok {
+		panic("unresolved $ref " + ref)
+	}
+	return resolve(spec, target)
+}
+
+// validate checks a decoded JSON value against the subset of JSON Schema
+// the spec uses, returning what does not match.
+func validate(spec, schema map[string]interface{}, value interface{}, at string) []string {
+	schema = resolve(spec, schema)
+	var problems []string
+	fail := func(format string, args ...interface{}) {
+		problems = append(problems, at+": "+fmt.Sprintf(format, args...))
+	}
+
+	if value == nil && schema["nullable"] == true {
+		return nil
+	}
+
+	if enum, ok := schema["enum"].([]interface{}); ok {
+		found := false
+		for _, e := range enum {
+			if e == value {
+				found = true
+			}
+		}
+		if !found {
+			fail("%v is not one of %v", value, enum)
+		}
+	}
+
+	switch schema["type"] {
+	case "object":
+		obj, ok := value.(map[string]interface{})
+		if !ok {
+			fail("want an object, got %T", value)
+			return problems
+		}
+		props, _ := schema["properties"].(map[string]interface{})
+		if required, ok := schema["required"].([]interface{}); ok {
+			for _, r := range required {
+				if _, ok := obj[r.(string)]; !ok {
+					fail("missing %q", r)
+				}
+			}
+		}
+		for k, v := range obj {
+			if p, ok := props[k].(map[string]interface{}); ok {
+				problems = append(problems, validate(spec, p, v, at+"."+k)...)
+				continue
+			}
+			switch extra := schema["additionalProperties"].(type) {
+			case bool:
+				if !extra {
+					fail("unexpected property %q", k)
+				}
+			case map[string]interface{}:
+				problems = append(problems, validate(spec, extra, v, at+"."+k)...)
+			}
+		}
+	case "array":
+		arr, ok := value.([]interface{})
+		if !ok {
+			fail("want an array, got %T", value)
+			return problems
+		}
+		items, _ := schema["items"].(map[string]interface{})
+		for i, v := range arr {
+			problems = append(problems, validate(spec, items, v, fmt.Sprintf("%s[%d]", at, i))...)
+		}
+	case "string":
+		s, ok := value.(string)
+		if !ok {
+			fail("want a string, got %T", value)
+			return problems
+		}
+		if schema["format"] == "date-time" {
+			if _, err := time.Parse(time.RFC3339Nano, s); err != nil {
+				fail("%q is not a date-time", s)
+			}
+		}
+	case "integer":
+		n, ok := value.(json.Number)
+		if !ok {
+			fail("want an integer, got %T", value)
+			return problems
+		}
+		i, err := n.Int64()
+		if err != nil {
+			fail("%s is not an integer", n)
+			return problems
+		}
+		if min, ok := schema["minimum"].(float64); ok && float64(i) < min {
+			fail("%d is below the minimum %v", i, min)
+		}
+	case "boolean":
+		if _, ok := value.(bool); !ok {
+			fail("want a boolean, got %T", value)
+		}
+	}
+	return problems
+}
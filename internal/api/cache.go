@@ -0,0 +1,131 @@
+package api
+
+import (
+	"crypto/sha256"
+	"database/sql"
+	"fmt"
+	"math/rand"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/industrial-linguistics/happy-api/internal/i18n"
+)
+
+const (
+	// statusMaxAge lets the CDN answer status polls for a few seconds
+	statusMaxAge = "public, max-age=10"
+
+	// catalogTTL is how long the message catalog is kept in memory. It
+	// only changes when init-db or an instructor adds messages.
+	catalogTTL = time.Minute
+)
+
+// catalog caches the messages table for GET /automessage. Under CGI it
+// lasts a single request, but in server mode it saves a query per call.
+type catalog struct {
+	mu       sync.Mutex
+	messages map[string][]string // by locale
+	locales  []string
+	loaded   time.Time
+}
+
+// randomMessage returns a message from the catalog in the locale that
+// best serves prefs, and that locale. It loads the catalog if it is empty
+// or older than catalogTTL.
+func (s *Server) randomMessage(prefs []string) (string, string, error) {
+	c := &s.catalog
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if len(c.messages) == 0 || time.Since(c.loaded) > catalogTTL {
+		rows, err := s.DB.Query(`SELECT locale, message FROM messages ORDER BY locale`)
+		if err != nil {
+			return "", "", err
+		}
+		defer rows.Close()
+
+		messages := map[string][]string{}
+		var locales []string
+		for rows.Next() {
+			var locale, m string
+			if err := rows.Scan(&locale, &m); err != nil {
+				return "", "", err
+			}
+			if len(messages[locale]) == 0 {
+				locales = append(locales, locale)
+			}
+			messages[locale] = append(messages[locale], m)
+		}
+		if err := rows.Err(); err != nil {
+			return "", "", err
+		}
+		if len(messages) == 0 {
+			return "", "", sql.ErrNoRows
+		}
+		c.messages, c.locales, c.loaded = messages, locales, time.Now()
+	}
+
+	locale := i18n.Match(prefs, c.locales)
+	messages := c.messages[locale]
+	return messages[rand.Intn(len(messages))], locale, nil
+}
+
+// inboxValidators returns the ETag and Last-Modified time of recipient's
+// first limit messages. They change whenever a message is sent to the
+// recipient or removed, without reading the messages themselves.
+func (h *handler) inboxValidators(recipient string, limit int) (string, time.Time, error) {
+	var count int
+	var newestID string
+	var newest time.Time
+	err := h.DB.QueryRow(`
+        SELECT message_id, created_at,
+               (SELECT COUNT(*) FROM user_messages WHERE to_user = ?1)
+        FROM user_messages
+        WHERE to_user = ?1
+        ORDER BY created_at DESC, rowid DESC
+        LIMIT 1
+    `, recipient).Scan(&newestID, &newest, &count)
+	if err != nil && err != sql.ErrNoRows {
+		return "", time.Time{}, err
+	}
+
+	// The version and format are part of the tag because each sends a
+	// different body
+	sum := sha256.Sum256([]byte(fmt.Sprintf("%s\x00%s\x00%s\x00%d\x00%d\x00%s",
+		h.version.prefix, h.format.name, recipient, limit, count, newestID)))
+	return fmt.Sprintf(`"%x"`, sum[:8]), newest, nil
+}
+
+// notModified sets the validators for the response and reports whether
+// the request's conditions show the client already has it. If-None-Match
+// takes precedence over If-Modified-Since, as RFC 9110 requires.
+func (h *handler) notModified(etag string, modified time.Time) bool {
+	header := h.w.Header()
+	header.Set("ETag", etag)
+	if !modified.IsZero() {
+		header.Set("Last-Modified", modified.UTC().Format(http.TimeFormat))
+	}
+
+	if inm := h.r.Header.Get("If-None-Match"); inm != "" {
+		return etagMatches(inm, etag)
+	}
+	if ims := h.r.Header.Get("If-Modified-Since"); ims != "" && !modified.IsZero() {
+		since, err := http.ParseTime(ims)
+		return err == nil && !modified.Truncate(time.Second).After(since)
+	}
+	return false
+}
+
+// etagMatches reports whether an If-None-Match list names etag, using the
+// weak comparison RFC 9110 specifies for it.
+func etagMatches(list, etag string) bool {
+	for _, tag := range strings.Split(list, ",") {
+		tag = strings.TrimSpace(tag)
+		if tag == "*" || strings.TrimPrefix(tag, "W/") == etag {
+			return true
+		}
+	}
+	return false
+}
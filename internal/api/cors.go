@@ -0,0 +1,89 @@
+package api
+
+import (
+	"net/http"
+	"strings"
+)
+
+// corsHeaders are the request headers browsers may send cross-origin.
+// Content-Type lets the web exercises POST JSON, and Authorization lets
+// credentialed requests through a proxy that asks for a login.
+const corsHeaders = "Content-Type, Authorization"
+
+// corsMaxAge is how long, in seconds, a browser may cache a preflight.
+const corsMaxAge = "86400"
+
+// ParseOrigins splits a comma- or space-separated list of origins, such
+// as the -allow-origins flag or HAPPY_ALLOWED_ORIGINS.
+func ParseOrigins(s string) []string {
+	return strings.FieldsFunc(s, func(r rune) bool {
+		return r == ',' || r == ' ' || r == '\t' || r == '\n'
+	})
+}
+
+// allowOrigin reports the Access-Control-Allow-Origin to send for a
+// request from origin, and whether the browser may send credentials with
+// it. With no allow-list every origin is allowed without credentials, as
+// the API always has, and a "*" entry does the same for origins the list
+// does not name. Credentials are only ever allowed for an origin the list
+// names, since browsers refuse them with "*".
+func (s *Server) allowOrigin(origin string) (string, bool) {
+	if len(s.AllowedOrigins) == 0 {
+		return "*", false
+	}
+	wildcard := false
+	for _, o := range s.AllowedOrigins {
+		if o == "*" {
+			wildcard = true
+		} else if origin != "" && strings.EqualFold(strings.TrimSuffix(o, "/"), origin) {
+			return origin, true
+		}
+	}
+	if wildcard {
+		return "*", false
+	}
+	return "", false
+}
+
+// setCORS sets the headers that let a browser page read the response.
+func (h *handler) setCORS() {
+	header := h.w.Header()
+	allowed, credentials := h.allowOrigin(h.r.Header.Get("Origin"))
+	if len(h.AllowedOrigins) > 0 {
+		// The response depends on the origin, so caches must not share it
+		header.Add("Vary", "Origin")
+	}
+	if allowed == "" {
+		return
+	}
+	header.Set("Access-Control-Allow-Origin", allowed)
+	if credentials {
+		header.Set("Access-Control-Allow-Credentials", "true")
+	}
+}
+
+// handlePreflight answers a CORS preflight for endpoint with the methods
+// its routes serve, or reports false when nothing is served there.
+func (h *handler) handlePreflight(endpoint string) bool {
+	var methods []string
+	for _, rt := range h.version.routes {
+		if rt.endpoint == endpoint {
+			methods = append(methods, rt.method)
+		}
+	}
+	if len(methods) == 0 {
+		return false
+	}
+	methods = append(methods, http.MethodOptions)
+
+	header := h.w.Header()
+	header.Set("Allow", strings.Join(methods, ", "))
+	h.setCORS()
+	if header.Get("Access-Control-Allow-Origin") != "" {
+		header.Set("Access-Control-Allow-Methods", strings.Join(methods, ", "))
+		header.Set("Access-Control-Allow-Headers", corsHeaders)
+		header.Set("Access-Control-Max-Age", corsMaxAge)
+	}
+	h.w.WriteHeader(http.StatusNoContent)
+	return true
+}
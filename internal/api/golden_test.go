@@ -0,0 +1,147 @@
+package api
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"net/http/httptest"
+
+	"github.com/industrial-linguistics/happy-api/internal/health"
+)
+
+var update = flag.Bool("update", false, "rewrite the golden files in testdata/golden")
+
+// goldenClock is the time every golden response is made at. It is in
+// +08:00 and has nanoseconds, so that the files show that every version
+// answers in UTC and what each does with the nanoseconds.
+var goldenClock = time.Date(2026, 10, 18, 17, 30, 15, 123456789, time.FixedZone("AWST", 8*60*60))
+
+// goldenRequests are replayed in order against each version, with the
+// endpoint under its prefix. A request a version does not route records
+// its 404.
+var goldenRequests = []struct {
+	name   string
+	method string
+	path   string
+	body   string
+	addr   string
+	header string // "Name: value"
+}{
+	{name: "automessage", method: "GET", path: "/automessage?name=Ann&session_id=s1"},
+	{name: "automessage-again", method: "GET", path: "/automessage?name=Ann&session_id=s1"},
+	{name: "automessage-without-name", method: "GET", path: "/automessage"},
+	{name: "automessage-rate-limited", method: "GET", path: "/automessage?name=Ann", addr: "10.0.0.99:1234"},
+	{name: "automessage-text", method: "GET", path: "/automessage?name=Ann&format=text"},
+	{name: "automessage-html", method: "GET", path: "/automessage?name=Ann&format=html"},
+	{name: "automessage-xml", method: "GET", path: "/automessage?name=Ann&format=xml"},
+	{name: "automessage-accept-text", method: "GET", path: "/automessage?name=Ann", header: "Accept: text/plain"},
+	{name: "automessage-bad-format", method: "GET", path: "/automessage?name=Ann&format=yaml"},
+	{name: "automessage-german", method: "GET", path: "/automessage?name=Ann", header: "Accept-Language: de-AT,de;q=0.9,en;q=0.8"},
+	{name: "automessage-lang-fallback", method: "GET", path: "/automessage?name=Ann&lang=ja"},
+	{name: "automessage-without-name-french", method: "GET", path: "/automessage?lang=fr"},
+	{name: "send-negative-german", method: "POST", path: "/message?lang=de", body: `{"from":"Ann","to":"Cat","message":"Du bist ein Dummkopf"}`},
+	{name: "message-alias", method: "GET", path: "/message?name=Ann"},
+	{name: "send", method: "POST", path: "/message", body: `{"from":"Ann","to":"Cat","message":"Nice work!","session_id":"s1"}`},
+	{name: "send-negative", method: "POST", path: "/message", body: `{"from":"Ann","to":"Cat","message":"awful"}`},
+	{name: "send-negative-no-language", method: "POST", path: "/message", body: `{"from":"Ann","to":"Cat","message":"Ich hasse dich"}`},
+	{name: "send-bad-json", method: "POST", path: "/message", body: `{`},
+	{name: "messages", method: "GET", path: "/messages?recipient=Bob"},
+	{name: "messages-none", method: "GET", path: "/messages?recipient=Nobody"},
+	{name: "messages-text", method: "GET", path: "/messages?recipient=Bob&format=text"},
+	{name: "messages-html", method: "GET", path: "/messages?recipient=Bob&format=html"},
+	{name: "messages-xml", method: "GET", path: "/messages?recipient=Bob&format=xml"},
+	{name: "messages-accept-browser", method: "GET", path: "/messages?recipient=Bob", header: "Accept: text/html,application/xhtml+xml,application/xml;q=0.9,*/*;q=0.8"},
+	{name: "messages-not-modified-since", method: "GET", path: "/messages?recipient=Bob", header: "If-Modified-Since: Sun, 18 Oct 2026 09:12:45 GMT"},
+	{name: "messages-modified-since", method: "GET", path: "/messages?recipient=Bob", header: "If-Modified-Since: Sun, 18 Oct 2026 09:12:44 GMT"},
+	{name: "messages-none-match", method: "GET", path: "/messages?recipient=Bob", header: `If-None-Match: "0000000000000000"`},
+	{name: "messages-without-recipient", method: "GET", path: "/messages"},
+	{name: "status-live", method: "GET", path: "/status?probe=live"},
+	{name: "status-bad-probe", method: "GET", path: "/status?probe=deep"},
+	{name: "not-found", method: "GET", path: "/nothing"},
+	{name: "preflight", method: "OPTIONS", path: "/message"},
+	{name: "preflight-not-found", method: "OPTIONS", path: "/nothing"},
+}
+
+// TestGolden compares each version's responses with the files in
+// testdata/golden, so that a change to what a version sends shows up in
+// review. Run go test -update to rewrite them after an intended change.
+func TestGolden(t *testing.T) {
+	for _, v := range versions {
+		t.Run(v.prefix[1:], func(t *testing.T) {
+			s := newGoldenServer(t)
+			for _, tc := range goldenRequests {
+				req := httptest.NewRequest(tc.method, v.prefix+tc.path, strings.NewReader(tc.body))
+				if tc.addr != "" {
+					req.RemoteAddr = tc.addr
+				}
+				if name, value, ok := strings.Cut(tc.header, ": "); ok {
+					req.Header.Set(name, value)
+				}
+				rec := httptest.NewRecorder()
+				s.ServeHTTP(rec, req)
+
+				var got bytes.Buffer
+				fmt.Fprintf(&got, "%s %s\n%d\n", tc.method, v.prefix+tc.path, rec.Code)
+				var keys []string
+				for k := range rec.Header() {
+					keys = append(keys, k)
+				}
+				sort.Strings(keys)
+				for _, k := range keys {
+					fmt.Fprintf(&got, "%s: %s\n", k, strings.Join(rec.Header()[k], ", "))
+				}
+				fmt.Fprintf(&got, "\n%s", rec.Body)
+
+				file := filepath.Join("testdata", "golden", v.prefix[1:], tc.name+".golden")
+				if *update {
+					if err := os.MkdirAll(filepath.Dir(file), 0755); err != nil {
+						t.Fatal(err)
+					}
+					if err := os.WriteFile(file, got.Bytes(), 0644); err != nil {
+						t.Fatal(err)
+					}
+					continue
+				}
+				want, err := os.ReadFile(file)
+				if err != nil {
+					t.Fatalf("%v (run go test -update to create it)", err)
+				}
+				if !bytes.Equal(got.Bytes(), want) {
+					t.Errorf("%s differs from %s:\n%s", tc.name, file, got.Bytes())
+				}
+			}
+		})
+	}
+}
+
+// newGoldenServer returns a server whose responses do not vary between
+// runs: one message to choose from in each locale, a stored message with a
+// known time, the clock stopped at goldenClock and message IDs counted
+// from 1.
+func newGoldenServer(t *testing.T) *Server {
+	t.Helper()
+
+	s := newServer(t, health.SchemaVersion)
+	_, err := s.DB.Exec(`
+        DELETE FROM messages WHERE message NOT IN ('Keep going!', 'Weiter so!');
+        UPDATE user_messages SET created_at = '2026-10-18 09:12:45';
+    `)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s.clock = func() time.Time { return goldenClock }
+	var ids int
+	s.messageIDs = func() string {
+		ids++
+		return fmt.Sprintf("msg_%016x", ids)
+	}
+	return s
+}
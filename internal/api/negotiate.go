@@ -0,0 +1,166 @@
+package api
+
+import (
+	"encoding/xml"
+	"fmt"
+	"html/template"
+	"mime"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// format is a representation GET /automessage and GET /messages can send.
+type format struct {
+	name        string   // the format= value
+	mediaTypes  []string // what Accept may ask for it by, preferred first
+	contentType string
+}
+
+// formats are offered in order of preference, so JSON wins ties and is
+// sent when the client does not say.
+var formats = []format{
+	{name: "json", mediaTypes: []string{"application/json"}, contentType: "application/json"},
+	{name: "text", mediaTypes: []string{"text/plain"}, contentType: "text/plain; charset=utf-8"},
+	{name: "html", mediaTypes: []string{"text/html"}, contentType: "text/html; charset=utf-8"},
+	{name: "xml", mediaTypes: []string{"application/xml", "text/xml"}, contentType: "application/xml; charset=utf-8"},
+}
+
+// negotiate picks the format for the response from the format parameter
+// or, without one, the Accept header. It reports false when it has sent
+// an error for an unknown format.
+func (h *handler) negotiate(values url.Values) bool {
+	// Caches must keep each representation separately
+	h.w.Header().Add("Vary", "Accept")
+
+	h.format = formats[0]
+	if name := values.Get("format"); name != "" {
+		for _, f := range formats {
+			if f.name == name {
+				h.format = f
+				return true
+			}
+		}
+		h.sendError(400, "format must be json, text, html or xml")
+		return false
+	}
+
+	if accept := h.r.Header.Get("Accept"); accept != "" {
+		h.format = preferredFormat(accept)
+	}
+	return true
+}
+
+// preferredFormat returns the format accept gives the highest quality.
+// When none is acceptable it returns JSON rather than a 406, which would
+// only puzzle a beginner.
+func preferredFormat(accept string) format {
+	var offers []string
+	for _, f := range formats {
+		offers = append(offers, f.mediaTypes...)
+	}
+	best := PreferredMediaType(accept, offers...)
+	for _, f := range formats {
+		for _, mediaType := range f.mediaTypes {
+			if mediaType == best {
+				return f
+			}
+		}
+	}
+	return formats[0]
+}
+
+// PreferredMediaType returns the offer an Accept header gives the highest
+// quality, judging each by the most specific range that matches it. Ties,
+// and a header that accepts none of them, go to the first offer.
+func PreferredMediaType(accept string, offers ...string) string {
+	quality := map[string]float64{}
+	for _, part := range strings.Split(accept, ",") {
+		mediaType, params, err := mime.ParseMediaType(strings.TrimSpace(part))
+		if err != nil {
+			continue
+		}
+		q := 1.0
+		if v, ok := params["q"]; ok {
+			if q, err = strconv.ParseFloat(v, 64); err != nil {
+				continue
+			}
+		}
+		if old, ok := quality[mediaType]; !ok || q > old {
+			quality[mediaType] = q
+		}
+	}
+
+	best, bestQ := offers[0], 0.0
+	for _, mediaType := range offers {
+		kind, _, _ := strings.Cut(mediaType, "/")
+		q, ok := quality[mediaType]
+		if !ok {
+			q, ok = quality[kind+"/*"]
+		}
+		if !ok {
+			q = quality["*/*"]
+		}
+		if q > bestQ {
+			best, bestQ = mediaType, q
+		}
+	}
+	return best
+}
+
+// send writes v, a MessageResponse or an Inbox, in the negotiated format.
+func (h *handler) send(code int, v interface{}) {
+	if h.format.name == "json" {
+		h.sendJSON(code, v)
+		return
+	}
+
+	h.w.Header().Set("Content-Type", h.format.contentType)
+	h.setCORS()
+	h.w.WriteHeader(code)
+
+	switch h.format.name {
+	case "text":
+		switch v := v.(type) {
+		case MessageResponse:
+			fmt.Fprintln(h.w, v.Message)
+		case Inbox:
+			// One message a line, for beginners to split
+			for _, m := range v.Messages {
+				fmt.Fprintf(h.w, "%s: %s\n", m.From, m.Message)
+			}
+		}
+	case "html":
+		name := "message"
+		if _, ok := v.(Inbox); ok {
+			name = "inbox"
+		}
+		fragmentTemplate.ExecuteTemplate(h.w, name, v)
+	case "xml":
+		root := "message"
+		if _, ok := v.(Inbox); ok {
+			root = "inbox"
+		}
+		h.w.Write([]byte(xml.Header))
+		enc := xml.NewEncoder(h.w)
+		enc.Indent("", "  ")
+		enc.EncodeElement(v, xml.StartElement{Name: xml.Name{Local: root}})
+		h.w.Write([]byte("\n"))
+	}
+}
+
+// fragmentTemplate draws a response as HTML to insert into a page, with
+// classes to style it by.
+var fragmentTemplate = template.Must(template.New("fragment").Parse(`
+{{- define "message" -}}
+<p class="happy-message" data-message-id="{{ .MessageID }}" data-sequence="{{ .Sequence }}">{{ .Message }}</p>
+{{ end }}
+
+{{- define "inbox" -}}
+<ul class="happy-messages" data-recipient="{{ .Recipient }}">
+{{- range .Messages }}
+  <li class="happy-message" data-message-id="{{ .MessageID }}"><span class="from">{{ .From }}</span>: <span class="message">{{ .Message }}</span> <time datetime="{{ .Timestamp.Format "2006-01-02T15:04:05Z07:00" }}">{{ .Timestamp.Format "2 Jan 15:04" }}</time></li>
+{{- end }}
+</ul>
+{{ end }}
+`))
@@ -0,0 +1,24 @@
+package api
+
+import _ "embed"
+
+// Each version's OpenAPI 3 description, served at openapi.json under its
+// prefix. They are written by hand, so api_test.go holds them to the code:
+// TestOpenAPIRoutes fails when a route is missing from its spec or a spec
+// documents an operation no route serves, and TestOpenAPI replays requests
+// against the handlers and checks every response against them. Edit them
+// along with the handlers and the route tables in routes.go.
+var (
+	//go:embed openapi-v1.json
+	openAPIv1 []byte
+	//go:embed openapi-v2.json
+	openAPIv2 []byte
+)
+
+func (h *handler) handleOpenAPI() int {
+	h.w.Header().Set("Content-Type", "application/json")
+	h.setCORS()
+	h.w.WriteHeader(200)
+	h.w.Write(h.version.spec)
+	return 200
+}
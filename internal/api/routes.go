@@ -0,0 +1,149 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// apiVersion is one version of the API: the routes under its prefix, its
+// OpenAPI description and how it writes responses. Versions share the
+// handlers' validation and queries and differ only in what they send, and
+// activity_log records requests by endpoint whatever the version, so that
+// happywatch follows students across them.
+type apiVersion struct {
+	prefix string
+	routes []route
+	spec   []byte
+
+	// precision is what response timestamps are truncated to.
+	precision time.Duration
+}
+
+// findRoute returns the route serving method on endpoint.
+func (v *apiVersion) findRoute(method, endpoint string) (route, bool) {
+	for _, rt := range v.routes {
+		if rt.method == method && rt.endpoint == endpoint {
+			return rt, true
+		}
+	}
+	return route{}, false
+}
+
+// v1 is the original API. Its responses must not change: the golden files
+// in testdata/golden/v1 hold it to that.
+var v1 = &apiVersion{
+	prefix: "/v1",
+	spec:   openAPIv1,
+	routes: []route{
+		{method: "GET", endpoint: "/automessage", handle: (*handler).handleGetAutoMessage},
+		// The README and exercises used to call GET /message
+		{method: "GET", endpoint: "/message", handle: (*handler).handleGetAutoMessage, aliasOf: "/automessage",
+			deprecated: &Deprecation{
+				Since:  time.Date(2026, 10, 18, 0, 0, 0, 0, time.UTC),
+				Sunset: time.Date(2027, 7, 1, 0, 0, 0, 0, time.UTC),
+			}},
+		{method: "POST", endpoint: "/message", handle: (*handler).handlePostMessage},
+		{method: "GET", endpoint: "/messages", handle: (*handler).handleGetMessages},
+		{method: "GET", endpoint: "/status", handle: (*handler).handleStatus},
+		{method: "GET", endpoint: "/openapi.json", handle: (*handler).handleOpenAPI},
+		// Scrapes are not logged, or they would swamp the dashboard
+		{method: "GET", endpoint: "/metrics", handle: (*handler).handleMetrics, unlogged: true},
+	},
+}
+
+// v2 sends typed responses with every timestamp in UTC to the second, and
+// drops v1's deprecated aliases.
+var v2 = &apiVersion{
+	prefix:    "/v2",
+	spec:      openAPIv2,
+	precision: time.Second,
+	routes: []route{
+		{method: "GET", endpoint: "/automessage", handle: (*handler).handleGetAutoMessage},
+		{method: "POST", endpoint: "/message", handle: (*handler).handlePostMessageV2},
+		{method: "GET", endpoint: "/messages", handle: (*handler).handleGetMessagesV2},
+		{method: "GET", endpoint: "/status", handle: (*handler).handleStatus},
+		{method: "GET", endpoint: "/openapi.json", handle: (*handler).handleOpenAPI},
+	},
+}
+
+var versions = []*apiVersion{v1, v2}
+
+// splitVersion separates the version prefix from path. Paths outside every
+// version belong to v1, which has always answered them with a 404.
+func splitVersion(path string) (*apiVersion, string) {
+	for _, v := range versions {
+		if strings.HasPrefix(path, v.prefix+"/") {
+			return v, strings.TrimPrefix(path, v.prefix)
+		}
+	}
+	return v1, path
+}
+
+// Deprecation describes a route that still works but is going away.
+type Deprecation struct {
+	// Since is when the route was deprecated.
+	Since time.Time
+	// Sunset is when it may stop working.
+	Sunset time.Time
+}
+
+// setHeaders announces the deprecation as RFC 9745 and RFC 8594 describe,
+// pointing clients at successor.
+func (d *Deprecation) setHeaders(h http.Header, successor string) {
+	h.Set("Deprecation", fmt.Sprintf("@%d", d.Since.Unix()))
+	h.Set("Sunset", d.Sunset.UTC().Format(http.TimeFormat))
+	h.Set("Link", fmt.Sprintf(`<%s>; rel="successor-version"`, successor))
+}
+
+// route is one method and endpoint the API serves.
+type route struct {
+	method   string
+	endpoint string
+	handle   func(*handler) int
+
+	// aliasOf is the endpoint this route is another name for. Requests
+	// are logged as that endpoint, so that exercise milestones and message
+	// sequences count both, with the alias recorded alongside.
+	aliasOf    string
+	deprecated *Deprecation
+
+	// unlogged routes are left out of activity_log and the request
+	// metrics.
+	unlogged bool
+}
+
+// isEndpoint reports whether any route serves endpoint. Requests for
+// anything else are counted together as metrics.OtherEndpoint, so that
+// scanners cannot grow the metrics without bound.
+func isEndpoint(endpoint string) bool {
+	for _, e := range endpoints {
+		if e == endpoint {
+			return true
+		}
+	}
+	return false
+}
+
+// endpoints is every endpoint a route serves, without its version prefix.
+// It is filled in by init, since handlers in the route tables use it.
+var endpoints []string
+
+func init() {
+	seen := map[string]bool{}
+	for _, v := range versions {
+		for _, rt := range v.routes {
+			if !seen[rt.endpoint] {
+				seen[rt.endpoint] = true
+				endpoints = append(endpoints, rt.endpoint)
+			}
+		}
+	}
+}
+
+// Endpoints returns every endpoint a route serves, without its version
+// prefix, for metrics.Load.
+func Endpoints() []string {
+	return append([]string(nil), endpoints...)
+}
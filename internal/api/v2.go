@@ -0,0 +1,33 @@
+package api
+
+// handlePostMessageV2 answers with the message as stored, rather than
+// v1's map of its ID and status.
+func (h *handler) handlePostMessageV2() int {
+	req, messageID, code := h.saveMessage()
+	if code != 201 {
+		return code
+	}
+
+	h.sendJSON(201, Delivery{
+		MessageID: messageID,
+		From:      req.From,
+		To:        req.To,
+		Message:   req.Message,
+		Status:    "delivered",
+		Timestamp: h.now(),
+	})
+	return 201
+}
+
+func (h *handler) handleGetMessagesV2() int {
+	inbox, code := h.loadInbox()
+	if code != 200 {
+		return code
+	}
+
+	for i := range inbox.Messages {
+		inbox.Messages[i].Timestamp = inbox.Messages[i].Timestamp.UTC().Truncate(h.version.precision)
+	}
+	h.send(200, inbox)
+	return 200
+}
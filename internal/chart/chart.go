@@ -0,0 +1,235 @@
+// Package chart lays out the small charts used by the happywatch dashboard
+// and session reports: SVG charts computed in Go and drawn by the "chart"
+// template, so pages need no scripts or external files, and text
+// sparklines for terminals and Markdown.
+package chart
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/industrial-linguistics/happy-api/internal/monitor"
+)
+
+// Chart is a chart laid out in Go and drawn as inline SVG by Template.
+type Chart struct {
+	Label  string
+	Width  int
+	Height int
+	Bars   []Bar
+	Line   string // polyline points, if any
+	Texts  []Text
+}
+
+// Bar is a rectangle with a tooltip.
+type Bar struct {
+	X, Y, W, H float64
+	Class      string
+	Title      string
+}
+
+// Text is a label.
+type Text struct {
+	X, Y   float64
+	Anchor string
+	Text   string
+}
+
+const (
+	width  = 720
+	height = 120
+	bottom = 16 // room for axis labels
+)
+
+// Template defines the "chart" template, which draws a Chart. Append it to
+// a page template before parsing.
+const Template = `{{ define "chart" }}<svg class="chart" viewBox="0 0 {{ .Width }} {{ .Height }}" role="img" aria-label="{{ .Label }}">
+        {{ range .Bars }}<rect x="{{ printf "%.1f" .X }}" y="{{ printf "%.1f" .Y }}" width="{{ printf "%.1f" .W }}" height="{{ printf "%.1f" .H }}" class="{{ .Class }}"><title>{{ .Title }}</title></rect>{{ end }}
+        {{ if .Line }}<polyline points="{{ .Line }}" class="line"/>{{ end }}
+        {{ range .Texts }}<text x="{{ printf "%.1f" .X }}" y="{{ printf "%.1f" .Y }}" text-anchor="{{ .Anchor }}">{{ .Text }}</text>{{ end }}
+    </svg>{{ end }}`
+
+// CSS styles the charts drawn by Template.
+const CSS = `
+        .chart { width: 100%; height: auto; display: block; }
+        .chart .requests { fill: #7aa7d6; }
+        .chart .errors { fill: #b42323; }
+        .chart .latency { fill: #6c9a6c; }
+        .chart .line { fill: none; stroke: #b42323; stroke-width: 1.5; }
+        .chart text { font-size: 10px; fill: #555; }`
+
+// Step describes a bucket width in minutes, as in "one column per 5
+// minutes".
+func Step(minutes int) string {
+	switch {
+	case minutes <= 1:
+		return "minute"
+	case minutes == 60:
+		return "hour"
+	case minutes == 1440:
+		return "day"
+	case minutes%1440 == 0:
+		return fmt.Sprintf("%d days", minutes/1440)
+	case minutes%60 == 0:
+		return fmt.Sprintf("%d hours", minutes/60)
+	}
+	return fmt.Sprintf("%d minutes", minutes)
+}
+
+// bucketWidth returns the width of the buckets in minutes. Buckets from
+// before widths were recorded are one minute wide.
+func bucketWidth(buckets []monitor.MinuteBucket) int {
+	if len(buckets) == 0 || buckets[0].Minutes < 1 {
+		return 1
+	}
+	return buckets[0].Minutes
+}
+
+// bucketTime formats the start of a bucket in loc, with the date once
+// buckets are an hour or wider.
+func bucketTime(b monitor.MinuteBucket, loc *time.Location) string {
+	if b.Minutes >= 60 {
+		return b.Minute.In(loc).Format("Jan 2 15:04")
+	}
+	return b.Minute.In(loc).Format("15:04")
+}
+
+// minuteAxis labels the first and last bucket of a per-minute chart.
+func minuteAxis(buckets []monitor.MinuteBucket, loc *time.Location) []Text {
+	if len(buckets) == 0 {
+		return nil
+	}
+	y := float64(height - 3)
+	return []Text{
+		{X: 0, Y: y, Anchor: "start", Text: bucketTime(buckets[0], loc)},
+		{X: width, Y: y, Anchor: "end", Text: bucketTime(buckets[len(buckets)-1], loc)},
+	}
+}
+
+// Requests draws one bar per bucket with that bucket's errors stacked at
+// the bottom in red. Times are labelled in loc.
+func Requests(buckets []monitor.MinuteBucket, loc *time.Location) Chart {
+	c := Chart{Label: "Requests per minute", Width: width, Height: height, Texts: minuteAxis(buckets, loc)}
+	if len(buckets) == 0 {
+		return c
+	}
+
+	peak := 1
+	for _, b := range buckets {
+		if b.Requests > peak {
+			peak = b.Requests
+		}
+	}
+
+	plot := float64(height - bottom)
+	w := float64(width) / float64(len(buckets))
+	for i, b := range buckets {
+		if b.Requests == 0 {
+			continue
+		}
+		x := float64(i) * w
+		title := fmt.Sprintf("%s: %d requests, %d errors", bucketTime(b, loc), b.Requests, b.Errors)
+		h := plot * float64(b.Requests) / float64(peak)
+		c.Bars = append(c.Bars, Bar{X: x, Y: plot - h, W: w, H: h, Class: "requests", Title: title})
+		if b.Errors > 0 {
+			eh := plot * float64(b.Errors) / float64(peak)
+			c.Bars = append(c.Bars, Bar{X: x, Y: plot - eh, W: w, H: eh, Class: "errors", Title: title})
+		}
+	}
+	c.Texts = append(c.Texts, Text{X: width, Y: 10, Anchor: "end", Text: fmt.Sprintf("peak %d per %s", peak, Step(bucketWidth(buckets)))})
+	return c
+}
+
+// ErrorRate draws the percentage of failed requests per bucket as a line.
+// Buckets without requests are drawn at zero. Times are labelled in loc.
+func ErrorRate(buckets []monitor.MinuteBucket, loc *time.Location) Chart {
+	c := Chart{Label: "Error rate per minute", Width: width, Height: height, Texts: minuteAxis(buckets, loc)}
+	if len(buckets) == 0 {
+		return c
+	}
+
+	plot := float64(height - bottom)
+	w := float64(width) / float64(len(buckets))
+	points := make([]string, len(buckets))
+	for i, b := range buckets {
+		x := float64(i)*w + w/2
+		y := plot - plot*b.ErrorRate()/100
+		points[i] = fmt.Sprintf("%.1f,%.1f", x, y)
+	}
+	c.Line = strings.Join(points, " ")
+	c.Texts = append(c.Texts, Text{X: width, Y: 10, Anchor: "end", Text: "100%"})
+	return c
+}
+
+// Latency draws the response time histogram, one bar per bucket.
+func Latency(l monitor.Latency) Chart {
+	c := Chart{Label: "Response time histogram", Width: width, Height: height}
+	if len(l.Buckets) == 0 {
+		return c
+	}
+
+	most := 1
+	for _, b := range l.Buckets {
+		if b.Count > most {
+			most = b.Count
+		}
+	}
+
+	plot := float64(height - bottom)
+	w := float64(width) / float64(len(l.Buckets))
+	for i, b := range l.Buckets {
+		label := fmt.Sprintf("≤%dms", b.UpperMs)
+		switch {
+		case b.UpperMs == 0 && i == 0:
+			label = "any"
+		case b.UpperMs == 0:
+			label = fmt.Sprintf(">%dms", l.Buckets[i-1].UpperMs)
+		}
+		x := float64(i) * w
+		h := plot * float64(b.Count) / float64(most)
+		c.Bars = append(c.Bars, Bar{X: x + 2, Y: plot - h, W: w - 4, H: h, Class: "latency",
+			Title: fmt.Sprintf("%s: %d requests", label, b.Count)})
+		c.Texts = append(c.Texts, Text{X: x + w/2, Y: float64(height - 3), Anchor: "middle", Text: label})
+	}
+	return c
+}
+
+// sparkTicks are the eight heights of a sparkline, lowest first.
+var sparkTicks = []rune("▁▂▃▄▅▆▇█")
+
+// Sparkline draws values as a line of block characters, summing adjacent
+// values so that it fits in width. It returns how many values each
+// character covers.
+func Sparkline(values []int, width int) (string, int) {
+	per := 1
+	if width > 0 && len(values) > width {
+		per = (len(values) + width - 1) / width
+	}
+
+	var sums []int
+	peak := 0
+	for i := 0; i < len(values); i += per {
+		sum := 0
+		for j := i; j < i+per && j < len(values); j++ {
+			sum += values[j]
+		}
+		sums = append(sums, sum)
+		if sum > peak {
+			peak = sum
+		}
+	}
+
+	var b strings.Builder
+	for _, sum := range sums {
+		switch {
+		case sum == 0:
+			b.WriteRune(' ')
+		case peak == 0:
+			b.WriteRune(sparkTicks[0])
+		default:
+			b.WriteRune(sparkTicks[(sum*(len(sparkTicks)-1)+peak-1)/peak])
+		}
+	}
+	return b.String(), per
+}
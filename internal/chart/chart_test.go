@@ -0,0 +1,138 @@
+package chart
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/industrial-linguistics/happy-api/internal/monitor"
+)
+
+func TestSparkline(t *testing.T) {
+	tests := []struct {
+		name   string
+		values []int
+		width  int
+		want   string
+		per    int
+	}{
+		{"empty", nil, 10, "", 1},
+		{"all zero", []int{0, 0, 0}, 10, "   ", 1},
+		{"one value", []int{4}, 10, "█", 1},
+		// Heights round up, so any request shows
+		{"scaled to the peak", []int{1, 0, 8, 4}, 10, "▂ █▅", 1},
+		{"summed to fit", []int{1, 1, 0, 0, 4, 4}, 3, "▃ █", 2},
+		{"uneven last column", []int{2, 2, 2, 2, 2}, 2, "█▆", 3},
+		{"no width limit", []int{1, 2, 3}, 0, "▄▆█", 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, per := Sparkline(tt.values, tt.width)
+			if got != tt.want || per != tt.per {
+				t.Errorf("Sparkline(%v, %d) = %q, %d; want %q, %d", tt.values, tt.width, got, per, tt.want, tt.per)
+			}
+		})
+	}
+}
+
+func TestLatency(t *testing.T) {
+	tests := []struct {
+		name   string
+		l      monitor.Latency
+		labels []string
+	}{
+		{"empty", monitor.Latency{}, nil},
+		{"only the open bucket", monitor.Latency{Buckets: []monitor.LatencyBucket{{UpperMs: 0, Count: 3}}}, []string{"any"}},
+		{"bounded and open", monitor.Latency{Buckets: []monitor.LatencyBucket{
+			{UpperMs: 5, Count: 2}, {UpperMs: 10, Count: 0}, {UpperMs: 0, Count: 1},
+		}}, []string{"≤5ms", "≤10ms", ">10ms"}},
+		{"all zero", monitor.Latency{Buckets: []monitor.LatencyBucket{{UpperMs: 5}, {UpperMs: 0}}}, []string{"≤5ms", ">5ms"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := Latency(tt.l)
+			var labels []string
+			for _, text := range c.Texts {
+				labels = append(labels, text.Text)
+			}
+			if strings.Join(labels, " ") != strings.Join(tt.labels, " ") {
+				t.Errorf("labels %q, want %q", labels, tt.labels)
+			}
+			if len(c.Bars) != len(tt.l.Buckets) {
+				t.Errorf("%d bars for %d buckets", len(c.Bars), len(tt.l.Buckets))
+			}
+			for _, b := range c.Bars {
+				if b.H < 0 || b.Y+b.H > float64(height) {
+					t.Errorf("bar %+v is outside the chart", b)
+				}
+			}
+		})
+	}
+}
+
+func TestRequests(t *testing.T) {
+	start := time.Date(2025, 10, 14, 1, 0, 0, 0, time.UTC)
+	perth := time.FixedZone("AWST", 8*60*60)
+	tests := []struct {
+		name    string
+		buckets []monitor.MinuteBucket
+		bars    int
+		texts   []string
+	}{
+		{"empty", nil, 0, nil},
+		{"quiet", []monitor.MinuteBucket{{Minute: start, Minutes: 1}, {Minute: start.Add(time.Minute), Minutes: 1}},
+			0, []string{"09:00", "09:01", "peak 1 per minute"}},
+		{"errors stacked", []monitor.MinuteBucket{{Minute: start, Minutes: 1, Requests: 4, Errors: 1}, {Minute: start.Add(time.Minute), Minutes: 1, Requests: 2}},
+			3, []string{"09:00", "09:01", "peak 4 per minute"}},
+		{"hourly", []monitor.MinuteBucket{{Minute: start, Minutes: 60, Requests: 7}},
+			1, []string{"Oct 14 09:00", "Oct 14 09:00", "peak 7 per hour"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := Requests(tt.buckets, perth)
+			if len(c.Bars) != tt.bars {
+				t.Errorf("%d bars, want %d", len(c.Bars), tt.bars)
+			}
+			var texts []string
+			for _, text := range c.Texts {
+				texts = append(texts, text.Text)
+			}
+			if strings.Join(texts, "|") != strings.Join(tt.texts, "|") {
+				t.Errorf("texts %q, want %q", texts, tt.texts)
+			}
+		})
+	}
+}
+
+func TestErrorRate(t *testing.T) {
+	start := time.Date(2025, 10, 14, 1, 0, 0, 0, time.UTC)
+	if c := ErrorRate(nil, time.UTC); c.Line != "" || len(c.Texts) != 0 {
+		t.Errorf("empty chart = %+v, want no line or labels", c)
+	}
+
+	c := ErrorRate([]monitor.MinuteBucket{
+		{Minute: start, Minutes: 1},
+		{Minute: start.Add(time.Minute), Minutes: 1, Requests: 2, Errors: 2},
+	}, time.UTC)
+	// A quiet minute sits on the axis and a failing one at the top
+	want := "180.0,104.0 540.0,0.0"
+	if c.Line != want {
+		t.Errorf("line %q, want %q", c.Line, want)
+	}
+}
+
+func TestStep(t *testing.T) {
+	for minutes, want := range map[int]string{
+		0:    "minute",
+		1:    "minute",
+		5:    "5 minutes",
+		60:   "hour",
+		360:  "6 hours",
+		1440: "day",
+		4320: "3 days",
+	} {
+		if got := Step(minutes); got != want {
+			t.Errorf("Step(%d) = %q, want %q", minutes, got, want)
+		}
+	}
+}
@@ -0,0 +1,108 @@
+package dashboard
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/industrial-linguistics/happy-api/internal/monitor"
+)
+
+// feedLimit is how many of the latest requests the live page starts with,
+// and feedBatch how many it is sent per update when catching up.
+const (
+	feedLimit = 50
+	feedBatch = 200
+)
+
+// Activity is the request feed, oldest first. LastID is what to pass as
+// after to fetch the requests logged since.
+type Activity struct {
+	LastID   int64                   `json:"last_id"`
+	Requests []monitor.ActivityEntry `json:"requests"`
+}
+
+// LoadFeed returns the request feed that matches the filters: the latest
+// requests, or those logged since after when the live page is catching
+// up. LastID is the newest id looked at, matching or not.
+func LoadFeed(ctx context.Context, db *sql.DB, q Query) (Activity, error) {
+	var activity []monitor.ActivityEntry
+	var err error
+	if q.After >= 0 {
+		activity, err = monitor.ActivityAfter(ctx, db, q.After, feedBatch)
+	} else {
+		activity, err = monitor.RecentActivity(ctx, db, feedLimit)
+	}
+	if err != nil {
+		return Activity{}, fmt.Errorf("failed to load recent activity: %w", err)
+	}
+	var lastID int64
+	if q.After > 0 {
+		lastID = q.After
+	}
+	if n := len(activity); n > 0 {
+		lastID = activity[n-1].ID
+	}
+	feed := activity[:0]
+	for _, e := range activity {
+		if q.Matches(e) {
+			feed = append(feed, e)
+		}
+	}
+	return Activity{lastID, feed}, nil
+}
+
+// Update is what the live page redraws on each poll, with the same field
+// names as the full dashboard JSON. The charts, tables and roster stay as
+// the page was loaded.
+type Update struct {
+	GeneratedAt time.Time  `json:"generated_at"`
+	Live        UpdateLive `json:"live"`
+	Summary     Counts     `json:"summary"`
+	Activity    Activity   `json:"activity"`
+}
+
+// UpdateLive is the students active in the last hour.
+type UpdateLive struct {
+	Users []monitor.LiveUser `json:"users"`
+}
+
+// Counts is the summary counters, without the per-endpoint breakdown.
+type Counts struct {
+	TotalRequests int     `json:"total_requests"`
+	Students      int     `json:"active_students"`
+	ErrorCount    int     `json:"error_count"`
+	ErrorRate     float64 `json:"error_rate"`
+}
+
+// LoadUpdate loads the requests logged since after, the live users and
+// the summary counters.
+func LoadUpdate(ctx context.Context, db *sql.DB, q Query) (Update, error) {
+	users, err := monitor.LiveUsers(ctx, db, q.Window(time.Hour))
+	if err != nil {
+		return Update{}, fmt.Errorf("failed to load live users: %w", err)
+	}
+
+	counts, err := monitor.LoadCounts(ctx, db, q.Window(2*time.Hour))
+	if err != nil {
+		return Update{}, fmt.Errorf("failed to load summary: %w", err)
+	}
+
+	feed, err := LoadFeed(ctx, db, q)
+	if err != nil {
+		return Update{}, err
+	}
+
+	return Update{
+		GeneratedAt: time.Now(),
+		Live:        UpdateLive{users},
+		Summary: Counts{
+			TotalRequests: counts.TotalRequests,
+			Students:      counts.Students,
+			ErrorCount:    counts.ErrorCount,
+			ErrorRate:     counts.ErrorRate,
+		},
+		Activity: feed,
+	}, nil
+}
@@ -0,0 +1,162 @@
+package dashboard
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	_ "github.com/mattn/go-sqlite3"
+)
+
+// openFixture returns an in-memory activity_log on a single connection
+// holding n requests a second apart, ending a minute ago. Every third
+// request is in session s2 and fails; the rest are in s1.
+func openFixture(t *testing.T, n int) *sql.DB {
+	t.Helper()
+
+	db, err := sql.Open("sqlite3", ":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	db.SetMaxOpenConns(1)
+	t.Cleanup(func() { db.Close() })
+
+	if _, err := db.Exec(`
+        CREATE TABLE activity_log (
+            id INTEGER PRIMARY KEY AUTOINCREMENT,
+            timestamp DATETIME DEFAULT CURRENT_TIMESTAMP,
+            endpoint TEXT NOT NULL,
+            name TEXT,
+            session_id TEXT,
+            ip_address TEXT,
+            user_agent TEXT,
+            response_code INTEGER,
+            response_time_ms INTEGER
+        )
+    `); err != nil {
+		t.Fatal(err)
+	}
+
+	start := time.Now().UTC().Add(-time.Minute - time.Duration(n)*time.Second)
+	for i := 1; i <= n; i++ {
+		session, code := "s1", 200
+		if i%3 == 0 {
+			session, code = "s2", 400
+		}
+		_, err := db.Exec(`
+            INSERT INTO activity_log (timestamp, endpoint, name, session_id, response_code, response_time_ms)
+            VALUES (?, '/automessage', 'Ann', ?, ?, 5)
+        `, start.Add(time.Duration(i)*time.Second).Format("2006-01-02 15:04:05"), session, code)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	return db
+}
+
+func feedIDs(a Activity) (first, last int64) {
+	if len(a.Requests) == 0 {
+		return 0, 0
+	}
+	return a.Requests[0].ID, a.Requests[len(a.Requests)-1].ID
+}
+
+func TestLoadFeed(t *testing.T) {
+	db := openFixture(t, 60)
+	ctx := context.Background()
+
+	tests := []struct {
+		query       string
+		count       int
+		first, last int64
+		lastID      int64
+	}{
+		// Without after the page starts with the latest requests
+		{"", feedLimit, 11, 60, 60},
+		{"after=55", 5, 56, 60, 60},
+		{"after=0", 60, 1, 60, 60},
+		// Nothing new keeps the caller's place
+		{"after=60", 0, 0, 0, 60},
+		{"after=99", 0, 0, 0, 99},
+		// Requests outside the filters are skipped but still looked at
+		{"after=55&session=s2", 2, 57, 60, 60},
+		{"after=57&session=s1", 2, 58, 59, 60},
+		{"after=59&session=s1", 0, 0, 0, 60},
+	}
+	for _, tt := range tests {
+		q, err := ParseQuery("", tt.query, time.Now())
+		if err != nil {
+			t.Fatal(err)
+		}
+		feed, err := LoadFeed(ctx, db, q)
+		if err != nil {
+			t.Fatal(err)
+		}
+		first, last := feedIDs(feed)
+		if len(feed.Requests) != tt.count || first != tt.first || last != tt.last || feed.LastID != tt.lastID {
+			t.Errorf("%q: %d requests, ids %d-%d, last id %d; want %d, ids %d-%d, last id %d",
+				tt.query, len(feed.Requests), first, last, feed.LastID, tt.count, tt.first, tt.last, tt.lastID)
+		}
+		if feed.Requests == nil {
+			t.Errorf("%q: requests are nil, which is sent as null", tt.query)
+		}
+	}
+}
+
+func TestLoadFeedCatchesUpInBatches(t *testing.T) {
+	db := openFixture(t, feedBatch+10)
+
+	feed, err := LoadFeed(context.Background(), db, Query{After: 0})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(feed.Requests) != feedBatch || feed.LastID != feedBatch {
+		t.Fatalf("first batch has %d requests up to %d, want %d", len(feed.Requests), feed.LastID, feedBatch)
+	}
+	feed, err = LoadFeed(context.Background(), db, Query{After: feed.LastID})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if first, _ := feedIDs(feed); len(feed.Requests) != 10 || first != feedBatch+1 || feed.LastID != feedBatch+10 {
+		t.Errorf("second batch has %d requests from %d up to %d", len(feed.Requests), first, feed.LastID)
+	}
+}
+
+func TestLoadUpdate(t *testing.T) {
+	db := openFixture(t, 30)
+
+	q, err := ParseQuery("", "after=28", time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	update, err := LoadUpdate(context.Background(), db, q)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if first, last := feedIDs(update.Activity); first != 29 || last != 30 || update.Activity.LastID != 30 {
+		t.Errorf("activity covers ids %d-%d up to %d, want 29-30", first, last, update.Activity.LastID)
+	}
+	if c := update.Summary; c.TotalRequests != 30 || c.Students != 1 || c.ErrorCount != 10 {
+		t.Errorf("counts = %+v, want 30 requests by 1 student with 10 errors", c)
+	}
+	if len(update.Live.Users) != 1 || update.Live.Users[0].TotalCount != 30 {
+		t.Errorf("live users = %+v, want Ann with 30 requests", update.Live.Users)
+	}
+
+	// A poll with nothing new sends an empty feed, not null
+	q.After = 30
+	update, err = LoadUpdate(context.Background(), db, q)
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, err := json.Marshal(update)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(body), `"activity":{"last_id":30,"requests":[]}`) {
+		t.Errorf("empty poll = %s", body)
+	}
+}
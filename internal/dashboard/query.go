@@ -0,0 +1,244 @@
+// Package dashboard holds the filters the happywatch CGI dashboard takes in
+// its query string, and the queries its live page polls.
+package dashboard
+
+import (
+	"fmt"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/industrial-linguistics/happy-api/internal/monitor"
+)
+
+// DefaultRefresh is how often the live page asks for updates, unless
+// refresh says otherwise.
+const DefaultRefresh = 5 * time.Second
+
+// MaxWindow is the longest since-until window the dashboard will query.
+// Longer windows are better served by happywatch report.
+const MaxWindow = 7 * 24 * time.Hour
+
+// DefaultInactiveAfter is how long a student must be quiet to be listed as
+// inactive, unless inactive_after says otherwise.
+const DefaultInactiveAfter = 15 * time.Minute
+
+// Query is the filters given in QUERY_STRING. They apply to every section
+// of the page.
+type Query struct {
+	Base          string // SCRIPT_NAME, for links back to the dashboard
+	Session       string
+	Since         time.Time
+	Until         time.Time
+	Student       string
+	InactiveAfter time.Duration
+	TZ            string         // time zone to show times in, empty for the server's
+	Loc           *time.Location // the zone TZ names, or the server's
+	Live          bool           // update the page in place
+	Refresh       time.Duration  // how often the live page updates
+	After         int64          // last activity id the caller has, or -1
+}
+
+// ParseQuery reads the filters in raw, resolving relative times against
+// now. base is kept for links back to the dashboard.
+func ParseQuery(base, raw string, now time.Time) (Query, error) {
+	values, err := url.ParseQuery(raw)
+	if err != nil {
+		return Query{}, fmt.Errorf("invalid query string: %w", err)
+	}
+
+	q := Query{
+		Base:          base,
+		Session:       values.Get("session"),
+		Student:       values.Get("student"),
+		InactiveAfter: DefaultInactiveAfter,
+		Live:          values.Get("live") != "" && values.Get("live") != "0",
+		Refresh:       DefaultRefresh,
+		After:         -1,
+		Loc:           time.Local,
+	}
+	// Dates in since and until are in the display zone
+	if q.TZ = values.Get("tz"); q.TZ != "" {
+		loc, err := time.LoadLocation(q.TZ)
+		if err != nil {
+			return Query{}, fmt.Errorf("invalid tz %q: expected a zone such as Australia/Perth", q.TZ)
+		}
+		q.Loc = loc
+	}
+	for _, p := range []struct {
+		name string
+		t    *time.Time
+	}{{"since", &q.Since}, {"until", &q.Until}} {
+		v := values.Get(p.name)
+		if v == "" {
+			continue
+		}
+		t, err := monitor.ParseTime(v, now, q.Loc)
+		if err != nil {
+			return Query{}, fmt.Errorf("invalid %s: %v", p.name, err)
+		}
+		*p.t = t
+	}
+	if !q.Since.IsZero() && !q.Until.IsZero() && !q.Until.After(q.Since) {
+		return Query{}, fmt.Errorf("until must be after since")
+	}
+	if !q.Since.IsZero() {
+		end := now
+		if !q.Until.IsZero() {
+			end = q.Until
+		}
+		if end.Sub(q.Since) > MaxWindow {
+			return Query{}, fmt.Errorf("since to until covers more than 7 days; use happywatch report for longer windows")
+		}
+	}
+	if v := values.Get("inactive_after"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil || d <= 0 {
+			return Query{}, fmt.Errorf("invalid inactive_after %q: expected a duration such as 30m", v)
+		}
+		q.InactiveAfter = d
+	}
+	if v := values.Get("refresh"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil || d < time.Second {
+			return Query{}, fmt.Errorf("invalid refresh %q: expected a duration of at least 1s", v)
+		}
+		q.Refresh = d
+	}
+	if q.Live && !q.Until.IsZero() {
+		return Query{}, fmt.Errorf("live updates need a window that runs up to now; remove until")
+	}
+	if v := values.Get("after"); v != "" {
+		id, err := strconv.ParseInt(v, 10, 64)
+		if err != nil || id < 0 {
+			return Query{}, fmt.Errorf("invalid after %q: expected an activity id", v)
+		}
+		q.After = id
+	}
+	return q, nil
+}
+
+// End is the end of the window being looked at.
+func (q Query) End() time.Time {
+	if !q.Until.IsZero() {
+		return q.Until
+	}
+	return time.Now()
+}
+
+// Window returns the range for a section that covers the last d unless
+// since is given.
+func (q Query) Window(d time.Duration) monitor.Range {
+	r := monitor.Range{Since: q.Since, Until: q.Until, Session: q.Session}
+	if r.Since.IsZero() {
+		r.Since = q.End().Add(-d)
+	}
+	return r
+}
+
+// WindowLabel describes the range Window(d) covers, e.g. "last 2 hours".
+func (q Query) WindowLabel(d time.Duration) string {
+	switch {
+	case !q.Since.IsZero() && !q.Until.IsZero():
+		return q.Timestamp(q.Since) + " to " + q.Timestamp(q.Until)
+	case !q.Since.IsZero():
+		return "since " + q.Timestamp(q.Since)
+	case !q.Until.IsZero():
+		return DescribeDuration(d) + " before " + q.Timestamp(q.Until)
+	case d == time.Hour:
+		return "last hour"
+	}
+	return "last " + DescribeDuration(d)
+}
+
+// Filtered reports whether any filter other than the student is set.
+func (q Query) Filtered() bool {
+	return q.Session != "" || !q.Since.IsZero() || !q.Until.IsZero() || q.InactiveAfter != DefaultInactiveAfter || q.TZ != ""
+}
+
+// Link returns a URL for the dashboard with the same filters, showing
+// student's page when student is not empty.
+func (q Query) Link(student string) string {
+	values := url.Values{}
+	if q.Session != "" {
+		values.Set("session", q.Session)
+	}
+	if !q.Since.IsZero() {
+		values.Set("since", q.Since.Format(time.RFC3339))
+	}
+	if !q.Until.IsZero() {
+		values.Set("until", q.Until.Format(time.RFC3339))
+	}
+	if q.InactiveAfter != DefaultInactiveAfter {
+		values.Set("inactive_after", q.InactiveAfter.String())
+	}
+	if q.TZ != "" {
+		values.Set("tz", q.TZ)
+	}
+	if q.Live {
+		values.Set("live", "1")
+		if q.Refresh != DefaultRefresh {
+			values.Set("refresh", q.Refresh.String())
+		}
+	}
+	if student != "" {
+		values.Set("student", student)
+	}
+	if len(values) == 0 {
+		return q.Base
+	}
+	return q.Base + "?" + values.Encode()
+}
+
+// Matches reports whether a request falls inside the session and times
+// filters.
+func (q Query) Matches(e monitor.ActivityEntry) bool {
+	return (q.Session == "" || e.SessionID == q.Session) &&
+		(q.Since.IsZero() || !e.Timestamp.Before(q.Since)) &&
+		(q.Until.IsZero() || e.Timestamp.Before(q.Until))
+}
+
+// Time writes t as hours and minutes in the display zone.
+func (q Query) Time(t time.Time) string {
+	if t.IsZero() {
+		return "-"
+	}
+	return t.In(q.Loc).Format("15:04")
+}
+
+// Zone names the zone times are shown in.
+func (q Query) Zone() string {
+	if name := q.Loc.String(); name != "Local" {
+		return name
+	}
+	name, _ := time.Now().In(q.Loc).Zone()
+	return name
+}
+
+// Clock writes t to the second in the display zone.
+func (q Query) Clock(t time.Time) string {
+	return t.In(q.Loc).Format("15:04:05")
+}
+
+// Timestamp writes t in full in the display zone.
+func (q Query) Timestamp(t time.Time) string {
+	if t.IsZero() {
+		return "-"
+	}
+	return t.In(q.Loc).Format(time.RFC3339)
+}
+
+// DescribeDuration writes d in words, e.g. "1 hour" or "15 minutes".
+func DescribeDuration(d time.Duration) string {
+	switch {
+	case d == time.Hour:
+		return "1 hour"
+	case d == time.Minute:
+		return "1 minute"
+	case d%time.Hour == 0:
+		return fmt.Sprintf("%d hours", int(d.Hours()))
+	case d%time.Minute == 0:
+		return fmt.Sprintf("%d minutes", int(d.Minutes()))
+	}
+	return d.String()
+}
@@ -0,0 +1,151 @@
+package dashboard
+
+import (
+	"strings"
+	"testing"
+	"time"
+	_ "time/tzdata"
+)
+
+var queryNow = time.Date(2025, 10, 14, 4, 0, 0, 0, time.UTC)
+
+func TestParseQueryDefaults(t *testing.T) {
+	q, err := ParseQuery("/happywatch.cgi", "", queryNow)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if q.InactiveAfter != DefaultInactiveAfter || q.Refresh != DefaultRefresh || q.After != -1 {
+		t.Errorf("defaults = %+v", q)
+	}
+	if q.Loc != time.Local || q.Filtered() || q.Live {
+		t.Errorf("empty query is filtered or live: %+v", q)
+	}
+	if link := q.Link(""); link != "/happywatch.cgi" {
+		t.Errorf("Link = %q, want the bare script", link)
+	}
+}
+
+func TestParseQuery(t *testing.T) {
+	q, err := ParseQuery("/happywatch.cgi",
+		"session=s1&student=Ann&since=2025-10-14+09:00&until=2025-10-14+11:30&tz=Australia/Perth&inactive_after=30m&after=42",
+		queryNow)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if q.Session != "s1" || q.Student != "Ann" || q.InactiveAfter != 30*time.Minute || q.After != 42 {
+		t.Errorf("filters = %+v", q)
+	}
+	if q.Zone() != "Australia/Perth" {
+		t.Errorf("location = %v, want Australia/Perth", q.Loc)
+	}
+	// Dates without a zone are read in tz
+	if want := time.Date(2025, 10, 14, 1, 0, 0, 0, time.UTC); !q.Since.Equal(want) {
+		t.Errorf("since = %v, want %v", q.Since, want)
+	}
+	if want := time.Date(2025, 10, 14, 3, 30, 0, 0, time.UTC); !q.Until.Equal(want) {
+		t.Errorf("until = %v, want %v", q.Until, want)
+	}
+	if got := q.Clock(q.Until); got != "11:30:00" {
+		t.Errorf("Clock = %q, want Perth time", got)
+	}
+	if got, want := q.WindowLabel(time.Hour), "2025-10-14T09:00:00+08:00 to 2025-10-14T11:30:00+08:00"; got != want {
+		t.Errorf("WindowLabel = %q, want %q", got, want)
+	}
+	if !q.Filtered() {
+		t.Error("Filtered = false")
+	}
+
+	// Links keep the filters but not the poll position
+	again, err := ParseQuery(q.Base, strings.SplitN(q.Link("Bob"), "?", 2)[1], queryNow)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if again.Student != "Bob" || !again.Since.Equal(q.Since) || !again.Until.Equal(q.Until) ||
+		again.TZ != q.TZ || again.InactiveAfter != q.InactiveAfter || again.After != -1 {
+		t.Errorf("Link round trip = %+v", again)
+	}
+}
+
+func TestParseQueryRelative(t *testing.T) {
+	q, err := ParseQuery("", "since=2h&live=1&refresh=10s", queryNow)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := queryNow.Add(-2 * time.Hour); !q.Since.Equal(want) {
+		t.Errorf("since = %v, want %v", q.Since, want)
+	}
+	if !q.Live || q.Refresh != 10*time.Second {
+		t.Errorf("live = %v every %v, want every 10s", q.Live, q.Refresh)
+	}
+	if r := q.Window(time.Hour); !r.Since.Equal(q.Since) || !r.Until.IsZero() {
+		t.Errorf("Window = %+v, want since onwards", r)
+	}
+}
+
+func TestParseQueryWindowCap(t *testing.T) {
+	tests := []struct {
+		query string
+		ok    bool
+	}{
+		{"since=2025-10-07T04:00:00Z", true},
+		{"since=2025-10-07T03:59:00Z", false},
+		{"since=168h", true},
+		{"since=169h", false},
+		{"since=2025-09-01&until=2025-09-08", true},
+		{"since=2025-09-01&until=2025-09-08+00:01", false},
+		// Until alone is not a window
+		{"until=2025-01-01", true},
+	}
+	for _, tt := range tests {
+		_, err := ParseQuery("", tt.query+"&tz=UTC", queryNow)
+		if (err == nil) != tt.ok {
+			t.Errorf("ParseQuery(%q) error = %v, want ok %v", tt.query, err, tt.ok)
+		}
+		if err != nil && !strings.Contains(err.Error(), "more than 7 days") {
+			t.Errorf("ParseQuery(%q) error = %v, want the 7 day limit", tt.query, err)
+		}
+	}
+}
+
+func TestParseQueryErrors(t *testing.T) {
+	tests := []struct {
+		query string
+		want  string
+	}{
+		{"session=%zz", "invalid query string"},
+		{"tz=Mars/Olympus_Mons", `invalid tz "Mars/Olympus_Mons"`},
+		{"since=yesterday", "invalid since"},
+		{"until=-2h", "invalid until"},
+		{"since=1h&until=2h", "until must be after since"},
+		{"inactive_after=soon", `invalid inactive_after "soon"`},
+		{"inactive_after=0s", `invalid inactive_after "0s"`},
+		{"refresh=500ms", `invalid refresh "500ms"`},
+		{"live=1&until=1h", "remove until"},
+		{"after=-1", `invalid after "-1"`},
+		{"after=abc", `invalid after "abc"`},
+	}
+	for _, tt := range tests {
+		_, err := ParseQuery("", tt.query, queryNow)
+		if err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("ParseQuery(%q) error = %v, want %q", tt.query, err, tt.want)
+		}
+	}
+}
+
+func TestDescribeDuration(t *testing.T) {
+	tests := []struct {
+		d    time.Duration
+		want string
+	}{
+		{time.Hour, "1 hour"},
+		{time.Minute, "1 minute"},
+		{4 * time.Hour, "4 hours"},
+		{90 * time.Minute, "90 minutes"},
+		{90 * time.Second, "1m30s"},
+	}
+	for _, tt := range tests {
+		if got := DescribeDuration(tt.d); got != tt.want {
+			t.Errorf("DescribeDuration(%v) = %q, want %q", tt.d, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,17 @@
+package health
+
+import "syscall"
+
+// FreeBytes returns the space available to unprivileged users on the
+// filesystem holding path.
+func FreeBytes(path string) (uint64, error) {
+	var st syscall.Statfs_t
+	if err := syscall.Statfs(path, &st); err != nil {
+		return 0, err
+	}
+	// Negative when root has eaten into the reserved blocks
+	if st.F_bavail < 0 {
+		return 0, nil
+	}
+	return uint64(st.F_bavail) * uint64(st.F_bsize), nil
+}
@@ -0,0 +1,10 @@
+//go:build !linux && !darwin && !freebsd && !openbsd
+
+package health
+
+import "errors"
+
+// FreeBytes is not implemented here; the disk check passes without it.
+func FreeBytes(path string) (uint64, error) {
+	return 0, errors.ErrUnsupported
+}
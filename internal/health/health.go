@@ -0,0 +1,131 @@
+// Package health runs the readiness checks behind /v1/status: whether the
+// database answers, has the current schema and a message catalog, and has
+// room left on its disk.
+package health
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+)
+
+// SchemaVersion is the PRAGMA user_version init-db writes. Bump it with
+// every change to init-db's schema, so that a server still running the old
+// schema fails its schema check until init-db is run again.
+const SchemaVersion = 4
+
+// DefaultMinFreeBytes is how much free space the data directory needs
+// before the disk check fails. SQLite needs room for its journal as well
+// as for new rows.
+const DefaultMinFreeBytes = 100 << 20
+
+// Check is the outcome of one readiness check.
+type Check struct {
+	Name string `json:"name"`
+	OK   bool   `json:"ok"`
+	// Detail is what was found, or why the check failed.
+	Detail string `json:"detail"`
+}
+
+// Options says where the data lives and how much room it needs.
+type Options struct {
+	DataDir      string
+	MinFreeBytes uint64
+}
+
+// Run performs every check. Checks after a failing one still run, so the
+// report shows everything that is wrong at once.
+func Run(ctx context.Context, db *sql.DB, opts Options) []Check {
+	return []Check{
+		checkDatabase(ctx, db),
+		checkSchema(ctx, db),
+		checkMessages(ctx, db),
+		checkDisk(opts),
+	}
+}
+
+// Healthy reports whether every check passed.
+func Healthy(checks []Check) bool {
+	for _, c := range checks {
+		if !c.OK {
+			return false
+		}
+	}
+	return true
+}
+
+func checkDatabase(ctx context.Context, db *sql.DB) Check {
+	c := Check{Name: "database"}
+	var tables int
+	if err := db.QueryRowContext(ctx, `SELECT COUNT(*) FROM sqlite_master WHERE type = 'table'`).Scan(&tables); err != nil {
+		c.Detail = err.Error()
+		return c
+	}
+	c.OK, c.Detail = true, fmt.Sprintf("%d tables", tables)
+	return c
+}
+
+func checkSchema(ctx context.Context, db *sql.DB) Check {
+	c := Check{Name: "schema"}
+	var version int
+	if err := db.QueryRowContext(ctx, `PRAGMA user_version`).Scan(&version); err != nil {
+		c.Detail = err.Error()
+		return c
+	}
+	if version != SchemaVersion {
+		c.Detail = fmt.Sprintf("version %d, want %d: run init-db", version, SchemaVersion)
+		return c
+	}
+	c.OK, c.Detail = true, fmt.Sprintf("version %d", version)
+	return c
+}
+
+func checkMessages(ctx context.Context, db *sql.DB) Check {
+	c := Check{Name: "messages"}
+	var count int
+	if err := db.QueryRowContext(ctx, `SELECT COUNT(*) FROM messages`).Scan(&count); err != nil {
+		c.Detail = err.Error()
+		return c
+	}
+	if count == 0 {
+		c.Detail = "the message catalog is empty: run init-db"
+		return c
+	}
+	c.OK, c.Detail = true, fmt.Sprintf("%d messages", count)
+	return c
+}
+
+func checkDisk(opts Options) Check {
+	c := Check{Name: "disk"}
+	free, err := FreeBytes(opts.DataDir)
+	if errors.Is(err, errors.ErrUnsupported) {
+		c.OK, c.Detail = true, "free space unknown on this platform"
+		return c
+	}
+	if err != nil {
+		c.Detail = err.Error()
+		return c
+	}
+	c.Detail = formatBytes(free) + " free in " + opts.DataDir
+	c.OK = free >= opts.MinFreeBytes
+	if !c.OK {
+		c.Detail += ", want at least " + formatBytes(opts.MinFreeBytes)
+	}
+	return c
+}
+
+// formatBytes writes n in the largest binary unit that keeps it above one,
+// e.g. "1.5 GiB".
+func formatBytes(n uint64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+	div, exp := uint64(unit), 0
+	for m := n / unit; m >= unit && exp < 5; m /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", float64(n)/float64(div), "KMGTPE"[exp])
+}
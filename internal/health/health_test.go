@@ -0,0 +1,111 @@
+package health
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+	"testing"
+
+	_ "github.com/mattn/go-sqlite3"
+)
+
+// openFixture returns an in-memory database with the message catalog and
+// the current schema version.
+func openFixture(t *testing.T) *sql.DB {
+	t.Helper()
+
+	db, err := sql.Open("sqlite3", ":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	db.SetMaxOpenConns(1)
+	t.Cleanup(func() { db.Close() })
+
+	_, err = db.Exec(fmt.Sprintf(`
+        CREATE TABLE messages (id INTEGER PRIMARY KEY, message TEXT NOT NULL, category TEXT);
+        INSERT INTO messages (message) VALUES ('Keep going!'), ('Nice work!');
+        PRAGMA user_version = %d;
+    `, SchemaVersion))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return db
+}
+
+// failing returns the names of the checks that failed.
+func failing(checks []Check) []string {
+	var names []string
+	for _, c := range checks {
+		if !c.OK {
+			names = append(names, c.Name)
+		}
+	}
+	return names
+}
+
+func TestRun(t *testing.T) {
+	ctx := context.Background()
+	opts := Options{DataDir: t.TempDir(), MinFreeBytes: 1}
+
+	db := openFixture(t)
+	checks := Run(ctx, db, opts)
+	if !Healthy(checks) {
+		t.Fatalf("fixture failed %v: %+v", failing(checks), checks)
+	}
+	if checks[2].Detail != "2 messages" {
+		t.Errorf("messages detail = %q", checks[2].Detail)
+	}
+
+	tests := []struct {
+		name  string
+		setup string
+		opts  Options
+		want  string
+	}{
+		{"old schema", `PRAGMA user_version = 0`, opts, "schema"},
+		{"empty catalog", `DELETE FROM messages`, opts, "messages"},
+		{"no catalog", `DROP TABLE messages`, opts, "messages"},
+		{"disk full", ``, Options{DataDir: opts.DataDir, MinFreeBytes: ^uint64(0)}, "disk"},
+		{"missing data directory", ``, Options{DataDir: opts.DataDir + "/missing"}, "disk"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db := openFixture(t)
+			if tt.setup != "" {
+				if _, err := db.Exec(tt.setup); err != nil {
+					t.Fatal(err)
+				}
+			}
+			checks := Run(ctx, db, tt.opts)
+			if got := strings.Join(failing(checks), ","); got != tt.want {
+				t.Errorf("failing checks = %q, want %q: %+v", got, tt.want, checks)
+			}
+			if Healthy(checks) {
+				t.Errorf("Healthy = true")
+			}
+		})
+	}
+
+	// Every check still reports when the database is gone
+	db.Close()
+	checks = Run(ctx, db, opts)
+	if got := strings.Join(failing(checks), ","); got != "database,schema,messages" {
+		t.Errorf("closed database failed %q", got)
+	}
+}
+
+func TestFormatBytes(t *testing.T) {
+	for n, want := range map[uint64]string{
+		0:              "0 B",
+		1023:           "1023 B",
+		1024:           "1.0 KiB",
+		100 << 20:      "100.0 MiB",
+		3 << 29:        "1.5 GiB",
+		^uint64(0) / 2: "8.0 EiB",
+	} {
+		if got := formatBytes(n); got != want {
+			t.Errorf("formatBytes(%d) = %q, want %q", n, got, want)
+		}
+	}
+}
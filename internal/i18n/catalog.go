@@ -0,0 +1,81 @@
+package i18n
+
+import (
+	"bufio"
+	"embed"
+	"fmt"
+	"io"
+	"path"
+	"sort"
+	"strings"
+)
+
+// maxMessageLen matches what the API accepts in a sent message.
+const maxMessageLen = 500
+
+//go:embed catalogs/*.txt
+var catalogFiles embed.FS
+
+// Catalog is the encouraging messages for one locale.
+type Catalog struct {
+	Locale   string
+	Messages []string
+}
+
+// BuiltIn returns the catalogs in the catalogs directory, named by
+// locale, with Default first and the rest in order of locale.
+func BuiltIn() ([]Catalog, error) {
+	files, err := catalogFiles.ReadDir("catalogs")
+	if err != nil {
+		return nil, err
+	}
+
+	var catalogs []Catalog
+	for _, f := range files {
+		file, err := catalogFiles.Open(path.Join("catalogs", f.Name()))
+		if err != nil {
+			return nil, err
+		}
+		messages, err := ParseCatalog(file)
+		file.Close()
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", f.Name(), err)
+		}
+		catalogs = append(catalogs, Catalog{
+			Locale:   strings.TrimSuffix(f.Name(), ".txt"),
+			Messages: messages,
+		})
+	}
+
+	sort.SliceStable(catalogs, func(i, j int) bool {
+		if catalogs[i].Locale == Default || catalogs[j].Locale == Default {
+			return catalogs[i].Locale == Default
+		}
+		return catalogs[i].Locale < catalogs[j].Locale
+	})
+	return catalogs, nil
+}
+
+// ParseCatalog reads a catalog file: UTF-8 text with one message a line.
+// Blank lines and lines starting with # are skipped.
+func ParseCatalog(r io.Reader) ([]string, error) {
+	var messages []string
+	scanner := bufio.NewScanner(r)
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		if len(line) > maxMessageLen {
+			return nil, fmt.Errorf("line %d: message longer than %d bytes", n, maxMessageLen)
+		}
+		messages = append(messages, line)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if len(messages) == 0 {
+		return nil, fmt.Errorf("no messages")
+	}
+	return messages, nil
+}
@@ -0,0 +1,79 @@
+package i18n
+
+import "sort"
+
+// errorTranslations are the API's error messages in each locale but
+// Default, keyed by the English message. activity_log and the metrics
+// keep the English, so that they read the same whatever the student asked
+// for.
+var errorTranslations = map[string]map[string]string{
+	"de": {
+		"Invalid query string":                   "Ungültiger Query-String",
+		"name parameter required":                "Parameter name ist erforderlich",
+		"name too long":                          "name ist zu lang",
+		"Rate limit exceeded":                    "Zu viele Anfragen, bitte kurz warten",
+		"Internal server error":                  "Interner Serverfehler",
+		"Invalid JSON":                           "Ungültiges JSON",
+		"from, to, and message are required":     "from, to und message sind erforderlich",
+		"message too long":                       "message ist zu lang",
+		"message must be positive":               "Die Nachricht muss positiv sein",
+		"recipient parameter required":           "Parameter recipient ist erforderlich",
+		"recipient name too long":                "recipient ist zu lang",
+		"probe must be live or ready":            "probe muss live oder ready sein",
+		"Endpoint not found":                     "Endpunkt nicht gefunden",
+		"format must be json, text, html or xml": "format muss json, text, html oder xml sein",
+	},
+	"es": {
+		"Invalid query string":                   "Cadena de consulta no válida",
+		"name parameter required":                "El parámetro name es obligatorio",
+		"name too long":                          "name es demasiado largo",
+		"Rate limit exceeded":                    "Demasiadas solicitudes, espera un momento",
+		"Internal server error":                  "Error interno del servidor",
+		"Invalid JSON":                           "JSON no válido",
+		"from, to, and message are required":     "from, to y message son obligatorios",
+		"message too long":                       "message es demasiado largo",
+		"message must be positive":               "El mensaje debe ser positivo",
+		"recipient parameter required":           "El parámetro recipient es obligatorio",
+		"recipient name too long":                "recipient es demasiado largo",
+		"probe must be live or ready":            "probe debe ser live o ready",
+		"Endpoint not found":                     "Endpoint no encontrado",
+		"format must be json, text, html or xml": "format debe ser json, text, html o xml",
+	},
+	"fr": {
+		"Invalid query string":                   "Chaîne de requête invalide",
+		"name parameter required":                "Le paramètre name est obligatoire",
+		"name too long":                          "name est trop long",
+		"Rate limit exceeded":                    "Trop de requêtes, patientez un instant",
+		"Internal server error":                  "Erreur interne du serveur",
+		"Invalid JSON":                           "JSON invalide",
+		"from, to, and message are required":     "from, to et message sont obligatoires",
+		"message too long":                       "message est trop long",
+		"message must be positive":               "Le message doit être positif",
+		"recipient parameter required":           "Le paramètre recipient est obligatoire",
+		"recipient name too long":                "recipient est trop long",
+		"probe must be live or ready":            "probe doit valoir live ou ready",
+		"Endpoint not found":                     "Point d'accès introuvable",
+		"format must be json, text, html or xml": "format doit valoir json, text, html ou xml",
+	},
+}
+
+// errorLocales are the locales errors can be sent in.
+var errorLocales = func() []string {
+	locales := []string{Default}
+	for locale := range errorTranslations {
+		locales = append(locales, locale)
+	}
+	sort.Strings(locales[1:])
+	return locales
+}()
+
+// Error translates the English error message for a request preferring
+// prefs, returning it with its locale. Messages without a translation are
+// sent in English.
+func Error(prefs []string, message string) (string, string) {
+	locale := Match(prefs, errorLocales)
+	if translated, ok := errorTranslations[locale][message]; ok {
+		return translated, locale
+	}
+	return message, Default
+}
@@ -0,0 +1,29 @@
+package i18n
+
+import "strings"
+
+// negativeWords reject obvious negativity in sent messages, by locale.
+// They match anywhere in the message, so each is chosen not to hide
+// inside friendly words in any of the locales; those shared with English
+// are left to it.
+var negativeWords = map[string][]string{
+	"en": {"hate", "stupid", "idiot", "bad", "terrible", "awful", "suck", "dumb"},
+	"de": {"hasse", "dummkopf", "bist dumm", "blöd", "doof", "schrecklich", "furchtbar", "scheiß"},
+	"es": {"te odio", "odio tu", "estúpid", "tonto", "tonta", "horrible", "apesta"},
+	"fr": {"déteste", "débile", "crétin", "horrible", "affreux", "c'est nul"},
+}
+
+// IsPositive reports whether message passes the positivity filter. Every
+// locale's words are checked whatever language the request asked for,
+// since most clients send no Accept-Language at all.
+func IsPositive(message string) bool {
+	lower := strings.ToLower(message)
+	for _, words := range negativeWords {
+		for _, word := range words {
+			if strings.Contains(lower, word) {
+				return false
+			}
+		}
+	}
+	return true
+}
@@ -0,0 +1,96 @@
+// Package i18n localises the API: it works out which languages a request
+// prefers, holds the built-in message catalogs that init-db imports, and
+// translates error messages and the positivity filter's word lists.
+package i18n
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Default is the locale used when a request asks for none that is
+// available. The API was English-only at first, so everything has it.
+const Default = "en"
+
+// Preferences lists the language tags a request asks for, most preferred
+// first: lang, from the lang= parameter, then Accept-Language in order of
+// quality. Languages refused with q=0, and the "*" wildcard, are left out;
+// Match falls back to Default for them.
+func Preferences(lang, acceptLanguage string) []string {
+	var prefs []string
+	if lang = strings.TrimSpace(lang); lang != "" {
+		prefs = append(prefs, lang)
+	}
+
+	type weighted struct {
+		tag string
+		q   float64
+	}
+	var accepted []weighted
+	for _, part := range strings.Split(acceptLanguage, ",") {
+		tag, params, _ := strings.Cut(part, ";")
+		tag = strings.TrimSpace(tag)
+		if tag == "" || tag == "*" {
+			continue
+		}
+		q := 1.0
+		if v, ok := strings.CutPrefix(strings.TrimSpace(params), "q="); ok {
+			var err error
+			if q, err = strconv.ParseFloat(v, 64); err != nil {
+				continue
+			}
+		}
+		if q > 0 {
+			accepted = append(accepted, weighted{tag, q})
+		}
+	}
+	sort.SliceStable(accepted, func(i, j int) bool { return accepted[i].q > accepted[j].q })
+
+	for _, a := range accepted {
+		prefs = append(prefs, a.tag)
+	}
+	return prefs
+}
+
+// Match returns the available locale that best serves prefs. Each
+// preference is tried in turn, first exactly, then by its language alone
+// (de-AT finds de) and then by any locale of that language (pt finds
+// pt-BR). Without a match it returns Default if available, or else the
+// first available locale.
+func Match(prefs, available []string) string {
+	for _, pref := range prefs {
+		for _, a := range available {
+			if strings.EqualFold(a, pref) {
+				return a
+			}
+		}
+		lang := language(pref)
+		for _, a := range available {
+			if strings.EqualFold(a, lang) {
+				return a
+			}
+		}
+		for _, a := range available {
+			if strings.EqualFold(language(a), lang) {
+				return a
+			}
+		}
+	}
+
+	for _, a := range available {
+		if a == Default {
+			return a
+		}
+	}
+	if len(available) > 0 {
+		return available[0]
+	}
+	return Default
+}
+
+// language is the primary language subtag of tag, e.g. "pt" for "pt-BR".
+func language(tag string) string {
+	lang, _, _ := strings.Cut(strings.ReplaceAll(tag, "_", "-"), "-")
+	return lang
+}
@@ -0,0 +1,147 @@
+package i18n
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestPreferences(t *testing.T) {
+	tests := []struct {
+		lang, accept string
+		want         []string
+	}{
+		{"", "", nil},
+		{"fr", "", []string{"fr"}},
+		{"", "de-AT,de;q=0.9,en;q=0.8", []string{"de-AT", "de", "en"}},
+		{"", "en;q=0.5, es", []string{"es", "en"}},
+		{"fr", "de", []string{"fr", "de"}},
+		{"", "*, de;q=0, fr;q=0.3", []string{"fr"}},
+		{"", "es;q=nonsense, fr", []string{"fr"}},
+	}
+	for _, tc := range tests {
+		got := Preferences(tc.lang, tc.accept)
+		if fmt.Sprint(got) != fmt.Sprint(tc.want) {
+			t.Errorf("Preferences(%q, %q) = %q, want %q", tc.lang, tc.accept, got, tc.want)
+		}
+	}
+}
+
+func TestMatch(t *testing.T) {
+	available := []string{"en", "de", "pt-BR"}
+	tests := []struct {
+		prefs []string
+		want  string
+	}{
+		{nil, "en"},
+		{[]string{"de"}, "de"},
+		{[]string{"DE"}, "de"},
+		{[]string{"de-CH"}, "de"},
+		{[]string{"de_CH"}, "de"},
+		{[]string{"pt"}, "pt-BR"},
+		{[]string{"pt-PT"}, "pt-BR"},
+		{[]string{"ja", "de"}, "de"},
+		{[]string{"ja"}, "en"},
+	}
+	for _, tc := range tests {
+		if got := Match(tc.prefs, available); got != tc.want {
+			t.Errorf("Match(%q) = %s, want %s", tc.prefs, got, tc.want)
+		}
+	}
+
+	if got := Match([]string{"ja"}, []string{"fr", "de"}); got != "fr" {
+		t.Errorf("without %s, Match fell back to %s, want the first available", Default, got)
+	}
+}
+
+func TestBuiltIn(t *testing.T) {
+	catalogs, err := BuiltIn()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(catalogs) == 0 || catalogs[0].Locale != Default {
+		t.Fatalf("the first catalog is not %s", Default)
+	}
+	if n := len(catalogs[0].Messages); n != 50 {
+		t.Errorf("%d English messages, want the original 50", n)
+	}
+	for _, c := range catalogs {
+		for _, m := range c.Messages {
+			if !IsPositive(m) {
+				t.Errorf("%s: %q fails the positivity filter", c.Locale, m)
+			}
+		}
+	}
+}
+
+func TestParseCatalog(t *testing.T) {
+	got, err := ParseCatalog(strings.NewReader("# Welsh\n\nDa iawn!\n  Gwaith gwych!  \n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fmt.Sprint(got) != "[Da iawn! Gwaith gwych!]" {
+		t.Errorf("ParseCatalog = %q", got)
+	}
+
+	if _, err := ParseCatalog(strings.NewReader("# nothing\n")); err == nil {
+		t.Error("an empty catalog was accepted")
+	}
+	if _, err := ParseCatalog(strings.NewReader(strings.Repeat("x", maxMessageLen+1))); err == nil {
+		t.Error("a message too long to send was accepted")
+	}
+}
+
+func TestError(t *testing.T) {
+	english := errorTranslations["de"]
+	for locale, translations := range errorTranslations {
+		for message := range english {
+			if _, ok := translations[message]; !ok {
+				t.Errorf("%s: no translation of %q", locale, message)
+			}
+		}
+		if len(translations) != len(english) {
+			t.Errorf("%s has %d translations, de has %d", locale, len(translations), len(english))
+		}
+	}
+
+	tests := []struct {
+		prefs             []string
+		message           string
+		wantText, wantTag string
+	}{
+		{nil, "name parameter required", "name parameter required", "en"},
+		{[]string{"fr-CA"}, "name parameter required", "Le paramètre name est obligatoire", "fr"},
+		{[]string{"ja", "es"}, "Invalid JSON", "JSON no válido", "es"},
+		{[]string{"de"}, "not translated", "not translated", "en"},
+	}
+	for _, tc := range tests {
+		text, tag := Error(tc.prefs, tc.message)
+		if text != tc.wantText || tag != tc.wantTag {
+			t.Errorf("Error(%q, %q) = %q, %s, want %q, %s", tc.prefs, tc.message, text, tag, tc.wantText, tc.wantTag)
+		}
+	}
+}
+
+func TestIsPositive(t *testing.T) {
+	tests := []struct {
+		message string
+		want    bool
+	}{
+		{"Great test coverage!", true},
+		{"This is awful", false},
+		// No language is needed to catch the others
+		{"Ich hasse dich", false},
+		{"Du bist ein Dummkopf", false},
+		{"Die Dummy-Daten sind gut strukturiert", true},
+		{"C'est nul", false},
+		{"Le test annulé est corrigé, bravo", true},
+		{"Te odio", false},
+		{"¡Gran episodio de depuración!", true},
+		{"Ich HASSE diesen Code", false},
+	}
+	for _, tc := range tests {
+		if got := IsPositive(tc.message); got != tc.want {
+			t.Errorf("IsPositive(%q) = %v, want %v", tc.message, got, tc.want)
+		}
+	}
+}
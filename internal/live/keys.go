@@ -0,0 +1,117 @@
+package live
+
+import (
+	"io"
+	"unicode/utf8"
+)
+
+// keyCode identifies a non-printable key. Printable keys use keyRune.
+type keyCode int
+
+const (
+	keyRune keyCode = iota
+	keyUp
+	keyDown
+	keyPageUp
+	keyPageDown
+	keyHome
+	keyEnd
+	keyEnter
+	keyEscape
+	keyBackspace
+	keyInterrupt // Ctrl+C, which raw mode delivers as a byte
+)
+
+type key struct {
+	code keyCode
+	r    rune
+}
+
+// escapeSequences maps the CSI and SS3 sequences terminals send for the
+// keys live mode understands.
+var escapeSequences = map[string]keyCode{
+	"\x1b[A":  keyUp,
+	"\x1bOA":  keyUp,
+	"\x1b[B":  keyDown,
+	"\x1bOB":  keyDown,
+	"\x1b[5~": keyPageUp,
+	"\x1b[6~": keyPageDown,
+	"\x1b[H":  keyHome,
+	"\x1bOH":  keyHome,
+	"\x1b[1~": keyHome,
+	"\x1b[F":  keyEnd,
+	"\x1bOF":  keyEnd,
+	"\x1b[4~": keyEnd,
+}
+
+// decodeKeys splits one read from the terminal into keys. Unknown escape
+// sequences are dropped.
+func decodeKeys(buf []byte) []key {
+	var keys []key
+	for len(buf) > 0 {
+		switch b := buf[0]; {
+		case b == 0x1b:
+			n := escapeLength(buf)
+			if n == 1 {
+				keys = append(keys, key{code: keyEscape})
+			} else if code, ok := escapeSequences[string(buf[:n])]; ok {
+				keys = append(keys, key{code: code})
+			}
+			buf = buf[n:]
+			continue
+		case b == '\r' || b == '\n':
+			keys = append(keys, key{code: keyEnter})
+		case b == 0x7f || b == 0x08:
+			keys = append(keys, key{code: keyBackspace})
+		case b == 0x03:
+			keys = append(keys, key{code: keyInterrupt})
+		case b < 0x20:
+			// other control characters are ignored
+		default:
+			r, size := utf8.DecodeRune(buf)
+			keys = append(keys, key{code: keyRune, r: r})
+			buf = buf[size:]
+			continue
+		}
+		buf = buf[1:]
+	}
+	return keys
+}
+
+// escapeLength returns the length of the escape sequence at the start of
+// buf: ESC [ params final, ESC O final, or a lone ESC.
+func escapeLength(buf []byte) int {
+	if len(buf) < 2 {
+		return 1
+	}
+	switch buf[1] {
+	case 'O':
+		if len(buf) < 3 {
+			return 2
+		}
+		return 3
+	case '[':
+		for i := 2; i < len(buf); i++ {
+			if buf[i] >= 0x40 && buf[i] <= 0x7e {
+				return i + 1
+			}
+		}
+		return len(buf)
+	}
+	return 1
+}
+
+// readKeys sends the keys typed on r until it fails, then closes keys.
+func readKeys(r io.Reader, keys chan<- key) {
+	defer close(keys)
+	buf := make([]byte, 64)
+	for {
+		n, err := r.Read(buf)
+		for _, k := range decodeKeys(buf[:n]) {
+			keys <- k
+		}
+		if err != nil {
+			return
+		}
+	}
+}
@@ -0,0 +1,510 @@
+// Package live is happywatch's interactive live mode: a terminal table of
+// the students active in the last hour that can be sorted, filtered and
+// drilled into from the keyboard, and a scrolling feed of requests.
+package live
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/industrial-linguistics/happy-api/internal/monitor"
+	"golang.org/x/term"
+)
+
+// Views selectable with Options.View
+const (
+	ViewTable = "table" // students active in the window
+	ViewFeed  = "feed"  // one line per request as it arrives
+	ViewSplit = "split" // the table above the feed
+)
+
+// Views lists the views in the order the v key cycles through them.
+var Views = []string{ViewTable, ViewFeed, ViewSplit}
+
+// Options configures live mode.
+type Options struct {
+	// View is the initial view, one of Views.
+	View string
+	// Window is how far back a student counts as active.
+	Window time.Duration
+	// Interval is how often the database is polled.
+	Interval time.Duration
+	// Tail is the number of requests shown in the detail pane and loaded
+	// into the feed at startup.
+	Tail int
+	// Color enables ANSI colors. Cursor movement is only used when stdout
+	// is a terminal regardless.
+	Color bool
+	// Location is the zone times are shown in, UTC when nil.
+	Location *time.Location
+}
+
+// DefaultOptions polls every three seconds for the last hour of activity.
+var DefaultOptions = Options{
+	View:     ViewTable,
+	Window:   time.Hour,
+	Interval: 3 * time.Second,
+	Tail:     20,
+	Color:    true,
+	Location: time.Local,
+}
+
+const (
+	// feedKeep is how many requests the feed remembers for scrollback
+	// when the terminal grows.
+	feedKeep = 500
+	// feedBatch is how many new requests are read per query while
+	// catching up.
+	feedBatch = 1000
+)
+
+// sgrSequence matches the ANSI color codes stripped when Color is off.
+var sgrSequence = regexp.MustCompile("\x1b\\[[0-9;]*m")
+
+// sortField is the column the table is ordered by.
+type sortField int
+
+const (
+	sortLastSeen sortField = iota
+	sortName
+	sortRequests
+	sortErrors
+)
+
+var sortLabels = map[sortField]string{
+	sortLastSeen: "last seen",
+	sortName:     "name",
+	sortRequests: "requests",
+	sortErrors:   "errors",
+}
+
+// sortKeys selects a sort column. Pressing the key of the current column
+// reverses the order.
+var sortKeys = map[rune]sortField{
+	'l': sortLastSeen,
+	'n': sortName,
+	'r': sortRequests,
+	'e': sortErrors,
+}
+
+// action is what the main loop has to do after a key press.
+type action int
+
+const (
+	actionNone action = iota
+	actionQuit
+	actionLoadDetail
+)
+
+// codeCount is the number of requests that got one error status.
+type codeCount struct {
+	code  int
+	count int
+}
+
+// detail is the open detail pane for one student.
+type detail struct {
+	name    string
+	session string
+	entries []monitor.ActivityEntry // newest first, at most Options.Tail
+	total   int
+	codes   []codeCount
+	err     error
+}
+
+// view is the state of the live display between polls.
+type view struct {
+	opts   Options
+	layout string // current view, one of Views
+
+	feed   []monitor.ActivityEntry // most recent requests, oldest first
+	lastID int64                   // newest activity_log id in feed
+	loaded bool                    // feed has been primed with Tail requests
+
+	users   []monitor.LiveUser // latest poll
+	rows    []monitor.LiveUser // users after filtering and sorting
+	err     error
+	updated time.Time
+
+	sortBy    sortField
+	reversed  bool
+	filter    string
+	filtering bool // typing goes into the filter
+
+	selected     int
+	selectedName string // keeps the selection on a student across polls
+	offset       int    // first row shown
+	tableRows    int    // rows that fit on screen at the last draw
+
+	detail *detail
+}
+
+func newView(opts Options) *view {
+	if opts.Location == nil {
+		opts.Location = time.UTC
+	}
+	return &view{opts: opts, layout: opts.View}
+}
+
+// Run shows the interactive display until the user quits or ctx is done;
+// callers cancel ctx on SIGINT and SIGTERM. The terminal is put back the way
+// it was on return. Without a terminal on stdin the display refreshes but
+// takes no input, and without one on stdout each frame is printed in turn.
+func Run(ctx context.Context, db *sql.DB, opts Options) error {
+	var keys chan key
+	in := int(os.Stdin.Fd())
+	if term.IsTerminal(in) {
+		state, err := term.MakeRaw(in)
+		if err != nil {
+			return fmt.Errorf("failed to enter raw mode: %w", err)
+		}
+		defer term.Restore(in, state)
+
+		keys = make(chan key)
+		go readKeys(os.Stdin, keys)
+	}
+
+	out := os.Stdout
+	tty := term.IsTerminal(int(out.Fd()))
+	if tty {
+		fmt.Fprint(out, enterAltScreen+hideCursor)
+		defer fmt.Fprint(out, showCursor+leaveAltScreen)
+	}
+
+	resize := make(chan os.Signal, 1)
+	if len(resizeSignals) > 0 {
+		signal.Notify(resize, resizeSignals...)
+		defer signal.Stop(resize)
+	}
+
+	v := newView(opts)
+	v.refresh(ctx, db)
+
+	ticker := time.NewTicker(opts.Interval)
+	defer ticker.Stop()
+
+	for {
+		v.draw(out, tty)
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-resize:
+			// redraw at the new size
+		case <-ticker.C:
+			v.refresh(ctx, db)
+		case k, ok := <-keys:
+			if !ok {
+				keys = nil
+				continue
+			}
+			switch v.handleKey(k) {
+			case actionQuit:
+				return nil
+			case actionLoadDetail:
+				v.loadDetail(ctx, db)
+			}
+		}
+	}
+}
+
+// refresh polls the live users and new requests, and reloads an open
+// detail pane.
+func (v *view) refresh(ctx context.Context, db *sql.DB) {
+	users, err := monitor.LiveUsers(ctx, db, monitor.Last(v.opts.Window))
+	if err == nil {
+		err = v.tail(ctx, db)
+	}
+	v.err = err
+	if err == nil {
+		v.users = users
+		v.updated = time.Now()
+	}
+	v.apply()
+
+	if v.detail != nil {
+		v.loadDetail(ctx, db)
+	}
+}
+
+// tail appends the requests logged since the last poll to the feed. The
+// first call loads the last Tail requests so the feed does not start empty.
+func (v *view) tail(ctx context.Context, db *sql.DB) error {
+	if !v.loaded {
+		entries, err := monitor.RecentActivity(ctx, db, v.opts.Tail)
+		if err != nil {
+			return err
+		}
+		v.appendFeed(entries)
+		v.loaded = true
+		return nil
+	}
+
+	for {
+		entries, err := monitor.ActivityAfter(ctx, db, v.lastID, feedBatch)
+		if err != nil {
+			return err
+		}
+		v.appendFeed(entries)
+		if len(entries) < feedBatch {
+			return nil
+		}
+	}
+}
+
+func (v *view) appendFeed(entries []monitor.ActivityEntry) {
+	if len(entries) == 0 {
+		return
+	}
+	v.feed = append(v.feed, entries...)
+	if len(v.feed) > feedKeep {
+		v.feed = append(v.feed[:0], v.feed[len(v.feed)-feedKeep:]...)
+	}
+	v.lastID = entries[len(entries)-1].ID
+}
+
+// matches reports whether the filter selects a student or request.
+func (v *view) matches(name, session string) bool {
+	needle := strings.ToLower(v.filter)
+	return needle == "" ||
+		strings.Contains(strings.ToLower(name), needle) ||
+		strings.Contains(strings.ToLower(session), needle)
+}
+
+// loadDetail fills the detail pane for the selected student.
+func (v *view) loadDetail(ctx context.Context, db *sql.DB) {
+	name := v.selectedName
+	if v.detail != nil {
+		name = v.detail.name
+	}
+	if name == "" {
+		v.detail = nil
+		return
+	}
+
+	d := &detail{name: name}
+	entries, err := monitor.LoadActivity(ctx, db, monitor.Last(v.opts.Window), name)
+	if err != nil {
+		d.err = err
+		v.detail = d
+		return
+	}
+
+	d.total = len(entries)
+	counts := map[int]int{}
+	for _, e := range entries {
+		if e.ResponseCode >= 400 {
+			counts[e.ResponseCode]++
+		}
+	}
+	for code, n := range counts {
+		d.codes = append(d.codes, codeCount{code, n})
+	}
+	sort.Slice(d.codes, func(i, j int) bool { return d.codes[i].code < d.codes[j].code })
+
+	for i := len(entries) - 1; i >= 0 && len(d.entries) < v.opts.Tail; i-- {
+		d.entries = append(d.entries, entries[i])
+	}
+	if len(entries) > 0 {
+		d.session = entries[len(entries)-1].SessionID
+	}
+	v.detail = d
+}
+
+// apply rebuilds rows from users, keeping the selected student selected.
+func (v *view) apply() {
+	v.rows = v.rows[:0]
+	for _, u := range v.users {
+		if v.matches(u.Name, u.SessionID) {
+			v.rows = append(v.rows, u)
+		}
+	}
+
+	sort.SliceStable(v.rows, func(i, j int) bool {
+		a, b := v.rows[i], v.rows[j]
+		if v.reversed {
+			a, b = b, a
+		}
+		switch v.sortBy {
+		case sortName:
+			return strings.ToLower(a.Name) < strings.ToLower(b.Name)
+		case sortRequests:
+			return a.TotalCount > b.TotalCount
+		case sortErrors:
+			return a.ErrorCount > b.ErrorCount
+		}
+		return a.LastSeen.After(b.LastSeen)
+	})
+
+	v.selected = 0
+	for i, u := range v.rows {
+		if u.Name == v.selectedName {
+			v.selected = i
+			break
+		}
+	}
+	v.syncSelection()
+}
+
+// syncSelection clamps the selection and remembers whose row it is.
+func (v *view) syncSelection() {
+	if v.selected >= len(v.rows) {
+		v.selected = len(v.rows) - 1
+	}
+	if v.selected < 0 {
+		v.selected = 0
+	}
+	v.selectedName = ""
+	if len(v.rows) > 0 {
+		v.selectedName = v.rows[v.selected].Name
+	}
+}
+
+func (v *view) move(delta int) {
+	v.selected += delta
+	v.syncSelection()
+}
+
+// handleKey updates the view for one key press.
+func (v *view) handleKey(k key) action {
+	if k.code == keyInterrupt {
+		return actionQuit
+	}
+
+	if v.filtering {
+		switch k.code {
+		case keyEnter:
+			v.filtering = false
+		case keyEscape:
+			v.filtering = false
+			v.filter = ""
+		case keyBackspace:
+			if r := []rune(v.filter); len(r) > 0 {
+				v.filter = string(r[:len(r)-1])
+			}
+		case keyRune:
+			v.filter += string(k.r)
+		default:
+			return v.navigate(k)
+		}
+		v.apply()
+		return actionNone
+	}
+
+	switch k.code {
+	case keyEnter:
+		if v.layout == ViewFeed || v.selectedName == "" {
+			return actionNone
+		}
+		v.detail = nil
+		return actionLoadDetail
+	case keyEscape:
+		if v.detail != nil {
+			v.detail = nil
+		} else if v.filter != "" {
+			v.filter = ""
+			v.apply()
+		}
+		return actionNone
+	case keyRune:
+		switch k.r {
+		case 'q':
+			return actionQuit
+		case '/':
+			v.filtering = true
+			return actionNone
+		case 'v':
+			v.layout = nextView(v.layout)
+			return actionNone
+		case 'j':
+			return v.navigate(key{code: keyDown})
+		case 'k':
+			return v.navigate(key{code: keyUp})
+		case 'g':
+			return v.navigate(key{code: keyHome})
+		case 'G':
+			return v.navigate(key{code: keyEnd})
+		}
+		if field, ok := sortKeys[k.r]; ok {
+			if field == v.sortBy {
+				v.reversed = !v.reversed
+			} else {
+				v.sortBy, v.reversed = field, false
+			}
+			v.apply()
+		}
+		return actionNone
+	}
+	return v.navigate(k)
+}
+
+func nextView(current string) string {
+	for i, name := range Views {
+		if name == current {
+			return Views[(i+1)%len(Views)]
+		}
+	}
+	return Views[0]
+}
+
+// navigate moves the selection. An open detail pane follows it.
+func (v *view) navigate(k key) action {
+	before := v.selectedName
+	page := v.tableRows
+	if page < 1 {
+		page = 1
+	}
+
+	switch k.code {
+	case keyUp:
+		v.move(-1)
+	case keyDown:
+		v.move(1)
+	case keyPageUp:
+		v.move(-page)
+	case keyPageDown:
+		v.move(page)
+	case keyHome:
+		v.move(-len(v.rows))
+	case keyEnd:
+		v.move(len(v.rows))
+	}
+
+	if v.detail != nil && v.selectedName != before {
+		v.detail = nil
+		return actionLoadDetail
+	}
+	return actionNone
+}
+
+// draw writes a full frame over the previous one, or after it when out is
+// not a terminal.
+func (v *view) draw(out io.Writer, tty bool) {
+	width, height, err := term.GetSize(int(os.Stdout.Fd()))
+	if err != nil {
+		// Fallback to reasonable defaults
+		width, height = 80, 24
+	}
+
+	frame := v.render(width, height, time.Now())
+	if !v.opts.Color {
+		for i, line := range frame {
+			frame[i] = sgrSequence.ReplaceAllString(line, "")
+		}
+	}
+
+	if !tty {
+		fmt.Fprint(out, strings.Join(frame, "\n")+"\n\n")
+		return
+	}
+	// Raw mode turns off newline translation, so return the carriage too
+	fmt.Fprint(out, cursorHome+strings.Join(frame, clearLine+"\r\n")+clearLine+clearBelow)
+}
@@ -0,0 +1,171 @@
+package live
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/industrial-linguistics/happy-api/internal/monitor"
+)
+
+func TestDecodeKeys(t *testing.T) {
+	got := decodeKeys([]byte("a\x1b[B\x1b[5~\r\x7f\x1b\x03é\x1b[99x"))
+	want := []key{
+		{code: keyRune, r: 'a'},
+		{code: keyDown},
+		{code: keyPageUp},
+		{code: keyEnter},
+		{code: keyBackspace},
+		{code: keyEscape},
+		{code: keyInterrupt},
+		{code: keyRune, r: 'é'},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("decodeKeys = %+v, want %+v", got, want)
+	}
+}
+
+func names(rows []monitor.LiveUser) []string {
+	var out []string
+	for _, u := range rows {
+		out = append(out, u.Name)
+	}
+	return out
+}
+
+func typeKeys(v *view, s string) {
+	for _, k := range decodeKeys([]byte(s)) {
+		v.handleKey(k)
+	}
+}
+
+func TestViewSortAndFilter(t *testing.T) {
+	now := time.Now()
+	v := newView(DefaultOptions)
+	v.users = []monitor.LiveUser{
+		{Name: "Kevin", SessionID: "java", LastSeen: now.Add(-time.Minute), TotalCount: 3, ErrorCount: 2},
+		{Name: "alice", SessionID: "java", LastSeen: now.Add(-2 * time.Minute), TotalCount: 9},
+		{Name: "Bob", SessionID: "python", LastSeen: now.Add(-3 * time.Minute), TotalCount: 5, ErrorCount: 1},
+	}
+	v.apply()
+
+	steps := []struct {
+		keys string
+		want []string
+	}{
+		{"", []string{"Kevin", "alice", "Bob"}},
+		{"n", []string{"alice", "Bob", "Kevin"}},
+		{"n", []string{"Kevin", "Bob", "alice"}},
+		{"r", []string{"alice", "Bob", "Kevin"}},
+		{"e", []string{"Kevin", "Bob", "alice"}},
+		{"/JAV", []string{"Kevin", "alice"}},
+		{"\x7f\x7f\x7fpy\r", []string{"Bob"}},
+		{"\x1b", []string{"Kevin", "Bob", "alice"}},
+	}
+	for _, s := range steps {
+		typeKeys(v, s.keys)
+		if got := names(v.rows); !reflect.DeepEqual(got, s.want) {
+			t.Errorf("after %q: got %v, want %v", s.keys, got, s.want)
+		}
+	}
+}
+
+func TestViewSelectionFollowsStudent(t *testing.T) {
+	now := time.Now()
+	v := newView(DefaultOptions)
+	v.users = []monitor.LiveUser{
+		{Name: "Kevin", LastSeen: now.Add(-time.Minute)},
+		{Name: "Alice", LastSeen: now.Add(-2 * time.Minute)},
+	}
+	v.apply()
+
+	typeKeys(v, "j")
+	if v.selectedName != "Alice" {
+		t.Fatalf("selected %q, want Alice", v.selectedName)
+	}
+
+	// Alice makes a request and moves to the top
+	v.users[1].LastSeen = now
+	v.apply()
+	if v.selected != 0 || v.selectedName != "Alice" {
+		t.Errorf("selection moved to %d (%q), want Alice at 0", v.selected, v.selectedName)
+	}
+
+	if got := v.handleKey(key{code: keyEnter}); got != actionLoadDetail {
+		t.Errorf("Enter returned %v, want actionLoadDetail", got)
+	}
+	if got := v.handleKey(key{code: keyRune, r: 'q'}); got != actionQuit {
+		t.Errorf("q returned %v, want actionQuit", got)
+	}
+}
+
+func TestFeedKeepsNewestRequests(t *testing.T) {
+	v := newView(Options{View: ViewFeed, Tail: 20})
+
+	var batch []monitor.ActivityEntry
+	for id := int64(1); id <= feedKeep+10; id++ {
+		batch = append(batch, monitor.ActivityEntry{ID: id, Name: "Alice"})
+	}
+	v.appendFeed(batch[:10])
+	v.appendFeed(batch[10:])
+
+	if len(v.feed) != feedKeep {
+		t.Fatalf("feed holds %d requests, want %d", len(v.feed), feedKeep)
+	}
+	if v.feed[0].ID != 11 || v.lastID != feedKeep+10 {
+		t.Errorf("feed covers ids %d-%d, want 11-%d", v.feed[0].ID, v.lastID, feedKeep+10)
+	}
+
+	v.appendFeed(nil)
+	if v.lastID != feedKeep+10 {
+		t.Errorf("empty poll moved lastID to %d", v.lastID)
+	}
+}
+
+func TestFit(t *testing.T) {
+	tests := []struct {
+		s     string
+		width int
+		right bool
+		want  string
+	}{
+		{"Alice", 8, false, "Alice   "},
+		{"42", 4, true, "  42"},
+		{"Bartholomew", 6, false, "Barth…"},
+		{"\x1b[2J", 8, false, `\x1b[2J `},
+		{"ab\x1b[2J", 5, false, `ab\x…`},
+	}
+	for _, tt := range tests {
+		if got := fit(tt.s, tt.width, tt.right); got != tt.want {
+			t.Errorf("fit(%q, %d) = %q, want %q", tt.s, tt.width, got, tt.want)
+		}
+	}
+}
+
+func TestFeedEscapesControlCharacters(t *testing.T) {
+	v := newView(Options{View: ViewFeed, Tail: 20})
+	v.appendFeed([]monitor.ActivityEntry{{
+		ID:           1,
+		Name:         "\x1b]0;pwned\a",
+		Endpoint:     "/automessage\x1b[2J",
+		SessionID:    "s1\x1b[H",
+		ResponseCode: 200,
+	}})
+
+	for _, line := range v.renderFeed(100, 5) {
+		if strings.Contains(line, "\x1b]") || strings.Contains(line, "\x1b[2J") || strings.Contains(line, "\x1b[H") || strings.Contains(line, "\a") {
+			t.Errorf("feed line %q writes control sequences from the request", line)
+		}
+	}
+}
+
+func TestViewKeyCyclesViews(t *testing.T) {
+	v := newView(DefaultOptions)
+	for _, want := range []string{ViewFeed, ViewSplit, ViewTable} {
+		typeKeys(v, "v")
+		if v.layout != want {
+			t.Errorf("view = %q, want %q", v.layout, want)
+		}
+	}
+}
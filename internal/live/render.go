@@ -0,0 +1,381 @@
+package live
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/industrial-linguistics/happy-api/internal/monitor"
+)
+
+// ANSI color codes
+const (
+	colorReset   = "\033[0m"
+	colorBold    = "\033[1m"
+	colorReverse = "\033[7m"
+	colorCyan    = "\033[36m"
+	colorGreen   = "\033[32m"
+	colorYellow  = "\033[33m"
+	colorRed     = "\033[31m"
+	colorBlue    = "\033[34m"
+	colorGray    = "\033[90m"
+)
+
+// Cursor and screen control sequences
+const (
+	hideCursor = "\033[?25l"
+	showCursor = "\033[?25h"
+	cursorHome = "\033[H"
+	clearLine  = "\033[K"
+	clearBelow = "\033[J"
+
+	enterAltScreen = "\033[?1049h"
+	leaveAltScreen = "\033[?1049l"
+)
+
+const helpLine = "↑/↓ move  Enter details  / filter  n r e l sort  v view  Esc back  q quit"
+
+// column is one column of the live table.
+type column struct {
+	title string
+	width int
+	right bool // right-align, for numbers
+}
+
+func paint(color, s string) string {
+	return color + s + colorReset
+}
+
+// fit truncates s to width runes and pads it to exactly width. Control
+// characters are escaped first, since s often comes from a request.
+func fit(s string, width int, right bool) string {
+	s = monitor.Printable(s)
+	n := utf8.RuneCountInString(s)
+	if n > width {
+		r := []rune(s)
+		if width > 1 {
+			return string(r[:width-1]) + "…"
+		}
+		return string(r[:width])
+	}
+	if right {
+		return strings.Repeat(" ", width-n) + s
+	}
+	return s + strings.Repeat(" ", width-n)
+}
+
+// center pads s so it sits in the middle of width.
+func center(s string, width int) string {
+	padding := (width - utf8.RuneCountInString(s)) / 2
+	if padding <= 0 {
+		return s
+	}
+	return strings.Repeat(" ", padding) + s
+}
+
+// ago formats how long ago t was, as in the rest of happywatch.
+func ago(now, t time.Time) string {
+	d := now.Sub(t).Round(time.Second)
+	if d < time.Minute {
+		return fmt.Sprintf("%ds ago", int(d.Seconds()))
+	} else if d < time.Hour {
+		return fmt.Sprintf("%dm ago", int(d.Minutes()))
+	}
+	return fmt.Sprintf("%dh ago", int(d.Hours()))
+}
+
+// windowLabel describes the activity window for the empty-table message.
+func windowLabel(d time.Duration) string {
+	if d == time.Hour {
+		return "hour"
+	}
+	return d.String()
+}
+
+// render lays out one frame as lines no wider than width.
+func (v *view) render(width, height int, now time.Time) []string {
+	lines := []string{paint(colorBold+colorCyan, center("╔══ Happy API Activity Monitor ══╗", width))}
+
+	order := "↓"
+	if v.reversed {
+		order = "↑"
+	}
+	status := fmt.Sprintf("Updated %s │ %d active │ sorted by %s %s",
+		v.updated.Format("15:04:05"), len(v.users), sortLabels[v.sortBy], order)
+	lines = append(lines, paint(colorGray, center(status, width)))
+
+	switch {
+	case v.err != nil:
+		lines = append(lines, paint(colorRed, fit("Error querying database: "+v.err.Error(), width, false)))
+	case v.filtering:
+		lines = append(lines, paint(colorBold, "Filter: ")+v.filter+paint(colorReverse, " "))
+	case v.filter != "":
+		lines = append(lines, paint(colorYellow, fit(fmt.Sprintf("Filter: %s (%d of %d)  Esc clears", v.filter, len(v.rows), len(v.users)), width, false)))
+	default:
+		lines = append(lines, "")
+	}
+
+	// Reserve: 3 for header, 1 for footer
+	body := height - 4
+	tableHeight, lowerHeight := body, 0
+	switch {
+	case v.layout == ViewFeed:
+		tableHeight, lowerHeight = 0, body
+	case v.layout == ViewSplit || v.detail != nil:
+		lowerHeight = body / 2
+		if lowerHeight < 6 {
+			lowerHeight = 6
+		}
+		tableHeight = body - lowerHeight
+	}
+
+	if tableHeight > 0 {
+		lines = append(lines, v.renderUsers(width, tableHeight, now)...)
+	}
+
+	switch {
+	case v.detail != nil && v.layout != ViewFeed:
+		lines = append(lines, v.renderDetail(width, lowerHeight, now)...)
+	case lowerHeight > 0:
+		lines = append(lines, v.renderFeed(width, lowerHeight)...)
+	}
+
+	footer := helpLine
+	if end := v.offset + v.tableRows; tableHeight > 0 && len(v.rows) > v.tableRows {
+		if end > len(v.rows) {
+			end = len(v.rows)
+		}
+		footer = fmt.Sprintf("%d-%d of %d │ %s", v.offset+1, end, len(v.rows), helpLine)
+	}
+	for len(lines) < height-1 {
+		lines = append(lines, "")
+	}
+	return append(lines, paint(colorGray, fit(footer, width, false)))
+}
+
+// renderUsers draws the table of active students in height lines, scrolled
+// so the selection is visible.
+func (v *view) renderUsers(width, height int, now time.Time) []string {
+	// Reserve 4 for table borders and heading
+	v.tableRows = height - 4
+	if v.tableRows < 1 {
+		v.tableRows = 1
+	}
+	if v.selected < v.offset {
+		v.offset = v.selected
+	}
+	if v.selected >= v.offset+v.tableRows {
+		v.offset = v.selected - v.tableRows + 1
+	}
+	if v.offset > len(v.rows)-v.tableRows {
+		v.offset = len(v.rows) - v.tableRows
+	}
+	if v.offset < 0 {
+		v.offset = 0
+	}
+
+	switch {
+	case len(v.users) == 0:
+		return []string{paint(colorBold+colorYellow,
+			fmt.Sprintf("━━━ No activity in the last %s ━━━", windowLabel(v.opts.Window)))}
+	case len(v.rows) == 0:
+		return []string{paint(colorBold+colorYellow, fmt.Sprintf("━━━ Nobody matches %q ━━━", v.filter))}
+	}
+	return v.renderTable(width, now)
+}
+
+// renderFeed draws the most recent requests that match the filter, newest
+// at the bottom, in height lines.
+func (v *view) renderFeed(width, height int) []string {
+	lines := []string{paint(colorBold+colorCyan, fit(rule("── Requests ", width), width, false))}
+
+	var shown []monitor.ActivityEntry
+	for i := len(v.feed) - 1; i >= 0 && len(shown) < height-1; i-- {
+		if e := v.feed[i]; v.matches(e.Name, e.SessionID) {
+			shown = append(shown, e)
+		}
+	}
+
+	if len(shown) == 0 {
+		return append(lines, paint(colorGray, "Waiting for requests..."))
+	}
+
+	// Mark, time, name, status code and session take 58 columns
+	endpointWidth := width - 58
+	if endpointWidth < 12 {
+		endpointWidth = 12
+	}
+	for i := len(shown) - 1; i >= 0; i-- {
+		e := shown[i]
+
+		mark, color := "✓", colorGreen
+		if e.ResponseCode >= 400 {
+			mark, color = "✗", colorRed
+		}
+		name := e.Name
+		if name == "" {
+			name = "anonymous"
+		}
+		session := e.SessionID
+		if session == "" {
+			session = "none"
+		}
+
+		lines = append(lines, fmt.Sprintf("%s [%s] %s %s %s %s",
+			paint(color, mark),
+			e.Timestamp.In(v.opts.Location).Format("15:04:05"),
+			fit(name, 15, false),
+			fit(e.Endpoint, endpointWidth, false),
+			paint(color, strconv.Itoa(e.ResponseCode)),
+			paint(colorGray, fit("(session: "+session+")", 22, false))))
+	}
+	return lines
+}
+
+// rule pads title with a horizontal line to width.
+func rule(title string, width int) string {
+	if n := utf8.RuneCountInString(title); n < width {
+		return title + strings.Repeat("─", width-n)
+	}
+	return title
+}
+
+func (v *view) renderTable(width int, now time.Time) []string {
+	// Format: Name | Session | Last Seen | Endpoint | Requests | Errors
+	cols := []column{
+		{"Name", 16, false},
+		{"Session", 12, false},
+		{"Last Seen", 9, false},
+		{"Endpoint", 0, false},
+		{"Requests", 8, true},
+		{"Errors", 6, true},
+	}
+	fixed := 3*len(cols) + 1 // "│ " + " │ " between columns + " │"
+	for _, c := range cols {
+		fixed += c.width
+	}
+	cols[3].width = width - fixed
+	if cols[3].width < 8 {
+		cols[3].width = 8
+	}
+	if cols[3].width > 40 {
+		cols[3].width = 40
+	}
+
+	border := func(left, mid, right string) string {
+		parts := make([]string, len(cols))
+		for i, c := range cols {
+			parts[i] = strings.Repeat("─", c.width+2)
+		}
+		return paint(colorBold+colorBlue, left+strings.Join(parts, mid)+right)
+	}
+
+	heading := make([]string, len(cols))
+	for i, c := range cols {
+		heading[i] = fit(c.title, c.width, c.right)
+	}
+
+	lines := []string{
+		border("┌", "┬", "┐"),
+		paint(colorBold+colorBlue, "│ "+strings.Join(heading, " │ ")+" │"),
+		border("├", "┼", "┤"),
+	}
+
+	end := v.offset + v.tableRows
+	if end > len(v.rows) {
+		end = len(v.rows)
+	}
+	for i := v.offset; i < end; i++ {
+		u := v.rows[i]
+
+		errors := "─"
+		if u.ErrorCount > 0 {
+			errors = strconv.Itoa(u.ErrorCount)
+		}
+		session := u.SessionID
+		if session == "" {
+			session = "─"
+		}
+
+		cells := []string{
+			fit(u.Name, cols[0].width, false),
+			fit(session, cols[1].width, false),
+			fit(ago(now, u.LastSeen), cols[2].width, false),
+			fit(u.Endpoint, cols[3].width, false),
+			fit(strconv.Itoa(u.TotalCount), cols[4].width, true),
+			fit(errors, cols[5].width, true),
+		}
+
+		if i == v.selected {
+			lines = append(lines, paint(colorBlue, "│")+paint(colorReverse, " "+strings.Join(cells, " │ ")+" ")+paint(colorBlue, "│"))
+			continue
+		}
+
+		// Color based on recency
+		since := now.Sub(u.LastSeen)
+		if since < 30*time.Second {
+			cells[0], cells[2] = paint(colorGreen, cells[0]), paint(colorGreen, cells[2])
+		} else if since < 5*time.Minute {
+			cells[0], cells[2] = paint(colorYellow, cells[0]), paint(colorYellow, cells[2])
+		}
+		if u.ErrorCount > 0 {
+			cells[5] = paint(colorRed, cells[5])
+		}
+
+		sep := paint(colorBlue, " │ ")
+		lines = append(lines, paint(colorBlue, "│ ")+strings.Join(cells, sep)+paint(colorBlue, " │"))
+	}
+
+	return append(lines, border("└", "┴", "┘"))
+}
+
+// renderDetail draws the detail pane in at most height lines.
+func (v *view) renderDetail(width, height int, now time.Time) []string {
+	d := v.detail
+
+	title := "── " + d.name
+	if d.session != "" {
+		title += " (session " + d.session + ")"
+	}
+	title += fmt.Sprintf(" ── %d requests in the last %s ", d.total, windowLabel(v.opts.Window))
+	lines := []string{paint(colorBold+colorCyan, fit(rule(title, width), width, false))}
+
+	if d.err != nil {
+		return append(lines, paint(colorRed, fit("Error loading requests: "+d.err.Error(), width, false)))
+	}
+
+	if len(d.codes) == 0 {
+		lines = append(lines, paint(colorGreen, "No errors"))
+	} else {
+		parts := make([]string, len(d.codes))
+		for i, c := range d.codes {
+			parts[i] = fmt.Sprintf("%d ×%d", c.code, c.count)
+		}
+		lines = append(lines, paint(colorRed, fit("Errors: "+strings.Join(parts, "  "), width, false)))
+	}
+
+	endpointWidth := width - 36
+	if endpointWidth < 10 {
+		endpointWidth = 10
+	}
+	for _, e := range d.entries {
+		if len(lines) >= height {
+			break
+		}
+		mark, color := "✓", colorGreen
+		if e.ResponseCode >= 400 {
+			mark, color = "✗", colorRed
+		}
+		lines = append(lines, fmt.Sprintf("%s [%s] %s %s %6dms  %s",
+			paint(color, mark),
+			e.Timestamp.In(v.opts.Location).Format("15:04:05"),
+			fit(e.Endpoint, endpointWidth, false),
+			paint(color, strconv.Itoa(e.ResponseCode)),
+			e.ResponseTimeMs,
+			paint(colorGray, ago(now, e.Timestamp))))
+	}
+
+	return lines
+}
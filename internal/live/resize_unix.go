@@ -0,0 +1,11 @@
+//go:build !windows
+
+package live
+
+import (
+	"os"
+	"syscall"
+)
+
+// resizeSignals are delivered when the terminal changes size.
+var resizeSignals = []os.Signal{syscall.SIGWINCH}
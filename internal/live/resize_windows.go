@@ -0,0 +1,7 @@
+package live
+
+import "os"
+
+// resizeSignals is empty: Windows has no SIGWINCH, so the display picks up
+// a new size at the next poll.
+var resizeSignals []os.Signal
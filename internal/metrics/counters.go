@@ -0,0 +1,74 @@
+package metrics
+
+import (
+	"net/http"
+	"sync"
+	"time"
+)
+
+// Counters keeps the metrics in memory for a long-running server. It is
+// safe for concurrent use.
+type Counters struct {
+	mu           sync.Mutex
+	requests     map[requestKey]int
+	latency      Histogram
+	rateLimited  int
+	moderated    int
+	messagesSent int
+	dbErrors     int
+}
+
+type requestKey struct {
+	endpoint string
+	status   int
+}
+
+// NewCounters returns counters starting from zero.
+func NewCounters() *Counters {
+	return &Counters{requests: map[requestKey]int{}, latency: NewHistogram()}
+}
+
+// ObserveRequest counts a finished request, classifying it the same way
+// Load classifies activity_log rows. errMsg is the error the client was
+// sent, if any.
+func (c *Counters) ObserveRequest(endpoint string, status int, errMsg string, d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.requests[requestKey{endpoint, status}]++
+	c.latency.Observe(d)
+	switch {
+	case status == http.StatusTooManyRequests:
+		c.rateLimited++
+	case errMsg == ModerationError:
+		c.moderated++
+	case endpoint == "/message" && status == http.StatusCreated:
+		c.messagesSent++
+	}
+}
+
+// DBError counts a failed database operation, including those that do
+// not fail the request, such as writing activity_log.
+func (c *Counters) DBError() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.dbErrors++
+}
+
+// Snapshot returns the current values.
+func (c *Counters) Snapshot() Snapshot {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	s := Snapshot{
+		Latency:      Histogram{Counts: append([]int(nil), c.latency.Counts...), Sum: c.latency.Sum},
+		RateLimited:  c.rateLimited,
+		Moderated:    c.moderated,
+		MessagesSent: c.messagesSent,
+		DBErrors:     c.dbErrors,
+	}
+	for k, n := range c.requests {
+		s.Requests = append(s.Requests, RequestCount{k.endpoint, k.status, n})
+	}
+	return s
+}
@@ -0,0 +1,104 @@
+package metrics
+
+import (
+	"context"
+	"database/sql"
+	"strings"
+	"time"
+)
+
+// OtherEndpoint is the endpoint label for requests to paths the API does
+// not serve, so that scanners cannot grow the metrics without bound.
+const OtherEndpoint = "other"
+
+// Load derives the metrics from the database, for CGI programs that
+// cannot keep counters between requests. Everything activity_log has ever
+// recorded is counted, so the values only go down when it is cleaned up.
+// Every 500 the API sends is a database failure, so those are counted as
+// database errors. Requests for anything but endpoints, the paths the API
+// serves, are counted under OtherEndpoint, as the server's Counters do.
+func Load(ctx context.Context, db *sql.DB, endpoints []string) (Snapshot, error) {
+	s := Snapshot{Latency: NewHistogram()}
+
+	placeholders := strings.TrimSuffix(strings.Repeat("?, ", len(endpoints)), ", ")
+	args := make([]interface{}, 0, len(endpoints)+1)
+	for _, e := range endpoints {
+		args = append(args, e)
+	}
+	args = append(args, OtherEndpoint)
+	rows, err := db.QueryContext(ctx, `
+        SELECT
+            CASE WHEN endpoint IN (`+placeholders+`) THEN endpoint ELSE ? END AS label,
+            response_code,
+            COUNT(*)
+        FROM activity_log
+        GROUP BY label, response_code
+    `, args...)
+	if err != nil {
+		return Snapshot{}, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var r RequestCount
+		if err := rows.Scan(&r.Endpoint, &r.Status, &r.Count); err != nil {
+			return Snapshot{}, err
+		}
+		s.Requests = append(s.Requests, r)
+		switch r.Status {
+		case 429:
+			s.RateLimited += r.Count
+		case 500:
+			s.DBErrors += r.Count
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return Snapshot{}, err
+	}
+
+	rows, err = db.QueryContext(ctx, `
+        SELECT response_time_ms, COUNT(*)
+        FROM activity_log
+        WHERE response_time_ms IS NOT NULL
+        GROUP BY response_time_ms
+    `)
+	if err != nil {
+		return Snapshot{}, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var ms, n int
+		if err := rows.Scan(&ms, &n); err != nil {
+			return Snapshot{}, err
+		}
+		s.Latency.add(float64(ms)/1000, n)
+	}
+	if err := rows.Err(); err != nil {
+		return Snapshot{}, err
+	}
+
+	err = db.QueryRowContext(ctx, `
+        SELECT COUNT(*) FROM activity_log WHERE error = ?
+    `, ModerationError).Scan(&s.Moderated)
+	if err != nil {
+		return Snapshot{}, err
+	}
+
+	if err := db.QueryRowContext(ctx, `SELECT COUNT(*) FROM user_messages`).Scan(&s.MessagesSent); err != nil {
+		return Snapshot{}, err
+	}
+
+	if err := LoadRateLimit(ctx, db, time.Now(), &s); err != nil {
+		return Snapshot{}, err
+	}
+	return s, nil
+}
+
+// LoadRateLimit fills in the rate limiting gauges for the minute holding
+// now from request_stats.
+func LoadRateLimit(ctx context.Context, db *sql.DB, now time.Time, s *Snapshot) error {
+	return db.QueryRowContext(ctx, `
+        SELECT COUNT(*), COALESCE(MAX(request_count), 0)
+        FROM request_stats
+        WHERE minute_bucket = ?
+    `, now.UTC().Format("2006-01-02 15:04")).Scan(&s.Clients, &s.BusiestClient)
+}
@@ -0,0 +1,147 @@
+// Package metrics describes the API in the Prometheus text format: request
+// counts, latency and the reasons requests were turned away. Under CGI the
+// numbers are read from the database on each scrape; a long-running server
+// keeps them in memory instead.
+package metrics
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ModerationError is the error the API sends when a message fails the
+// positivity filter. activity_log records it, which is how moderation
+// rejections are counted.
+const ModerationError = "message must be positive"
+
+// LatencyBuckets are the upper bounds of the latency histogram in seconds.
+// CGI requests normally finish well inside 50ms; the tail is SQLite
+// waiting on a lock.
+var LatencyBuckets = []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5}
+
+// Snapshot is every metric at one moment.
+type Snapshot struct {
+	Requests     []RequestCount
+	Latency      Histogram
+	RateLimited  int
+	Moderated    int
+	MessagesSent int
+	DBErrors     int
+	// Clients and BusiestClient describe the current minute of rate
+	// limiting: how many addresses made requests and the most any one
+	// made.
+	Clients       int
+	BusiestClient int
+	// Gauges are extra values, such as happywatch's student counts.
+	Gauges []Gauge
+}
+
+// RequestCount is how many requests to an endpoint got a status.
+type RequestCount struct {
+	Endpoint string
+	Status   int
+	Count    int
+}
+
+// Histogram counts observations into LatencyBuckets. Counts has one more
+// entry than LatencyBuckets for observations above the last bound.
+type Histogram struct {
+	Counts []int
+	Sum    float64 // seconds
+}
+
+// NewHistogram returns an empty histogram.
+func NewHistogram() Histogram {
+	return Histogram{Counts: make([]int, len(LatencyBuckets)+1)}
+}
+
+// Observe adds one observation.
+func (h *Histogram) Observe(d time.Duration) {
+	h.add(d.Seconds(), 1)
+}
+
+func (h *Histogram) add(seconds float64, n int) {
+	i := sort.SearchFloat64s(LatencyBuckets, seconds)
+	h.Counts[i] += n
+	h.Sum += seconds * float64(n)
+}
+
+// Gauge is a single named value.
+type Gauge struct {
+	Name  string
+	Help  string
+	Value float64
+}
+
+// ContentType is the media type of the text written by Write.
+const ContentType = "text/plain; version=0.0.4; charset=utf-8"
+
+// Write writes the snapshot in the Prometheus text exposition format.
+func Write(w io.Writer, s Snapshot) error {
+	b := bufio.NewWriter(w)
+
+	header(b, "happy_requests_total", "counter", "Requests handled, by endpoint and response status.")
+	requests := append([]RequestCount(nil), s.Requests...)
+	sort.Slice(requests, func(i, j int) bool {
+		if requests[i].Endpoint != requests[j].Endpoint {
+			return requests[i].Endpoint < requests[j].Endpoint
+		}
+		return requests[i].Status < requests[j].Status
+	})
+	for _, r := range requests {
+		fmt.Fprintf(b, "happy_requests_total{endpoint=\"%s\",status=\"%d\"} %d\n", escapeLabel(r.Endpoint), r.Status, r.Count)
+	}
+
+	header(b, "happy_request_duration_seconds", "histogram", "Time taken to handle requests.")
+	total := 0
+	for i, n := range s.Latency.Counts {
+		total += n
+		le := "+Inf"
+		if i < len(LatencyBuckets) {
+			le = formatFloat(LatencyBuckets[i])
+		}
+		fmt.Fprintf(b, "happy_request_duration_seconds_bucket{le=\"%s\"} %d\n", le, total)
+	}
+	fmt.Fprintf(b, "happy_request_duration_seconds_sum %s\n", formatFloat(s.Latency.Sum))
+	fmt.Fprintf(b, "happy_request_duration_seconds_count %d\n", total)
+
+	counter(b, "happy_rate_limited_total", "Requests rejected by the per-address rate limit.", s.RateLimited)
+	counter(b, "happy_moderation_rejections_total", "Messages rejected by the positivity filter.", s.Moderated)
+	counter(b, "happy_messages_sent_total", "Messages delivered between students.", s.MessagesSent)
+	counter(b, "happy_db_errors_total", "Requests that failed because of a database error.", s.DBErrors)
+
+	header(b, "happy_rate_limit_clients", "gauge", "Addresses that have made requests this minute.")
+	fmt.Fprintf(b, "happy_rate_limit_clients %d\n", s.Clients)
+	header(b, "happy_rate_limit_busiest_client", "gauge", "Most requests made by one address this minute.")
+	fmt.Fprintf(b, "happy_rate_limit_busiest_client %d\n", s.BusiestClient)
+
+	for _, g := range s.Gauges {
+		header(b, g.Name, "gauge", g.Help)
+		fmt.Fprintf(b, "%s %s\n", g.Name, formatFloat(g.Value))
+	}
+
+	return b.Flush()
+}
+
+func header(b *bufio.Writer, name, kind, help string) {
+	fmt.Fprintf(b, "# HELP %s %s\n# TYPE %s %s\n", name, help, name, kind)
+}
+
+func counter(b *bufio.Writer, name, help string, value int) {
+	header(b, name, "counter", help)
+	fmt.Fprintf(b, "%s %d\n", name, value)
+}
+
+// escapeLabel escapes a label value as the text format requires.
+func escapeLabel(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(s)
+}
+
+func formatFloat(f float64) string {
+	return strconv.FormatFloat(f, 'g', -1, 64)
+}
@@ -0,0 +1,177 @@
+package metrics
+
+import (
+	"context"
+	"database/sql"
+	"strings"
+	"testing"
+	"time"
+
+	_ "github.com/mattn/go-sqlite3"
+)
+
+// openFixture returns an in-memory database with a few requests logged.
+func openFixture(t *testing.T) *sql.DB {
+	t.Helper()
+
+	db, err := sql.Open("sqlite3", ":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	db.SetMaxOpenConns(1)
+	t.Cleanup(func() { db.Close() })
+
+	_, err = db.Exec(`
+        CREATE TABLE activity_log (
+            id INTEGER PRIMARY KEY AUTOINCREMENT,
+            timestamp DATETIME DEFAULT CURRENT_TIMESTAMP,
+            endpoint TEXT NOT NULL,
+            response_code INTEGER,
+            response_time_ms INTEGER,
+            error TEXT
+        );
+        CREATE TABLE user_messages (message_id TEXT PRIMARY KEY);
+        CREATE TABLE request_stats (
+            ip_address TEXT NOT NULL,
+            minute_bucket TEXT NOT NULL,
+            request_count INTEGER DEFAULT 1,
+            PRIMARY KEY (ip_address, minute_bucket)
+        );
+        INSERT INTO activity_log (endpoint, response_code, response_time_ms, error) VALUES
+            ('/automessage', 200, 3, NULL),
+            ('/automessage', 200, 4, NULL),
+            ('/automessage', 429, 1, 'Rate limit exceeded'),
+            ('/message', 201, 8, NULL),
+            ('/message', 400, 2, 'message must be positive'),
+            ('/message', 400, 2, 'message too long'),
+            ('/messages', 500, 3000, 'Internal server error'),
+            ('/wp-login.php', 404, 1, 'Not found'),
+            ('/.env', 404, 1, 'Not found');
+        INSERT INTO user_messages VALUES ('msg_1'), ('msg_2');
+    `)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return db
+}
+
+func TestLoad(t *testing.T) {
+	db := openFixture(t)
+	minute := time.Now().UTC().Format("2006-01-02 15:04")
+	_, err := db.Exec(`
+        INSERT INTO request_stats VALUES ('10.0.0.1', ?, 7), ('10.0.0.2', ?, 2), ('10.0.0.3', '2000-01-01 00:00', 99)
+    `, minute, minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s, err := Load(context.Background(), db, []string{"/automessage", "/message", "/messages", "/status"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if s.RateLimited != 1 || s.Moderated != 1 || s.DBErrors != 1 || s.MessagesSent != 2 {
+		t.Errorf("rate limited %d, moderated %d, db errors %d, sent %d; want 1, 1, 1, 2",
+			s.RateLimited, s.Moderated, s.DBErrors, s.MessagesSent)
+	}
+	if s.Clients != 2 || s.BusiestClient != 7 {
+		t.Errorf("clients %d, busiest %d; want 2, 7", s.Clients, s.BusiestClient)
+	}
+
+	counts := map[RequestCount]bool{}
+	for _, r := range s.Requests {
+		counts[r] = true
+	}
+	for _, want := range []RequestCount{
+		{"/automessage", 200, 2},
+		{"/message", 400, 2},
+		{"/messages", 500, 1},
+		{OtherEndpoint, 404, 2},
+	} {
+		if !counts[want] {
+			t.Errorf("requests %v missing %v", s.Requests, want)
+		}
+	}
+	for _, r := range s.Requests {
+		if r.Endpoint == "/wp-login.php" || r.Endpoint == "/.env" {
+			t.Errorf("unknown path %q has its own series", r.Endpoint)
+		}
+	}
+
+	// 1, 1, 1, 2, 2, 3 and 4ms fall in the first bucket, 8ms in the second and
+	// 3s above the last
+	if s.Latency.Counts[0] != 7 || s.Latency.Counts[1] != 1 || s.Latency.Counts[len(LatencyBuckets)] != 1 {
+		t.Errorf("latency counts %v", s.Latency.Counts)
+	}
+}
+
+func TestWrite(t *testing.T) {
+	h := NewHistogram()
+	h.Observe(3 * time.Millisecond)
+	h.Observe(20 * time.Millisecond)
+	h.Observe(5 * time.Second)
+
+	var b strings.Builder
+	err := Write(&b, Snapshot{
+		Requests: []RequestCount{
+			{"/status", 200, 4},
+			{`/odd"path`, 404, 1},
+			{"/automessage", 200, 10},
+		},
+		Latency:     h,
+		RateLimited: 2,
+		Gauges:      []Gauge{{Name: "happywatch_active_students", Help: "Active.", Value: 12}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	out := b.String()
+
+	for _, want := range []string{
+		"# TYPE happy_requests_total counter\n" +
+			"happy_requests_total{endpoint=\"/automessage\",status=\"200\"} 10\n" +
+			"happy_requests_total{endpoint=\"/odd\\\"path\",status=\"404\"} 1\n" +
+			"happy_requests_total{endpoint=\"/status\",status=\"200\"} 4\n",
+		"happy_request_duration_seconds_bucket{le=\"0.005\"} 1\n",
+		"happy_request_duration_seconds_bucket{le=\"0.025\"} 2\n",
+		"happy_request_duration_seconds_bucket{le=\"2.5\"} 2\n",
+		"happy_request_duration_seconds_bucket{le=\"+Inf\"} 3\n",
+		"happy_request_duration_seconds_sum 5.023\n",
+		"happy_request_duration_seconds_count 3\n",
+		"happy_rate_limited_total 2\n",
+		"happy_moderation_rejections_total 0\n",
+		"# TYPE happywatch_active_students gauge\nhappywatch_active_students 12\n",
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("output missing %q:\n%s", want, out)
+		}
+	}
+}
+
+func TestCounters(t *testing.T) {
+	c := NewCounters()
+	c.ObserveRequest("/automessage", 200, "", time.Millisecond)
+	c.ObserveRequest("/automessage", 200, "", time.Millisecond)
+	c.ObserveRequest("/automessage", 429, "Rate limit exceeded", time.Millisecond)
+	c.ObserveRequest("/message", 201, "", time.Millisecond)
+	c.ObserveRequest("/message", 400, ModerationError, time.Millisecond)
+	c.DBError()
+
+	s := c.Snapshot()
+	if s.RateLimited != 1 || s.Moderated != 1 || s.MessagesSent != 1 || s.DBErrors != 1 {
+		t.Errorf("rate limited %d, moderated %d, sent %d, db errors %d; want 1 each",
+			s.RateLimited, s.Moderated, s.MessagesSent, s.DBErrors)
+	}
+	if len(s.Requests) != 4 {
+		t.Errorf("got %d request counts, want 4: %v", len(s.Requests), s.Requests)
+	}
+	if s.Latency.Counts[0] != 5 {
+		t.Errorf("latency counts %v", s.Latency.Counts)
+	}
+
+	// The snapshot must not change with later requests
+	c.ObserveRequest("/status", 200, "", time.Millisecond)
+	if s.Latency.Counts[0] != 5 {
+		t.Errorf("snapshot shares its histogram with the counters")
+	}
+}
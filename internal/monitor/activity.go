@@ -0,0 +1,540 @@
+package monitor
+
+import (
+	"context"
+	"database/sql"
+	"sort"
+	"time"
+)
+
+// LiveUser is a student's most recent request plus their totals for the
+// live window.
+type LiveUser struct {
+	Name       string    `json:"name"`
+	SessionID  string    `json:"session_id"`
+	LastSeen   time.Time `json:"last_seen"`
+	Endpoint   string    `json:"endpoint"`
+	TotalCount int       `json:"total_count"`
+	ErrorCount int       `json:"error_count"`
+}
+
+// EndpointCount is the number of requests made to one endpoint.
+type EndpointCount struct {
+	Endpoint string `json:"endpoint"`
+	Count    int    `json:"count"`
+}
+
+// Summary is the headline numbers for a window of activity.
+type Summary struct {
+	TotalRequests int             `json:"total_requests"`
+	Students      int             `json:"active_students"`
+	Endpoints     []EndpointCount `json:"endpoints"`
+	ErrorCount    int             `json:"error_count"`
+	ErrorRate     float64         `json:"error_rate"`
+}
+
+// StudentProgress is one student's request totals.
+type StudentProgress struct {
+	Name          string    `json:"name"`
+	TotalRequests int       `json:"total_requests"`
+	FirstSeen     time.Time `json:"first_seen"`
+	LastSeen      time.Time `json:"last_seen"`
+	Sessions      int       `json:"sessions"`
+}
+
+// InactiveStudent is a student who has not been seen for a while.
+type InactiveStudent struct {
+	Name     string    `json:"name"`
+	LastSeen time.Time `json:"last_seen"`
+}
+
+// LiveUsers returns everyone active in the range with their latest request,
+// most recent first.
+func LiveUsers(ctx context.Context, db *sql.DB, r Range) ([]LiveUser, error) {
+	rangeClause, args := r.where("timestamp")
+
+	rows, err := db.QueryContext(ctx, `
+        SELECT
+            a.name,
+            COALESCE(a.session_id, ''),
+            a.timestamp as last_seen,
+            a.endpoint,
+            stats.total_count,
+            stats.error_count
+        FROM activity_log a
+        INNER JOIN (
+            SELECT
+                MAX(id) as last_id,
+                COUNT(*) as total_count,
+                SUM(CASE WHEN response_code >= 400 THEN 1 ELSE 0 END) as error_count
+            FROM activity_log
+            WHERE name IS NOT NULL AND name != ''
+              `+rangeClause+`
+            GROUP BY name
+        ) stats ON a.id = stats.last_id
+        ORDER BY a.id DESC
+    `, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	users := []LiveUser{}
+	for rows.Next() {
+		var u LiveUser
+		var lastSeen scanTime
+		if err := rows.Scan(&u.Name, &u.SessionID, &lastSeen, &u.Endpoint, &u.TotalCount, &u.ErrorCount); err != nil {
+			return nil, err
+		}
+		u.LastSeen = lastSeen.Time
+		users = append(users, u)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return users, nil
+}
+
+// LoadCounts totals the requests, students and errors in the range in a
+// single query, leaving Summary.Endpoints nil. The live dashboard polls
+// it between full loads.
+func LoadCounts(ctx context.Context, db *sql.DB, r Range) (Summary, error) {
+	var s Summary
+	rangeClause, args := r.where("timestamp")
+
+	if err := db.QueryRowContext(ctx, `
+        SELECT
+            COUNT(*),
+            COUNT(DISTINCT name),
+            COALESCE(SUM(CASE WHEN response_code >= 400 THEN 1 ELSE 0 END), 0)
+        FROM activity_log
+        WHERE 1=1`+rangeClause+`
+    `, args...).Scan(&s.TotalRequests, &s.Students, &s.ErrorCount); err != nil {
+		return Summary{}, err
+	}
+
+	if s.TotalRequests > 0 {
+		s.ErrorRate = float64(s.ErrorCount) / float64(s.TotalRequests) * 100
+	}
+	return s, nil
+}
+
+// LoadSummary totals the activity logged in the range.
+func LoadSummary(ctx context.Context, db *sql.DB, r Range) (Summary, error) {
+	s, err := LoadCounts(ctx, db, r)
+	if err != nil {
+		return Summary{}, err
+	}
+	s.Endpoints = []EndpointCount{}
+	rangeClause, args := r.where("timestamp")
+
+	rows, err := db.QueryContext(ctx, `
+        SELECT endpoint, COUNT(*) as count
+        FROM activity_log
+        WHERE 1=1`+rangeClause+`
+        GROUP BY endpoint
+        ORDER BY count DESC
+    `, args...)
+	if err != nil {
+		return Summary{}, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var ec EndpointCount
+		if err := rows.Scan(&ec.Endpoint, &ec.Count); err != nil {
+			return Summary{}, err
+		}
+		s.Endpoints = append(s.Endpoints, ec)
+	}
+	if err := rows.Err(); err != nil {
+		return Summary{}, err
+	}
+
+	return s, nil
+}
+
+// LoadStatusCounts counts the requests in the range by response code.
+func LoadStatusCounts(ctx context.Context, db *sql.DB, r Range) (map[int]int, error) {
+	rangeClause, args := r.where("timestamp")
+
+	rows, err := db.QueryContext(ctx, `
+        SELECT COALESCE(response_code, 0), COUNT(*)
+        FROM activity_log
+        WHERE 1=1`+rangeClause+`
+        GROUP BY 1
+    `, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	counts := map[int]int{}
+	for rows.Next() {
+		var code, count int
+		if err := rows.Scan(&code, &count); err != nil {
+			return nil, err
+		}
+		counts[code] = count
+	}
+	return counts, rows.Err()
+}
+
+// EndpointError is the number of responses with one error code from one
+// endpoint.
+type EndpointError struct {
+	Endpoint string `json:"endpoint"`
+	Status   int    `json:"status"`
+	Count    int    `json:"count"`
+}
+
+// LoadErrors breaks the failed requests in the range down by endpoint and
+// status code, most frequent first.
+func LoadErrors(ctx context.Context, db *sql.DB, r Range) ([]EndpointError, error) {
+	rangeClause, args := r.where("timestamp")
+
+	rows, err := db.QueryContext(ctx, `
+        SELECT endpoint, response_code, COUNT(*) as count
+        FROM activity_log
+        WHERE response_code >= 400`+rangeClause+`
+        GROUP BY endpoint, response_code
+        ORDER BY count DESC, endpoint, response_code
+    `, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	errors := []EndpointError{}
+	for rows.Next() {
+		var e EndpointError
+		if err := rows.Scan(&e.Endpoint, &e.Status, &e.Count); err != nil {
+			return nil, err
+		}
+		errors = append(errors, e)
+	}
+	return errors, rows.Err()
+}
+
+// LoadStudentProgress returns per-student totals for the range, busiest
+// first.
+func LoadStudentProgress(ctx context.Context, db *sql.DB, r Range) ([]StudentProgress, error) {
+	rangeClause, args := r.where("timestamp")
+
+	rows, err := db.QueryContext(ctx, `
+        SELECT
+            name,
+            COUNT(*) as total_requests,
+            MIN(timestamp) as first_seen,
+            MAX(timestamp) as last_seen,
+            COUNT(DISTINCT session_id) as sessions
+        FROM activity_log
+        WHERE name IS NOT NULL
+          `+rangeClause+`
+        GROUP BY name
+        ORDER BY total_requests DESC, name
+    `, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	students := []StudentProgress{}
+	for rows.Next() {
+		var s StudentProgress
+		var firstSeen, lastSeen scanTime
+		if err := rows.Scan(&s.Name, &s.TotalRequests, &firstSeen, &lastSeen, &s.Sessions); err != nil {
+			return nil, err
+		}
+		s.FirstSeen, s.LastSeen = firstSeen.Time, lastSeen.Time
+		students = append(students, s)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return students, nil
+}
+
+// LoadInactiveStudents returns students seen in the range whose last
+// request was before cutoff, most recently seen first.
+func LoadInactiveStudents(ctx context.Context, db *sql.DB, r Range, cutoff time.Time) ([]InactiveStudent, error) {
+	rangeClause, args := r.where("timestamp")
+	args = append(args, sqliteTime(cutoff))
+
+	rows, err := db.QueryContext(ctx, `
+        SELECT name, MAX(timestamp) as last_seen
+        FROM activity_log
+        WHERE name IS NOT NULL
+          `+rangeClause+`
+        GROUP BY name
+        HAVING last_seen < ?
+        ORDER BY last_seen DESC
+    `, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	students := []InactiveStudent{}
+	for rows.Next() {
+		var s InactiveStudent
+		var lastSeen scanTime
+		if err := rows.Scan(&s.Name, &lastSeen); err != nil {
+			return nil, err
+		}
+		s.LastSeen = lastSeen.Time
+		students = append(students, s)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return students, nil
+}
+
+// LastSeen returns the time of name's most recent request, or the zero
+// time if name has never made one.
+func LastSeen(ctx context.Context, db *sql.DB, name string) (time.Time, error) {
+	var lastSeen scanTime
+	err := db.QueryRowContext(ctx, `
+        SELECT MAX(timestamp) FROM activity_log WHERE name = ?
+    `, name).Scan(&lastSeen)
+	if err != nil {
+		return time.Time{}, err
+	}
+	return lastSeen.Time, nil
+}
+
+// ActivityEntry is one row of activity_log.
+type ActivityEntry struct {
+	ID             int64     `json:"id"`
+	Timestamp      time.Time `json:"timestamp"`
+	Name           string    `json:"name"`
+	Endpoint       string    `json:"endpoint"`
+	SessionID      string    `json:"session_id"`
+	IPAddress      string    `json:"ip_address"`
+	UserAgent      string    `json:"user_agent"`
+	ResponseCode   int       `json:"response_code"`
+	ResponseTimeMs int       `json:"response_time_ms"`
+}
+
+const activityColumns = `
+        id, timestamp, COALESCE(name, ''), endpoint, COALESCE(session_id, ''),
+        COALESCE(ip_address, ''), COALESCE(user_agent, ''),
+        COALESCE(response_code, 0), COALESCE(response_time_ms, 0)`
+
+// LoadActivity returns the activity_log rows in the range in order,
+// optionally for one student.
+func LoadActivity(ctx context.Context, db *sql.DB, r Range, student string) ([]ActivityEntry, error) {
+	rangeClause, args := r.where("timestamp")
+	whereClause := "WHERE 1=1" + rangeClause
+
+	if student != "" {
+		whereClause += " AND name = ?"
+		args = append(args, student)
+	}
+
+	return queryActivity(ctx, db, `
+        SELECT `+activityColumns+`
+        FROM activity_log
+        `+whereClause+`
+        ORDER BY timestamp, id
+    `, args...)
+}
+
+// ActivityAfter returns up to limit activity_log rows with an id greater
+// than afterID, oldest first. Callers tail the log by passing the last id
+// they saw.
+func ActivityAfter(ctx context.Context, db *sql.DB, afterID int64, limit int) ([]ActivityEntry, error) {
+	return queryActivity(ctx, db, `
+        SELECT `+activityColumns+`
+        FROM activity_log
+        WHERE id > ?
+        ORDER BY id
+        LIMIT ?
+    `, afterID, limit)
+}
+
+// RecentActivity returns the last limit activity_log rows, oldest first.
+func RecentActivity(ctx context.Context, db *sql.DB, limit int) ([]ActivityEntry, error) {
+	return queryActivity(ctx, db, `
+        SELECT * FROM (
+            SELECT `+activityColumns+`
+            FROM activity_log
+            ORDER BY id DESC
+            LIMIT ?
+        ) ORDER BY id
+    `, limit)
+}
+
+func queryActivity(ctx context.Context, db *sql.DB, query string, args ...interface{}) ([]ActivityEntry, error) {
+	rows, err := db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	entries := []ActivityEntry{}
+	for rows.Next() {
+		var e ActivityEntry
+		var ts scanTime
+		if err := rows.Scan(&e.ID, &ts, &e.Name, &e.Endpoint, &e.SessionID,
+			&e.IPAddress, &e.UserAgent, &e.ResponseCode, &e.ResponseTimeMs); err != nil {
+			return nil, err
+		}
+		e.Timestamp = ts.Time
+		entries = append(entries, e)
+	}
+
+	return entries, rows.Err()
+}
+
+// UserMessage is one row of user_messages.
+type UserMessage struct {
+	MessageID string    `json:"message_id"`
+	CreatedAt time.Time `json:"created_at"`
+	From      string    `json:"from"`
+	To        string    `json:"to"`
+	Message   string    `json:"message"`
+	IPAddress string    `json:"ip_address"`
+}
+
+// LoadUserMessages returns the peer messages sent in the range in order,
+// optionally only those sent or received by student.
+func LoadUserMessages(ctx context.Context, db *sql.DB, r Range, student string) ([]UserMessage, error) {
+	rangeClause, args := r.times().where("created_at")
+	whereClause := "WHERE 1=1" + rangeClause
+
+	if student != "" {
+		whereClause += " AND (from_user = ? OR to_user = ?)"
+		args = append(args, student, student)
+	}
+
+	rows, err := db.QueryContext(ctx, `
+        SELECT message_id, created_at, from_user, to_user, message,
+               COALESCE(ip_address, '')
+        FROM user_messages
+        `+whereClause+`
+        ORDER BY created_at, message_id
+    `, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	messages := []UserMessage{}
+	for rows.Next() {
+		var m UserMessage
+		var ts scanTime
+		if err := rows.Scan(&m.MessageID, &ts, &m.From, &m.To, &m.Message, &m.IPAddress); err != nil {
+			return nil, err
+		}
+		m.CreatedAt = ts.Time
+		messages = append(messages, m)
+	}
+
+	return messages, rows.Err()
+}
+
+// MessageCount is how often one peer message was sent.
+type MessageCount struct {
+	Message string `json:"message"`
+	Count   int    `json:"count"`
+	Senders int    `json:"senders"`
+}
+
+// TopMessages returns the peer messages sent most often in the range, up
+// to limit.
+func TopMessages(ctx context.Context, db *sql.DB, r Range, limit int) ([]MessageCount, error) {
+	rangeClause, args := r.times().where("created_at")
+
+	rows, err := db.QueryContext(ctx, `
+        SELECT message, COUNT(*) as count, COUNT(DISTINCT from_user)
+        FROM user_messages
+        WHERE 1=1`+rangeClause+`
+        GROUP BY message
+        ORDER BY count DESC, message
+        LIMIT ?
+    `, append(args, limit)...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	messages := []MessageCount{}
+	for rows.Next() {
+		var m MessageCount
+		if err := rows.Scan(&m.Message, &m.Count, &m.Senders); err != nil {
+			return nil, err
+		}
+		messages = append(messages, m)
+	}
+	return messages, rows.Err()
+}
+
+// AliasUsage is how often a deprecated alias was called instead of the
+// endpoint it stands for.
+type AliasUsage struct {
+	Alias    string `json:"alias"`
+	Endpoint string `json:"endpoint"`
+	Requests int    `json:"requests"`
+	// Students are the named students who used it, alphabetically.
+	Students []string  `json:"students"`
+	LastSeen time.Time `json:"last_seen"`
+}
+
+// LoadAliasUsage returns the deprecated aliases used in the range, most
+// used first. Databases from before aliases were logged have none.
+func LoadAliasUsage(ctx context.Context, db *sql.DB, r Range) ([]AliasUsage, error) {
+	usage := []AliasUsage{}
+	if ok, err := hasColumn(ctx, db, "activity_log", "alias"); err != nil || !ok {
+		return usage, err
+	}
+
+	rangeClause, args := r.where("timestamp")
+	rows, err := db.QueryContext(ctx, `
+        SELECT alias, endpoint, COALESCE(name, ''), COUNT(*), MAX(timestamp)
+        FROM activity_log
+        WHERE alias IS NOT NULL
+          `+rangeClause+`
+        GROUP BY alias, endpoint, name
+        ORDER BY alias, endpoint, name
+    `, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var alias, endpoint, name string
+		var count int
+		var lastSeen scanTime
+		if err := rows.Scan(&alias, &endpoint, &name, &count, &lastSeen); err != nil {
+			return nil, err
+		}
+		n := len(usage)
+		if n == 0 || usage[n-1].Alias != alias || usage[n-1].Endpoint != endpoint {
+			usage = append(usage, AliasUsage{Alias: alias, Endpoint: endpoint, Students: []string{}})
+			n++
+		}
+		u := &usage[n-1]
+		u.Requests += count
+		if name != "" {
+			u.Students = append(u.Students, name)
+		}
+		if lastSeen.Time.After(u.LastSeen) {
+			u.LastSeen = lastSeen.Time
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	sort.SliceStable(usage, func(i, j int) bool { return usage[i].Requests > usage[j].Requests })
+	return usage, nil
+}
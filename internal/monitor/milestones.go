@@ -0,0 +1,267 @@
+package monitor
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Milestone is a declarative description of an observable step in
+// EXERCISES.md. A student reaches it once Count of their requests to
+// Endpoint have ended with one of Status.
+type Milestone struct {
+	ID       string `json:"id"`
+	Label    string `json:"label"`
+	Exercise string `json:"exercise,omitempty"`
+	// Endpoint is the logged endpoint, e.g. "/automessage". Empty matches
+	// every endpoint.
+	Endpoint string `json:"endpoint,omitempty"`
+	// Status lists the response codes that count. Empty means any 2xx.
+	Status []int `json:"status,omitempty"`
+	// AfterStatus, when set, only counts requests made after the student
+	// got one of these codes from the same endpoint, e.g. a success
+	// following a 400.
+	AfterStatus []int `json:"after_status,omitempty"`
+	// Count is the number of matching requests needed; zero means one.
+	Count int `json:"count,omitempty"`
+}
+
+// DefaultMilestones follows the progression in EXERCISES.md.
+var DefaultMilestones = []Milestone{
+	{
+		ID:       "fetch",
+		Label:    "First 200 on /automessage",
+		Exercise: "Exercise 1",
+		Endpoint: "/automessage",
+		Status:   []int{200},
+	},
+	{
+		ID:       "history",
+		Label:    "Fetched 5 messages to store",
+		Exercise: "Exercise 5",
+		Endpoint: "/automessage",
+		Status:   []int{200},
+		Count:    5,
+	},
+	{
+		ID:       "send",
+		Label:    "First 201 on /message",
+		Exercise: "Exercise 6",
+		Endpoint: "/message",
+		Status:   []int{201},
+	},
+	{
+		ID:       "inbox",
+		Label:    "Read /messages",
+		Exercise: "Exercise 6",
+		Endpoint: "/messages",
+		Status:   []int{200},
+	},
+	{
+		ID:          "retry",
+		Label:       "Got a 400, then retried successfully",
+		Exercise:    "Exercise 7",
+		AfterStatus: []int{400},
+	},
+	{
+		ID:       "refresh",
+		Label:    "Polled /messages 5 times",
+		Exercise: "Bonus 3",
+		Endpoint: "/messages",
+		// Clients that poll with If-None-Match get 304s
+		Status: []int{200, 304},
+		Count:  5,
+	},
+}
+
+// LoadMilestones reads a JSON array of milestones.
+func LoadMilestones(r io.Reader) ([]Milestone, error) {
+	var milestones []Milestone
+	if err := json.NewDecoder(r).Decode(&milestones); err != nil {
+		return nil, fmt.Errorf("failed to parse milestones: %w", err)
+	}
+
+	seen := map[string]bool{}
+	for i, m := range milestones {
+		if m.ID == "" {
+			return nil, fmt.Errorf("milestone %d has no id", i+1)
+		}
+		if seen[m.ID] {
+			return nil, fmt.Errorf("duplicate milestone id %q", m.ID)
+		}
+		seen[m.ID] = true
+		if m.Count < 0 {
+			return nil, fmt.Errorf("milestone %q has a negative count", m.ID)
+		}
+	}
+	return milestones, nil
+}
+
+func (m Milestone) matches(endpoint string, code int) bool {
+	if m.Endpoint != "" && m.Endpoint != endpoint {
+		return false
+	}
+	if len(m.Status) == 0 {
+		return code >= 200 && code < 300
+	}
+	return containsCode(m.Status, code)
+}
+
+func (m Milestone) needed() int {
+	if m.Count > 0 {
+		return m.Count
+	}
+	return 1
+}
+
+func containsCode(codes []int, code int) bool {
+	for _, c := range codes {
+		if c == code {
+			return true
+		}
+	}
+	return false
+}
+
+// MilestoneProgress records when a student reached each milestone.
+// Reached is indexed like the milestone list; zero means not yet.
+type MilestoneProgress struct {
+	Name    string
+	Reached []time.Time
+}
+
+// Done returns how many milestones the student has reached.
+func (p MilestoneProgress) Done() int {
+	n := 0
+	for _, t := range p.Reached {
+		if !t.IsZero() {
+			n++
+		}
+	}
+	return n
+}
+
+// ReachedByID maps each milestone ID to when it was reached, or nil.
+func (p MilestoneProgress) ReachedByID(milestones []Milestone) map[string]*time.Time {
+	reached := make(map[string]*time.Time, len(milestones))
+	for i, m := range milestones {
+		if i < len(p.Reached) {
+			reached[m.ID] = OptionalTime(p.Reached[i])
+		}
+	}
+	return reached
+}
+
+// milestoneState tracks one student's progress towards one milestone.
+type milestoneState struct {
+	count   int
+	primed  map[string]bool // endpoints that have returned an AfterStatus code
+	reached time.Time
+}
+
+// ExerciseProgress evaluates milestones against the named activity in the
+// range. With a session, only that session's requests count and rostered
+// students with no activity are included. Students are ordered by
+// milestones reached, then name.
+func ExerciseProgress(ctx context.Context, db *sql.DB, milestones []Milestone, session string, r Range) ([]MilestoneProgress, error) {
+	rangeClause, args := r.where("timestamp")
+	query := `
+        SELECT name, endpoint, COALESCE(response_code, 0), timestamp
+        FROM activity_log
+        WHERE name IS NOT NULL AND name != ''
+    ` + rangeClause
+	if session != "" {
+		query += ` AND session_id = ?`
+		args = append(args, session)
+	}
+	query += ` ORDER BY id`
+
+	rows, err := db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var order []string
+	states := map[string][]milestoneState{}
+	names := map[string]string{}
+
+	for rows.Next() {
+		var name, endpoint string
+		var code int
+		var ts scanTime
+		if err := rows.Scan(&name, &endpoint, &code, &ts); err != nil {
+			return nil, err
+		}
+
+		key := rosterKey(name)
+		st, ok := states[key]
+		if !ok {
+			st = make([]milestoneState, len(milestones))
+			states[key] = st
+			names[key] = name
+			order = append(order, key)
+		}
+
+		for i, m := range milestones {
+			s := &st[i]
+			if !s.reached.IsZero() {
+				continue
+			}
+			counts := len(m.AfterStatus) == 0 || s.primed[endpoint]
+			if counts && m.matches(endpoint, code) {
+				s.count++
+				if s.count >= m.needed() {
+					s.reached = ts.Time
+				}
+			}
+			if containsCode(m.AfterStatus, code) {
+				if s.primed == nil {
+					s.primed = map[string]bool{}
+				}
+				s.primed[endpoint] = true
+			}
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	if session != "" {
+		rostered, err := RosterNames(ctx, db, session)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load roster: %w", err)
+		}
+		for _, name := range rostered {
+			key := rosterKey(name)
+			if _, ok := states[key]; !ok {
+				states[key] = make([]milestoneState, len(milestones))
+				order = append(order, key)
+			}
+			names[key] = name
+		}
+	}
+
+	progress := make([]MilestoneProgress, 0, len(order))
+	for _, key := range order {
+		p := MilestoneProgress{Name: names[key], Reached: make([]time.Time, len(milestones))}
+		for i, s := range states[key] {
+			p.Reached[i] = s.reached
+		}
+		progress = append(progress, p)
+	}
+
+	sort.SliceStable(progress, func(i, j int) bool {
+		if di, dj := progress[i].Done(), progress[j].Done(); di != dj {
+			return di > dj
+		}
+		return strings.ToLower(progress[i].Name) < strings.ToLower(progress[j].Name)
+	})
+
+	return progress, nil
+}
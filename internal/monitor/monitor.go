@@ -0,0 +1,221 @@
+// Package monitor holds the activity_log queries shared by the happywatch
+// CLI and the happywatch CGI dashboard.
+//
+// Timestamps are stored the way SQLite's CURRENT_TIMESTAMP writes them:
+// UTC text such as "2025-10-14 01:02:03". Times are converted to that form
+// before they are compared with a column, and scanned back as UTC; only
+// display code turns them into local time.
+package monitor
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// sqliteTimeFormats are the layouts SQLite hands back for DATETIME values
+// once the column type has been lost, e.g. through MAX() or a subquery.
+var sqliteTimeFormats = []string{
+	"2006-01-02 15:04:05.999999999-07:00",
+	"2006-01-02T15:04:05.999999999-07:00",
+	"2006-01-02 15:04:05.999999999",
+	"2006-01-02T15:04:05.999999999",
+	"2006-01-02 15:04",
+	"2006-01-02",
+}
+
+// scanTime is a sql.Scanner for timestamp columns. go-sqlite3 only converts
+// values to time.Time when the declared column type says so, so aggregates
+// like MAX(timestamp) arrive as text and have to be parsed here.
+type scanTime struct {
+	Time time.Time
+}
+
+func (st *scanTime) Scan(value interface{}) error {
+	switch v := value.(type) {
+	case nil:
+		st.Time = time.Time{}
+		return nil
+	case time.Time:
+		st.Time = v.UTC()
+		return nil
+	case []byte:
+		return st.parse(string(v))
+	case string:
+		return st.parse(v)
+	}
+	return fmt.Errorf("cannot scan %T into timestamp", value)
+}
+
+func (st *scanTime) parse(s string) error {
+	s = strings.TrimSuffix(s, "Z")
+	for _, layout := range sqliteTimeFormats {
+		if t, err := time.ParseInLocation(layout, s, time.UTC); err == nil {
+			st.Time = t.UTC()
+			return nil
+		}
+	}
+	return fmt.Errorf("unrecognised timestamp %q", s)
+}
+
+// Range bounds a query to activity in [Since, Until). A zero bound is left
+// open, so the zero Range covers everything. Session, when set, further
+// limits activity_log queries to one training session.
+type Range struct {
+	Since   time.Time
+	Until   time.Time
+	Session string
+}
+
+// localTimeFormats are the layouts ParseTime accepts for times without a
+// zone, which are taken to be in the caller's location.
+var localTimeFormats = []string{
+	"2006-01-02",
+	"2006-01-02 15:04",
+	"2006-01-02T15:04",
+	"2006-01-02 15:04:05",
+	"2006-01-02T15:04:05",
+}
+
+// ParseTime reads a time given on the command line or in a query string:
+// RFC3339 ("2025-10-14T09:00:00+08:00"), a duration before now ("30m" or
+// "2h"), or a date ("2025-10-14", meaning midnight) or date and time
+// ("2025-10-14 09:00") in loc.
+func ParseTime(value string, now time.Time, loc *time.Location) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, nil
+	}
+	if d, err := time.ParseDuration(value); err == nil {
+		if d <= 0 {
+			return time.Time{}, fmt.Errorf("invalid time %q: durations count back from now and must be positive", value)
+		}
+		return now.Add(-d), nil
+	}
+	for _, layout := range localTimeFormats {
+		if t, err := time.ParseInLocation(layout, value, loc); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("invalid time %q: expected RFC3339 (2025-10-14T09:00:00+08:00), a date (2025-10-14), a date and time (2025-10-14 09:00) or a duration (30m)", value)
+}
+
+// Last returns the range covering d up to now.
+func Last(d time.Duration) Range {
+	return Range{Since: time.Now().Add(-d)}
+}
+
+// where returns SQL conditions restricting column to the range, each
+// starting with AND, and their arguments.
+func (r Range) where(column string) (string, []interface{}) {
+	clause := ""
+	var args []interface{}
+
+	if !r.Since.IsZero() {
+		clause += " AND " + column + " >= ?"
+		args = append(args, sqliteTime(r.Since))
+	}
+	if !r.Until.IsZero() {
+		clause += " AND " + column + " < ?"
+		args = append(args, sqliteTime(r.Until))
+	}
+	if r.Session != "" {
+		clause += " AND session_id = ?"
+		args = append(args, r.Session)
+	}
+
+	return clause, args
+}
+
+// times returns the range without its session, for tables such as
+// user_messages that do not record one.
+func (r Range) times() Range {
+	return Range{Since: r.Since, Until: r.Until}
+}
+
+// SessionRange returns the range from a session's first request to just
+// after its last, limited to that session. Since is zero when the session
+// has no activity.
+func SessionRange(ctx context.Context, db *sql.DB, session string) (Range, error) {
+	var first, last scanTime
+	err := db.QueryRowContext(ctx, `
+        SELECT MIN(timestamp), MAX(timestamp)
+        FROM activity_log
+        WHERE session_id = ?
+    `, session).Scan(&first, &last)
+	if err != nil {
+		return Range{}, err
+	}
+	r := Range{Session: session}
+	if !first.Time.IsZero() {
+		// Timestamps are stored to the second
+		r.Since, r.Until = first.Time, last.Time.Add(time.Second)
+	}
+	return r, nil
+}
+
+// sqliteTime formats t the way CURRENT_TIMESTAMP stores it, so that it
+// compares correctly against the timestamp column.
+func sqliteTime(t time.Time) string {
+	return t.UTC().Format("2006-01-02 15:04:05")
+}
+
+// OptionalTime turns a zero time into a JSON null.
+func OptionalTime(t time.Time) *time.Time {
+	if t.IsZero() {
+		return nil
+	}
+	return &t
+}
+
+// Printable replaces the control characters in s with \xNN escapes, so
+// that names, endpoints and user agents from requests cannot move the
+// cursor, retitle the window or clear the screen when they are written to
+// a terminal.
+func Printable(s string) string {
+	if strings.IndexFunc(s, isControl) < 0 {
+		return s
+	}
+	var b strings.Builder
+	for _, r := range s {
+		if isControl(r) {
+			fmt.Fprintf(&b, "\\x%02x", r)
+			continue
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+// isControl reports whether r is a C0 or C1 control character or DEL.
+func isControl(r rune) bool {
+	return r < 0x20 || (r >= 0x7f && r < 0xa0)
+}
+
+// hasTable reports whether the database contains the named table. Tables
+// added after the original schema may be missing on older deployments.
+func hasTable(ctx context.Context, db *sql.DB, name string) (bool, error) {
+	var count int
+	err := db.QueryRowContext(ctx, `
+        SELECT COUNT(*) FROM sqlite_master
+        WHERE type = 'table' AND name = ?
+    `, name).Scan(&count)
+	if err != nil {
+		return false, err
+	}
+	return count > 0, nil
+}
+
+// hasColumn reports whether table has the named column. Columns added by
+// later schema versions are missing until init-db has been run.
+func hasColumn(ctx context.Context, db *sql.DB, table, column string) (bool, error) {
+	var count int
+	err := db.QueryRowContext(ctx, `
+        SELECT COUNT(*) FROM pragma_table_info(?) WHERE name = ?
+    `, table, column).Scan(&count)
+	if err != nil {
+		return false, err
+	}
+	return count > 0, nil
+}
@@ -0,0 +1,826 @@
+package monitor
+
+import (
+	"context"
+	"database/sql"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	_ "github.com/mattn/go-sqlite3"
+)
+
+const fixtureSchema = `
+CREATE TABLE activity_log (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    timestamp DATETIME DEFAULT CURRENT_TIMESTAMP,
+    endpoint TEXT NOT NULL,
+    name TEXT,
+    session_id TEXT,
+    ip_address TEXT,
+    user_agent TEXT,
+    response_code INTEGER,
+    response_time_ms INTEGER
+);
+
+CREATE TABLE user_messages (
+    message_id TEXT PRIMARY KEY,
+    from_user TEXT NOT NULL,
+    to_user TEXT NOT NULL,
+    message TEXT NOT NULL,
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    ip_address TEXT
+);
+`
+
+// fixtureNow is the reference time the fixture's rows are placed around.
+var fixtureNow = time.Now().UTC().Truncate(time.Second)
+
+// openFixture returns an in-memory database with the activity_log and
+// user_messages tables. A single connection keeps every query on the same
+// in-memory database.
+func openFixture(t *testing.T) *sql.DB {
+	t.Helper()
+
+	db, err := sql.Open("sqlite3", ":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	db.SetMaxOpenConns(1)
+	t.Cleanup(func() { db.Close() })
+
+	if _, err := db.Exec(fixtureSchema); err != nil {
+		t.Fatal(err)
+	}
+	return db
+}
+
+type fixtureRequest struct {
+	ago      time.Duration
+	name     string
+	session  string
+	endpoint string
+	code     int
+}
+
+func logRequests(t *testing.T, db *sql.DB, reqs ...fixtureRequest) {
+	t.Helper()
+	for _, r := range reqs {
+		_, err := db.Exec(`
+            INSERT INTO activity_log (timestamp, endpoint, name, session_id, response_code, response_time_ms)
+            VALUES (?, ?, NULLIF(?, ''), NULLIF(?, ''), ?, 5)
+        `, sqliteTime(fixtureNow.Add(-r.ago)), r.endpoint, r.name, r.session, r.code)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestLiveUsers(t *testing.T) {
+	db := openFixture(t)
+	logRequests(t, db,
+		fixtureRequest{2 * time.Hour, "ada", "s1", "/automessage", 200},
+		fixtureRequest{10 * time.Minute, "ada", "s1", "/automessage", 200},
+		fixtureRequest{5 * time.Minute, "ada", "s1", "/message", 400},
+		fixtureRequest{5 * time.Minute, "ada", "s1", "/message", 201},
+		fixtureRequest{time.Minute, "grace", "s1", "/messages", 200},
+		fixtureRequest{time.Minute, "", "", "/automessage", 400},
+	)
+
+	users, err := LiveUsers(context.Background(), db, Range{Since: fixtureNow.Add(-time.Hour)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(users) != 2 {
+		t.Fatalf("got %d live users, want 2: %+v", len(users), users)
+	}
+
+	grace, ada := users[0], users[1]
+	if grace.Name != "grace" || ada.Name != "ada" {
+		t.Fatalf("got order %q, %q; want grace, ada", grace.Name, ada.Name)
+	}
+	// Two requests in the same second: the later row wins
+	if ada.Endpoint != "/message" || ada.TotalCount != 3 || ada.ErrorCount != 1 {
+		t.Errorf("ada = %+v, want /message with 3 requests and 1 error", ada)
+	}
+	if !ada.LastSeen.Equal(fixtureNow.Add(-5 * time.Minute)) {
+		t.Errorf("ada last seen %v, want %v", ada.LastSeen, fixtureNow.Add(-5*time.Minute))
+	}
+}
+
+func TestLoadSummary(t *testing.T) {
+	db := openFixture(t)
+	logRequests(t, db,
+		fixtureRequest{3 * time.Hour, "ada", "s1", "/automessage", 200},
+		fixtureRequest{30 * time.Minute, "ada", "s1", "/automessage", 200},
+		fixtureRequest{20 * time.Minute, "ada", "s1", "/automessage", 200},
+		fixtureRequest{10 * time.Minute, "grace", "s1", "/message", 400},
+		fixtureRequest{5 * time.Minute, "", "", "/status", 200},
+	)
+
+	s, err := LoadSummary(context.Background(), db, Range{Since: fixtureNow.Add(-2 * time.Hour)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s.TotalRequests != 4 || s.Students != 2 || s.ErrorCount != 1 {
+		t.Errorf("summary = %+v, want 4 requests, 2 students, 1 error", s)
+	}
+	if s.ErrorRate != 25 {
+		t.Errorf("error rate %.1f, want 25", s.ErrorRate)
+	}
+	if len(s.Endpoints) != 3 || s.Endpoints[0] != (EndpointCount{"/automessage", 2}) {
+		t.Errorf("endpoints = %+v, want /automessage first with 2", s.Endpoints)
+	}
+
+	counts, err := LoadCounts(context.Background(), db, Range{Since: fixtureNow.Add(-2 * time.Hour)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if counts.TotalRequests != s.TotalRequests || counts.Students != s.Students ||
+		counts.ErrorCount != s.ErrorCount || counts.ErrorRate != s.ErrorRate || counts.Endpoints != nil {
+		t.Errorf("counts = %+v, want the summary's totals without endpoints", counts)
+	}
+
+	empty, err := LoadSummary(context.Background(), db, Range{Since: fixtureNow.Add(time.Hour)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if empty.TotalRequests != 0 || empty.ErrorRate != 0 || empty.Endpoints == nil {
+		t.Errorf("empty summary = %+v, want zero totals and a non-nil endpoint list", empty)
+	}
+}
+
+func TestRangeBounds(t *testing.T) {
+	db := openFixture(t)
+	logRequests(t, db,
+		fixtureRequest{3 * time.Hour, "ada", "s1", "/automessage", 200},
+		fixtureRequest{2 * time.Hour, "ada", "s1", "/message", 201},
+		fixtureRequest{time.Hour, "ada", "s1", "/messages", 200},
+	)
+
+	tests := []struct {
+		name string
+		r    Range
+		want []string
+	}{
+		{"open", Range{}, []string{"/automessage", "/message", "/messages"}},
+		{"since is inclusive", Range{Since: fixtureNow.Add(-2 * time.Hour)}, []string{"/message", "/messages"}},
+		{"until is exclusive", Range{Until: fixtureNow.Add(-2 * time.Hour)}, []string{"/automessage"}},
+		{"both", Range{Since: fixtureNow.Add(-150 * time.Minute), Until: fixtureNow.Add(-90 * time.Minute)}, []string{"/message"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			entries, err := LoadActivity(context.Background(), db, tt.r, "")
+			if err != nil {
+				t.Fatal(err)
+			}
+			var got []string
+			for _, e := range entries {
+				got = append(got, e.Endpoint)
+			}
+			if strings.Join(got, ",") != strings.Join(tt.want, ",") {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLoadStudentProgressAndInactive(t *testing.T) {
+	db := openFixture(t)
+	logRequests(t, db,
+		fixtureRequest{5 * time.Hour, "linus", "s0", "/automessage", 200},
+		fixtureRequest{time.Hour, "ada", "s1", "/automessage", 200},
+		fixtureRequest{50 * time.Minute, "ada", "s2", "/automessage", 200},
+		fixtureRequest{40 * time.Minute, "grace", "s1", "/automessage", 200},
+		fixtureRequest{2 * time.Minute, "grace", "s1", "/message", 201},
+		fixtureRequest{time.Minute, "grace", "s1", "/messages", 200},
+	)
+	ctx := context.Background()
+
+	students, err := LoadStudentProgress(ctx, db, Range{Since: fixtureNow.Add(-4 * time.Hour)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(students) != 2 {
+		t.Fatalf("got %d students, want 2: %+v", len(students), students)
+	}
+	if students[0].Name != "grace" || students[0].TotalRequests != 3 {
+		t.Errorf("first student = %+v, want grace with 3 requests", students[0])
+	}
+	if students[1].Name != "ada" || students[1].Sessions != 2 {
+		t.Errorf("second student = %+v, want ada with 2 sessions", students[1])
+	}
+	if !students[1].FirstSeen.Equal(fixtureNow.Add(-time.Hour)) {
+		t.Errorf("ada first seen %v, want %v", students[1].FirstSeen, fixtureNow.Add(-time.Hour))
+	}
+
+	inactive, err := LoadInactiveStudents(ctx, db, Range{}, fixtureNow.Add(-15*time.Minute))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(inactive) != 2 || inactive[0].Name != "ada" || inactive[1].Name != "linus" {
+		t.Errorf("inactive = %+v, want ada then linus", inactive)
+	}
+
+	seen, err := LastSeen(ctx, db, "linus")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !seen.Equal(fixtureNow.Add(-5 * time.Hour)) {
+		t.Errorf("linus last seen %v, want %v", seen, fixtureNow.Add(-5*time.Hour))
+	}
+	if seen, err := LastSeen(ctx, db, "nobody"); err != nil || !seen.IsZero() {
+		t.Errorf("nobody last seen %v (%v), want zero time", seen, err)
+	}
+}
+
+func TestActivityAfter(t *testing.T) {
+	db := openFixture(t)
+	logRequests(t, db,
+		fixtureRequest{3 * time.Minute, "ada", "s1", "/automessage", 200},
+		fixtureRequest{2 * time.Minute, "", "", "/automessage", 400},
+		fixtureRequest{time.Minute, "grace", "s1", "/message", 201},
+	)
+
+	entries, err := ActivityAfter(context.Background(), db, 1, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 2 || entries[0].ID != 2 || entries[1].ID != 3 {
+		t.Fatalf("got %+v, want ids 2 and 3", entries)
+	}
+	if entries[0].Name != "" || entries[0].ResponseCode != 400 {
+		t.Errorf("anonymous entry = %+v", entries[0])
+	}
+
+	limited, err := ActivityAfter(context.Background(), db, 0, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(limited) != 1 || limited[0].ID != 1 {
+		t.Errorf("limited = %+v, want only id 1", limited)
+	}
+
+	recent, err := RecentActivity(context.Background(), db, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(recent) != 2 || recent[0].ID != 2 || recent[1].ID != 3 {
+		t.Errorf("recent = %+v, want ids 2 and 3", recent)
+	}
+}
+
+func TestLoadUserMessages(t *testing.T) {
+	db := openFixture(t)
+	for i, m := range []struct{ from, to string }{{"ada", "grace"}, {"grace", "linus"}, {"linus", "ada"}} {
+		_, err := db.Exec(`
+            INSERT INTO user_messages (message_id, from_user, to_user, message, created_at)
+            VALUES (?, ?, ?, 'hi', ?)
+        `, string(rune('a'+i)), m.from, m.to, sqliteTime(fixtureNow.Add(time.Duration(i)*time.Minute)))
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	messages, err := LoadUserMessages(context.Background(), db, Range{}, "ada")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(messages) != 2 || messages[0].To != "grace" || messages[1].From != "linus" {
+		t.Errorf("messages = %+v, want ada's sent then received message", messages)
+	}
+}
+
+func TestRosterReport(t *testing.T) {
+	db := openFixture(t)
+	ctx := context.Background()
+
+	n, err := ImportRoster(ctx, db, "", strings.NewReader("name,session_id\nAda,s1\ngrace,s1\nlinus,s1\nmargaret,s1\nbarbara,s1\nada,s2\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 6 {
+		t.Errorf("imported %d, want 6", n)
+	}
+
+	logRequests(t, db,
+		fixtureRequest{time.Minute, "ada", "s1", "/automessage", 200},
+		fixtureRequest{3 * time.Minute, "grace", "s1", "/automessage", 400},
+		fixtureRequest{2 * time.Minute, "grace", "s1", "/automessage", 400},
+		fixtureRequest{time.Hour, "margaret", "s2", "/automessage", 200},
+		fixtureRequest{time.Hour, "margaret", "s1", "/automessage", 200},
+		fixtureRequest{time.Hour, "barbara", "s1", "/message", 201},
+	)
+	for i := 0; i < 10; i++ {
+		// margaret's messages keep being rejected; barbara is polling for
+		// replies, as the auto-refresh exercise asks, with one hiccup
+		posted, polled := 400, 200
+		if i == 4 {
+			posted, polled = 201, 500
+		}
+		ago := 30*time.Minute - time.Duration(i)*time.Minute
+		logRequests(t, db,
+			fixtureRequest{ago, "margaret", "s1", "/message", posted},
+			fixtureRequest{ago, "barbara", "s1", "/messages", polled},
+		)
+	}
+
+	report, err := RosterReport(ctx, db, "s1", DefaultRosterOptions, fixtureNow)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got := map[string]RosterStatus{}
+	for _, s := range report {
+		got[s.Name] = s.Status
+	}
+	want := map[string]RosterStatus{
+		"Ada":      RosterOK,
+		"grace":    RosterFailing,
+		"linus":    RosterAbsent,
+		"margaret": RosterStuck,
+		"barbara":  RosterOK,
+	}
+	for name, status := range want {
+		if got[name] != status {
+			t.Errorf("%s: got %q, want %q", name, got[name], status)
+		}
+	}
+	if report[0].Name != "linus" || report[len(report)-1].Status != RosterOK {
+		t.Errorf("report order %+v, want problems first", report)
+	}
+}
+
+func TestExerciseProgress(t *testing.T) {
+	db := openFixture(t)
+	logRequests(t, db,
+		fixtureRequest{10 * time.Minute, "ada", "s1", "/message", 400},
+		fixtureRequest{9 * time.Minute, "ada", "s1", "/message", 201},
+		fixtureRequest{8 * time.Minute, "grace", "s1", "/message", 201},
+		fixtureRequest{7 * time.Minute, "grace", "s1", "/message", 400},
+	)
+
+	progress, err := ExerciseProgress(context.Background(), db, DefaultMilestones, "s1", Range{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(progress) != 2 {
+		t.Fatalf("got %d students, want 2", len(progress))
+	}
+
+	reached := map[string]map[string]*time.Time{}
+	for _, p := range progress {
+		reached[p.Name] = p.ReachedByID(DefaultMilestones)
+	}
+
+	// A success only counts for retry when it follows a 400
+	if at := reached["ada"]["retry"]; at == nil || !at.Equal(fixtureNow.Add(-9*time.Minute)) {
+		t.Errorf("ada retry = %v, want %v", at, fixtureNow.Add(-9*time.Minute))
+	}
+	if reached["grace"]["retry"] != nil {
+		t.Errorf("grace reached retry without retrying")
+	}
+	if reached["ada"]["send"] == nil || reached["grace"]["send"] == nil {
+		t.Errorf("both students should have reached send")
+	}
+	if progress[0].Name != "ada" {
+		t.Errorf("got %q first, want ada with the most milestones", progress[0].Name)
+	}
+}
+
+func TestPrintable(t *testing.T) {
+	tests := []struct {
+		in, want string
+	}{
+		{"Alice", "Alice"},
+		{"Zoë 😀", "Zoë 😀"},
+		{"\x1b[2J", `\x1b[2J`},
+		{"a\tb\r\n", `a\x09b\x0d\x0a`},
+		{"\x7f\u009b31m", `\x7f\x9b31m`},
+	}
+	for _, tt := range tests {
+		if got := Printable(tt.in); got != tt.want {
+			t.Errorf("Printable(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestScanTime(t *testing.T) {
+	want := time.Date(2025, 10, 14, 1, 2, 3, 0, time.UTC)
+
+	for _, v := range []interface{}{
+		"2025-10-14 01:02:03",
+		"2025-10-14T01:02:03Z",
+		[]byte("2025-10-14 01:02:03"),
+		want,
+	} {
+		var st scanTime
+		if err := st.Scan(v); err != nil {
+			t.Errorf("Scan(%v): %v", v, err)
+			continue
+		}
+		if !st.Time.Equal(want) {
+			t.Errorf("Scan(%v) = %v, want %v", v, st.Time, want)
+		}
+	}
+
+	var st scanTime
+	if err := st.Scan(nil); err != nil || !st.Time.IsZero() {
+		t.Errorf("Scan(nil) = %v, %v; want zero time", st.Time, err)
+	}
+	if err := st.Scan("yesterday"); err == nil {
+		t.Errorf("Scan(\"yesterday\") succeeded, want an error")
+	}
+}
+
+func TestRequestsPerMinute(t *testing.T) {
+	db := openFixture(t)
+	minute := fixtureNow.Truncate(time.Minute)
+	logRequests(t, db,
+		fixtureRequest{fixtureNow.Sub(minute.Add(-5 * time.Minute)), "ada", "s1", "/automessage", 200},
+		fixtureRequest{fixtureNow.Sub(minute.Add(-5*time.Minute + 30*time.Second)), "ada", "s1", "/message", 400},
+		fixtureRequest{fixtureNow.Sub(minute.Add(-2 * time.Minute)), "grace", "s1", "/automessage", 200},
+	)
+
+	r := Range{Since: minute.Add(-6 * time.Minute), Until: minute.Add(-time.Minute)}
+	buckets, err := RequestsPerMinute(context.Background(), db, r)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Minutes -6 to -2, with the quiet ones filled in
+	want := []MinuteBucket{
+		{minute.Add(-6 * time.Minute), 1, 0, 0},
+		{minute.Add(-5 * time.Minute), 1, 2, 1},
+		{minute.Add(-4 * time.Minute), 1, 0, 0},
+		{minute.Add(-3 * time.Minute), 1, 0, 0},
+		{minute.Add(-2 * time.Minute), 1, 1, 0},
+	}
+	if len(buckets) != len(want) {
+		t.Fatalf("got %d buckets, want %d: %+v", len(buckets), len(want), buckets)
+	}
+	for i := range want {
+		if !buckets[i].Minute.Equal(want[i].Minute) || buckets[i].Requests != want[i].Requests || buckets[i].Errors != want[i].Errors {
+			t.Errorf("bucket %d = %+v, want %+v", i, buckets[i], want[i])
+		}
+	}
+	if rate := buckets[1].ErrorRate(); rate != 50 {
+		t.Errorf("error rate %.1f, want 50", rate)
+	}
+}
+
+func TestRequestsPerMinuteLongRange(t *testing.T) {
+	db := openFixture(t)
+	logRequests(t, db,
+		fixtureRequest{30 * 24 * time.Hour, "ada", "s1", "/automessage", 200},
+		fixtureRequest{time.Hour, "ada", "s1", "/message", 400},
+	)
+
+	tests := []struct {
+		name    string
+		r       Range
+		minutes int
+	}{
+		{"day", Range{Since: fixtureNow.Add(-20 * time.Hour)}, 1},
+		{"week", Range{Since: fixtureNow.Add(-7 * 24 * time.Hour)}, 15},
+		{"month", Range{Since: fixtureNow.Add(-31 * 24 * time.Hour)}, 60},
+		{"ten years", Range{Since: fixtureNow.AddDate(-10, 0, 0)}, 1440 * 3},
+		{"everything", Range{}, 60},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			buckets, err := RequestsPerMinute(context.Background(), db, tt.r)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(buckets) == 0 || len(buckets) > MaxBuckets {
+				t.Fatalf("got %d buckets, want 1 to %d", len(buckets), MaxBuckets)
+			}
+			requests, errors := 0, 0
+			for _, b := range buckets {
+				if b.Minutes != tt.minutes {
+					t.Fatalf("bucket %v is %d minutes wide, want %d", b.Minute, b.Minutes, tt.minutes)
+				}
+				requests += b.Requests
+				errors += b.Errors
+			}
+			wantRequests := 2
+			if !tt.r.Since.IsZero() && tt.r.Since.After(fixtureNow.Add(-30*24*time.Hour)) {
+				wantRequests = 1
+			}
+			if requests != wantRequests || errors != 1 {
+				t.Errorf("got %d requests and %d errors, want %d and 1", requests, errors, wantRequests)
+			}
+		})
+	}
+}
+
+func TestLatencyOf(t *testing.T) {
+	var times []int
+	for ms := 1; ms <= 100; ms++ {
+		times = append(times, ms)
+	}
+	times = append(times, 2000)
+
+	l := latencyOf(times)
+	if l.Count != 101 || l.P50 != 51 || l.P95 != 96 || l.P99 != 100 || l.Max != 2000 {
+		t.Errorf("latency = %+v", l)
+	}
+
+	counts := map[int]int{}
+	for _, b := range l.Buckets {
+		counts[b.UpperMs] = b.Count
+	}
+	if counts[5] != 5 || counts[10] != 5 || counts[100] != 50 || counts[0] != 1 {
+		t.Errorf("buckets = %+v", l.Buckets)
+	}
+
+	if empty := latencyOf(nil); empty.Count != 0 || empty.P99 != 0 {
+		t.Errorf("empty latency = %+v", empty)
+	}
+}
+
+func logLatency(t *testing.T, db *sql.DB, endpoint string, code int, times ...int) {
+	t.Helper()
+	for _, ms := range times {
+		_, err := db.Exec(`
+            INSERT INTO activity_log (timestamp, endpoint, name, response_code, response_time_ms)
+            VALUES (?, ?, 'ada', ?, ?)
+        `, sqliteTime(fixtureNow.Add(-time.Minute)), endpoint, code, ms)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func repeat(ms, n int) []int {
+	times := make([]int, n)
+	for i := range times {
+		times[i] = ms
+	}
+	return times
+}
+
+func TestPerfBaselineRegression(t *testing.T) {
+	db := openFixture(t)
+	ctx := context.Background()
+	opts := DefaultPerfOptions
+
+	logLatency(t, db, "/message", 201, repeat(10, 30)...)
+	logLatency(t, db, "/automessage", 200, repeat(5, 30)...)
+
+	report, err := LoadPerf(ctx, db, Range{}, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.BaselineRecordedAt != nil || len(report.Regressions) != 0 {
+		t.Fatalf("report without a baseline = %+v", report)
+	}
+	if err := SavePerfBaseline(ctx, db, report); err != nil {
+		t.Fatal(err)
+	}
+
+	// A busy class: /message slows down, /automessage stays put and the
+	// failed requests are the slowest of all
+	if _, err := db.Exec(`DELETE FROM activity_log`); err != nil {
+		t.Fatal(err)
+	}
+	logLatency(t, db, "/message", 201, repeat(40, 30)...)
+	logLatency(t, db, "/automessage", 200, repeat(6, 30)...)
+	logLatency(t, db, "/message", 503, 900, 800)
+
+	report, err = LoadPerf(ctx, db, Range{}, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.BaselineRecordedAt == nil || report.Baseline["/message"].P95 != 10 {
+		t.Fatalf("baseline = %+v", report.Baseline)
+	}
+
+	if report.Endpoints[0].Endpoint != "/message" || report.Endpoints[0].Count != 32 {
+		t.Errorf("endpoints = %+v, want /message first", report.Endpoints)
+	}
+	if len(report.Statuses) != 3 || report.Statuses[2].Status != 503 || report.Statuses[2].Max != 900 {
+		t.Errorf("statuses = %+v", report.Statuses)
+	}
+	if len(report.Slowest) != opts.Slowest || report.Slowest[0].ResponseTimeMs != 900 {
+		t.Errorf("slowest = %+v", report.Slowest)
+	}
+
+	flagged := map[string]bool{}
+	for _, r := range report.Regressions {
+		flagged[r.Endpoint+" "+r.Metric] = true
+	}
+	for _, want := range []string{"/message p50", "/message p95", "* p50", "* p95"} {
+		if !flagged[want] {
+			t.Errorf("%s not flagged: %+v", want, report.Regressions)
+		}
+	}
+	for key := range flagged {
+		if strings.HasPrefix(key, "/automessage") {
+			t.Errorf("/automessage flagged: %+v", report.Regressions)
+		}
+	}
+}
+
+func TestSessionRange(t *testing.T) {
+	db := openFixture(t)
+	ctx := context.Background()
+	logRequests(t, db,
+		fixtureRequest{3 * time.Hour, "ada", "old", "/automessage", 200},
+		fixtureRequest{90 * time.Minute, "ada", "java", "/automessage", 200},
+		fixtureRequest{80 * time.Minute, "ada", "python", "/message", 400},
+		fixtureRequest{70 * time.Minute, "grace", "java", "/message", 400},
+		fixtureRequest{time.Hour, "grace", "java", "/message", 400},
+		fixtureRequest{time.Hour, "grace", "java", "/messages", 500},
+	)
+	for i, m := range []struct {
+		ago  time.Duration
+		text string
+	}{{2 * time.Hour, "early"}, {80 * time.Minute, "nice"}, {75 * time.Minute, "nice"}, {70 * time.Minute, "great"}} {
+		_, err := db.Exec(`
+            INSERT INTO user_messages (message_id, from_user, to_user, message, created_at)
+            VALUES (?, 'ada', 'grace', ?, ?)
+        `, string(rune('a'+i)), m.text, sqliteTime(fixtureNow.Add(-m.ago)))
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	r, err := SessionRange(ctx, db, "java")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !r.Since.Equal(fixtureNow.Add(-90*time.Minute)) || !r.Until.Equal(fixtureNow.Add(-time.Hour+time.Second)) {
+		t.Errorf("java ran %v to %v", r.Since, r.Until)
+	}
+
+	// The python request falls inside the window but not the session
+	s, err := LoadSummary(ctx, db, r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s.TotalRequests != 4 || s.ErrorCount != 3 {
+		t.Errorf("summary = %+v, want 4 requests and 3 errors", s)
+	}
+
+	errs, err := LoadErrors(ctx, db, r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []EndpointError{{"/message", 400, 2}, {"/messages", 500, 1}}
+	if !reflect.DeepEqual(errs, want) {
+		t.Errorf("errors = %+v, want %+v", errs, want)
+	}
+
+	// Messages have no session, so the window alone applies
+	top, err := TopMessages(ctx, db, r, 5)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(top) != 2 || top[0] != (MessageCount{"nice", 2, 1}) || top[1].Message != "great" {
+		t.Errorf("top messages = %+v", top)
+	}
+
+	if r, err := SessionRange(ctx, db, "missing"); err != nil || !r.Since.IsZero() {
+		t.Errorf("missing session gave %+v, %v", r, err)
+	}
+}
+
+func TestLoadAliasUsage(t *testing.T) {
+	db := openFixture(t)
+	ctx := context.Background()
+
+	// Databases from before schema version 3 have no alias column
+	usage, err := LoadAliasUsage(ctx, db, Range{})
+	if err != nil || len(usage) != 0 {
+		t.Fatalf("without the alias column got %v, %v", usage, err)
+	}
+
+	if _, err := db.Exec(`ALTER TABLE activity_log ADD COLUMN alias TEXT`); err != nil {
+		t.Fatal(err)
+	}
+	logRequests(t, db,
+		fixtureRequest{3 * time.Hour, "ada", "s1", "/automessage", 200},
+		fixtureRequest{20 * time.Minute, "grace", "s1", "/automessage", 200},
+		fixtureRequest{10 * time.Minute, "ada", "s1", "/automessage", 200},
+		fixtureRequest{5 * time.Minute, "ada", "s1", "/automessage", 200},
+		fixtureRequest{time.Minute, "", "", "/automessage", 400},
+	)
+	if _, err := db.Exec(`UPDATE activity_log SET alias = '/message' WHERE id != 4`); err != nil {
+		t.Fatal(err)
+	}
+
+	usage, err = LoadAliasUsage(ctx, db, Last(time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []AliasUsage{{
+		Alias:    "/message",
+		Endpoint: "/automessage",
+		Requests: 3,
+		Students: []string{"ada", "grace"},
+		LastSeen: fixtureNow.Add(-time.Minute),
+	}}
+	if !reflect.DeepEqual(usage, want) {
+		t.Errorf("got %+v, want %+v", usage, want)
+	}
+}
+
+func TestParseTime(t *testing.T) {
+	perth := time.FixedZone("AWST", 8*60*60)
+	now := time.Date(2025, 10, 14, 1, 30, 0, 0, time.UTC)
+
+	tests := []struct {
+		value string
+		want  time.Time
+	}{
+		{"2025-10-14T09:00:00+08:00", time.Date(2025, 10, 14, 1, 0, 0, 0, time.UTC)},
+		{"2025-10-14T01:00:00Z", time.Date(2025, 10, 14, 1, 0, 0, 0, time.UTC)},
+		{"30m", time.Date(2025, 10, 14, 1, 0, 0, 0, time.UTC)},
+		{"2h", time.Date(2025, 10, 13, 23, 30, 0, 0, time.UTC)},
+		// Midnight in Perth is the previous afternoon in UTC
+		{"2025-10-14", time.Date(2025, 10, 13, 16, 0, 0, 0, time.UTC)},
+		{"2025-10-14 09:00", time.Date(2025, 10, 14, 1, 0, 0, 0, time.UTC)},
+		{"2025-10-14T09:00:30", time.Date(2025, 10, 14, 1, 0, 30, 0, time.UTC)},
+	}
+	for _, tt := range tests {
+		got, err := ParseTime(tt.value, now, perth)
+		if err != nil {
+			t.Errorf("ParseTime(%q): %v", tt.value, err)
+			continue
+		}
+		if !got.Equal(tt.want) {
+			t.Errorf("ParseTime(%q) = %v, want %v", tt.value, got.UTC(), tt.want)
+		}
+	}
+
+	for _, bad := range []string{"", "yesterday", "-5m", "14/10/2025", "2025-10-14T09:00:00+25:00"} {
+		if _, err := ParseTime(bad, now, perth); err == nil {
+			t.Errorf("ParseTime(%q) succeeded, want an error", bad)
+		}
+	}
+}
+
+func TestDayBoundary(t *testing.T) {
+	db := openFixture(t)
+	ctx := context.Background()
+	perth := time.FixedZone("AWST", 8*60*60)
+
+	// Stored as UTC text, as CURRENT_TIMESTAMP would write them
+	for _, ts := range []string{
+		"2025-10-13 15:59:59", // 23:59:59 on the 13th in Perth
+		"2025-10-13 16:00:00", // midnight on the 14th in Perth
+		"2025-10-14 09:30:00",
+		"2025-10-14 15:59:59", // last second of the 14th in Perth
+		"2025-10-14 16:00:00", // the 15th in Perth
+	} {
+		_, err := db.Exec(`
+            INSERT INTO activity_log (timestamp, endpoint, name, response_code, response_time_ms)
+            VALUES (?, '/automessage', 'ada', 200, 5)
+        `, ts)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	now := time.Date(2025, 10, 15, 12, 0, 0, 0, time.UTC)
+	since, err := ParseTime("2025-10-14", now, perth)
+	if err != nil {
+		t.Fatal(err)
+	}
+	until, err := ParseTime("2025-10-15", now, perth)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	entries, err := LoadActivity(ctx, db, Range{Since: since, Until: until}, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 3 {
+		t.Fatalf("got %d requests on the 14th in Perth, want 3", len(entries))
+	}
+	first, last := entries[0].Timestamp, entries[len(entries)-1].Timestamp
+	if first.Location() != time.UTC || !first.Equal(time.Date(2025, 10, 13, 16, 0, 0, 0, time.UTC)) {
+		t.Errorf("first request at %v, want 2025-10-13 16:00:00 UTC", first)
+	}
+	if got := last.In(perth).Format("2006-01-02 15:04:05"); got != "2025-10-14 23:59:59" {
+		t.Errorf("last request at %s Perth time, want 2025-10-14 23:59:59", got)
+	}
+
+	// The same date in UTC starts eight hours later
+	utcDay, err := ParseTime("2025-10-14", now, time.UTC)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s, err := LoadSummary(ctx, db, Range{Since: utcDay, Until: utcDay.Add(24 * time.Hour)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s.TotalRequests != 3 {
+		t.Errorf("got %d requests on the 14th in UTC, want 3", s.TotalRequests)
+	}
+}
@@ -0,0 +1,273 @@
+package monitor
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"sort"
+	"time"
+)
+
+// PerfBaselineSchema creates the table holding the latency baseline that
+// perf reports are compared against. It is part of init-db's schema and is
+// also applied before a baseline is saved so older databases pick it up.
+const PerfBaselineSchema = `
+CREATE TABLE IF NOT EXISTS perf_baseline (
+    endpoint TEXT PRIMARY KEY,
+    request_count INTEGER NOT NULL,
+    p50_ms INTEGER NOT NULL,
+    p95_ms INTEGER NOT NULL,
+    p99_ms INTEGER NOT NULL,
+    max_ms INTEGER NOT NULL,
+    recorded_at DATETIME DEFAULT CURRENT_TIMESTAMP
+);
+`
+
+// AllEndpoints is the baseline row for every request together.
+const AllEndpoints = "*"
+
+// EndpointLatency is the latency of one endpoint.
+type EndpointLatency struct {
+	Endpoint string `json:"endpoint"`
+	LatencyStats
+}
+
+// StatusLatency is the latency of the requests that got one status code.
+type StatusLatency struct {
+	Status int `json:"status"`
+	LatencyStats
+}
+
+// Regression is a latency percentile that has grown past the baseline.
+type Regression struct {
+	Endpoint   string  `json:"endpoint"`
+	Metric     string  `json:"metric"`
+	BaselineMs int     `json:"baseline_ms"`
+	CurrentMs  int     `json:"current_ms"`
+	Factor     float64 `json:"factor"`
+}
+
+// PerfReport breaks response_time_ms down for a window of activity.
+type PerfReport struct {
+	Overall   LatencyStats      `json:"overall"`
+	Endpoints []EndpointLatency `json:"endpoints"`
+	Statuses  []StatusLatency   `json:"statuses"`
+	Slowest   []ActivityEntry   `json:"slowest"`
+	// Baseline is the stored baseline by endpoint, with AllEndpoints for
+	// the overall figures. It is empty when none has been saved.
+	Baseline           map[string]LatencyStats `json:"baseline"`
+	BaselineRecordedAt *time.Time              `json:"baseline_recorded_at"`
+	Regressions        []Regression            `json:"regressions"`
+}
+
+// PerfOptions tunes the perf report.
+type PerfOptions struct {
+	// Slowest is how many of the slowest requests to list.
+	Slowest int
+	// Factor is how many times the baseline a percentile has to reach to
+	// count as a regression.
+	Factor float64
+	// MinDeltaMs ignores regressions smaller than this, so a 2ms endpoint
+	// going to 4ms is not flagged.
+	MinDeltaMs int
+	// MinRequests is the fewest requests an endpoint needs before its
+	// percentiles are compared.
+	MinRequests int
+}
+
+// DefaultPerfOptions lists ten requests and flags p50 or p95 rising to
+// one and a half times the baseline and at least 10ms more.
+var DefaultPerfOptions = PerfOptions{
+	Slowest:     10,
+	Factor:      1.5,
+	MinDeltaMs:  10,
+	MinRequests: 20,
+}
+
+// LoadPerf computes latency percentiles overall, per endpoint and per
+// status code for the range, lists the slowest requests and compares the
+// endpoints with the stored baseline. Endpoints are ordered slowest p95
+// first.
+func LoadPerf(ctx context.Context, db *sql.DB, r Range, opts PerfOptions) (PerfReport, error) {
+	rangeClause, args := r.where("timestamp")
+
+	rows, err := db.QueryContext(ctx, `
+        SELECT endpoint, COALESCE(response_code, 0), response_time_ms
+        FROM activity_log
+        WHERE response_time_ms IS NOT NULL`+rangeClause+`
+        ORDER BY response_time_ms
+    `, args...)
+	if err != nil {
+		return PerfReport{}, err
+	}
+	defer rows.Close()
+
+	var all []int
+	byEndpoint := map[string][]int{}
+	byStatus := map[int][]int{}
+	for rows.Next() {
+		var endpoint string
+		var code, ms int
+		if err := rows.Scan(&endpoint, &code, &ms); err != nil {
+			return PerfReport{}, err
+		}
+		all = append(all, ms)
+		byEndpoint[endpoint] = append(byEndpoint[endpoint], ms)
+		byStatus[code] = append(byStatus[code], ms)
+	}
+	if err := rows.Err(); err != nil {
+		return PerfReport{}, err
+	}
+
+	report := PerfReport{
+		Overall:     statsOf(all),
+		Endpoints:   []EndpointLatency{},
+		Statuses:    []StatusLatency{},
+		Regressions: []Regression{},
+	}
+	for endpoint, times := range byEndpoint {
+		report.Endpoints = append(report.Endpoints, EndpointLatency{endpoint, statsOf(times)})
+	}
+	sort.Slice(report.Endpoints, func(i, j int) bool {
+		a, b := report.Endpoints[i], report.Endpoints[j]
+		if a.P95 != b.P95 {
+			return a.P95 > b.P95
+		}
+		return a.Endpoint < b.Endpoint
+	})
+	for code, times := range byStatus {
+		report.Statuses = append(report.Statuses, StatusLatency{code, statsOf(times)})
+	}
+	sort.Slice(report.Statuses, func(i, j int) bool {
+		return report.Statuses[i].Status < report.Statuses[j].Status
+	})
+
+	report.Slowest, err = queryActivity(ctx, db, `
+        SELECT `+activityColumns+`
+        FROM activity_log
+        WHERE response_time_ms IS NOT NULL`+rangeClause+`
+        ORDER BY response_time_ms DESC, id DESC
+        LIMIT ?
+    `, append(args, opts.Slowest)...)
+	if err != nil {
+		return PerfReport{}, err
+	}
+
+	var recordedAt time.Time
+	report.Baseline, recordedAt, err = LoadPerfBaseline(ctx, db)
+	if err != nil {
+		return PerfReport{}, fmt.Errorf("failed to load baseline: %w", err)
+	}
+	report.BaselineRecordedAt = OptionalTime(recordedAt)
+
+	current := map[string]LatencyStats{AllEndpoints: report.Overall}
+	order := []string{AllEndpoints}
+	for _, e := range report.Endpoints {
+		current[e.Endpoint] = e.LatencyStats
+		order = append(order, e.Endpoint)
+	}
+	for _, endpoint := range order {
+		base, ok := report.Baseline[endpoint]
+		if !ok {
+			continue
+		}
+		report.Regressions = append(report.Regressions, compareLatency(endpoint, base, current[endpoint], opts)...)
+	}
+
+	return report, nil
+}
+
+// compareLatency flags the percentiles of cur that have regressed from
+// base.
+func compareLatency(endpoint string, base, cur LatencyStats, opts PerfOptions) []Regression {
+	if cur.Count < opts.MinRequests || base.Count < opts.MinRequests {
+		return nil
+	}
+
+	var regressions []Regression
+	for _, m := range []struct {
+		name      string
+		base, cur int
+	}{
+		{"p50", base.P50, cur.P50},
+		{"p95", base.P95, cur.P95},
+	} {
+		if m.cur-m.base < opts.MinDeltaMs {
+			continue
+		}
+		baseMs := m.base
+		if baseMs < 1 {
+			baseMs = 1
+		}
+		factor := float64(m.cur) / float64(baseMs)
+		if factor >= opts.Factor {
+			regressions = append(regressions, Regression{endpoint, m.name, m.base, m.cur, factor})
+		}
+	}
+	return regressions
+}
+
+// SavePerfBaseline replaces the stored baseline with the report's overall
+// and per-endpoint figures.
+func SavePerfBaseline(ctx context.Context, db *sql.DB, report PerfReport) error {
+	if _, err := db.ExecContext(ctx, PerfBaselineSchema); err != nil {
+		return fmt.Errorf("failed to create perf_baseline table: %w", err)
+	}
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, `DELETE FROM perf_baseline`); err != nil {
+		return err
+	}
+
+	rows := append([]EndpointLatency{{AllEndpoints, report.Overall}}, report.Endpoints...)
+	for _, e := range rows {
+		if _, err := tx.ExecContext(ctx, `
+            INSERT INTO perf_baseline (endpoint, request_count, p50_ms, p95_ms, p99_ms, max_ms)
+            VALUES (?, ?, ?, ?, ?, ?)
+        `, e.Endpoint, e.Count, e.P50, e.P95, e.P99, e.Max); err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+// LoadPerfBaseline returns the stored baseline by endpoint and when it was
+// recorded. The map is empty when no baseline has been saved.
+func LoadPerfBaseline(ctx context.Context, db *sql.DB) (map[string]LatencyStats, time.Time, error) {
+	baseline := map[string]LatencyStats{}
+
+	ok, err := hasTable(ctx, db, "perf_baseline")
+	if err != nil || !ok {
+		return baseline, time.Time{}, err
+	}
+
+	rows, err := db.QueryContext(ctx, `
+        SELECT endpoint, request_count, p50_ms, p95_ms, p99_ms, max_ms, recorded_at
+        FROM perf_baseline
+    `)
+	if err != nil {
+		return nil, time.Time{}, err
+	}
+	defer rows.Close()
+
+	var recordedAt time.Time
+	for rows.Next() {
+		var endpoint string
+		var s LatencyStats
+		var at scanTime
+		if err := rows.Scan(&endpoint, &s.Count, &s.P50, &s.P95, &s.P99, &s.Max, &at); err != nil {
+			return nil, time.Time{}, err
+		}
+		baseline[endpoint] = s
+		if at.Time.After(recordedAt) {
+			recordedAt = at.Time
+		}
+	}
+	return baseline, recordedAt, rows.Err()
+}
@@ -0,0 +1,321 @@
+package monitor
+
+import (
+	"context"
+	"database/sql"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"time"
+)
+
+// RosterSchema creates the table holding the expected students for each
+// training session. It is part of init-db's schema and is also applied
+// before an import so older databases pick it up.
+const RosterSchema = `
+CREATE TABLE IF NOT EXISTS roster (
+    session_id TEXT NOT NULL,
+    name TEXT NOT NULL,
+    imported_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (session_id, name)
+);
+`
+
+// RosterStatus classifies a rostered student's activity in their session.
+type RosterStatus string
+
+const (
+	RosterAbsent  RosterStatus = "absent"  // no requests at all
+	RosterFailing RosterStatus = "failing" // every request was an error
+	RosterStuck   RosterStatus = "stuck"   // repeating a failing endpoint
+	RosterOK      RosterStatus = "ok"
+)
+
+// rosterOrder sorts problems to the top of a report.
+var rosterOrder = map[RosterStatus]int{
+	RosterAbsent:  0,
+	RosterFailing: 1,
+	RosterStuck:   2,
+	RosterOK:      3,
+}
+
+// RosterStudent is one expected student and what they have done so far.
+type RosterStudent struct {
+	Name     string       `json:"name"`
+	Status   RosterStatus `json:"status"`
+	Requests int          `json:"requests"`
+	Errors   int          `json:"errors"`
+	// Endpoint is the endpoint of the student's latest run of requests,
+	// RunLength how many consecutive requests went to it and RunErrors how
+	// many of those failed.
+	Endpoint  string    `json:"endpoint"`
+	RunLength int       `json:"run_length"`
+	RunErrors int       `json:"run_errors"`
+	RunSince  time.Time `json:"run_since"`
+	LastSeen  time.Time `json:"last_seen"`
+}
+
+// MarshalJSON writes the times of absent students as null.
+func (s RosterStudent) MarshalJSON() ([]byte, error) {
+	type plain RosterStudent
+	return json.Marshal(struct {
+		plain
+		RunSince *time.Time `json:"run_since"`
+		LastSeen *time.Time `json:"last_seen"`
+	}{plain(s), OptionalTime(s.RunSince), OptionalTime(s.LastSeen)})
+}
+
+// RosterOptions tunes when a student counts as stuck. Only runs in which
+// at least half the requests failed count, so a student polling /messages
+// for the auto-refresh exercise is not flagged for doing it right.
+type RosterOptions struct {
+	// StuckRequests is the minimum number of consecutive requests to one
+	// endpoint.
+	StuckRequests int
+	// StuckAfter is how long that run has to have been going on.
+	StuckAfter time.Duration
+}
+
+// DefaultRosterOptions flags a student after ten requests to the same
+// endpoint over at least fifteen minutes, half or more of them errors.
+var DefaultRosterOptions = RosterOptions{
+	StuckRequests: 10,
+	StuckAfter:    15 * time.Minute,
+}
+
+// ImportRoster reads a CSV roster and replaces the stored roster of every
+// session it mentions. The file is either a bare list of names or has a
+// header row with a "name" column and optionally a "session_id" column;
+// rows without a session use defaultSession. It returns the number of
+// students imported.
+func ImportRoster(ctx context.Context, db *sql.DB, defaultSession string, r io.Reader) (int, error) {
+	cr := csv.NewReader(r)
+	cr.FieldsPerRecord = -1
+	cr.TrimLeadingSpace = true
+
+	records, err := cr.ReadAll()
+	if err != nil {
+		return 0, fmt.Errorf("failed to read roster: %w", err)
+	}
+
+	nameCol, sessionCol := 0, -1
+	if len(records) > 0 {
+		header := records[0]
+		isHeader := false
+		for i, field := range header {
+			switch strings.ToLower(strings.TrimSpace(field)) {
+			case "name", "student":
+				nameCol = i
+				isHeader = true
+			case "session_id", "session":
+				sessionCol = i
+			}
+		}
+		if isHeader {
+			records = records[1:]
+		} else {
+			sessionCol = -1
+		}
+	}
+
+	bySession := map[string][]string{}
+	var sessions []string
+	for i, rec := range records {
+		if nameCol >= len(rec) {
+			continue
+		}
+		name := strings.TrimSpace(rec[nameCol])
+		if name == "" {
+			continue
+		}
+		session := defaultSession
+		if sessionCol >= 0 && sessionCol < len(rec) && strings.TrimSpace(rec[sessionCol]) != "" {
+			session = strings.TrimSpace(rec[sessionCol])
+		}
+		if session == "" {
+			return 0, fmt.Errorf("roster row %d (%s) has no session", i+1, name)
+		}
+		if _, ok := bySession[session]; !ok {
+			sessions = append(sessions, session)
+		}
+		bySession[session] = append(bySession[session], name)
+	}
+
+	if len(sessions) == 0 {
+		return 0, errors.New("roster contains no names")
+	}
+
+	if _, err := db.ExecContext(ctx, RosterSchema); err != nil {
+		return 0, fmt.Errorf("failed to create roster table: %w", err)
+	}
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	imported := 0
+	for _, session := range sessions {
+		if _, err := tx.ExecContext(ctx, `DELETE FROM roster WHERE session_id = ?`, session); err != nil {
+			return 0, err
+		}
+		for _, name := range bySession[session] {
+			res, err := tx.ExecContext(ctx, `
+                INSERT INTO roster (session_id, name) VALUES (?, ?)
+                ON CONFLICT(session_id, name) DO NOTHING
+            `, session, name)
+			if err != nil {
+				return 0, err
+			}
+			n, _ := res.RowsAffected()
+			imported += int(n)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, err
+	}
+	return imported, nil
+}
+
+// LatestRosterSession returns the session whose roster was imported most
+// recently, or "" when no roster has been imported.
+func LatestRosterSession(ctx context.Context, db *sql.DB) (string, error) {
+	ok, err := hasTable(ctx, db, "roster")
+	if err != nil || !ok {
+		return "", err
+	}
+
+	var session string
+	err = db.QueryRowContext(ctx, `
+        SELECT session_id FROM roster
+        ORDER BY imported_at DESC, session_id
+        LIMIT 1
+    `).Scan(&session)
+	if errors.Is(err, sql.ErrNoRows) {
+		return "", nil
+	}
+	return session, err
+}
+
+// RosterNames returns the expected students for a session.
+func RosterNames(ctx context.Context, db *sql.DB, session string) ([]string, error) {
+	ok, err := hasTable(ctx, db, "roster")
+	if err != nil || !ok {
+		return nil, err
+	}
+
+	rows, err := db.QueryContext(ctx, `
+        SELECT name FROM roster
+        WHERE session_id = ?
+        ORDER BY name
+    `, session)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var names []string
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			return nil, err
+		}
+		names = append(names, name)
+	}
+	return names, rows.Err()
+}
+
+// RosterReport compares a session's roster with the requests tagged with
+// that session_id. Names are matched case-insensitively. Students are
+// returned with absent, failing and stuck students first.
+func RosterReport(ctx context.Context, db *sql.DB, session string, opts RosterOptions, now time.Time) ([]RosterStudent, error) {
+	names, err := RosterNames(ctx, db, session)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load roster: %w", err)
+	}
+	if len(names) == 0 {
+		return []RosterStudent{}, nil
+	}
+
+	students := make([]RosterStudent, len(names))
+	byKey := make(map[string]*RosterStudent, len(names))
+	for i, name := range names {
+		students[i] = RosterStudent{Name: name, Status: RosterAbsent}
+		byKey[rosterKey(name)] = &students[i]
+	}
+
+	rows, err := db.QueryContext(ctx, `
+        SELECT name, endpoint, COALESCE(response_code, 0), timestamp
+        FROM activity_log
+        WHERE session_id = ? AND name IS NOT NULL AND name != ''
+        ORDER BY id
+    `, session)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load session activity: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var name, endpoint string
+		var code int
+		var ts scanTime
+		if err := rows.Scan(&name, &endpoint, &code, &ts); err != nil {
+			return nil, err
+		}
+
+		s, ok := byKey[rosterKey(name)]
+		if !ok {
+			continue
+		}
+		s.Requests++
+		if endpoint == s.Endpoint {
+			s.RunLength++
+		} else {
+			s.Endpoint = endpoint
+			s.RunLength = 1
+			s.RunErrors = 0
+			s.RunSince = ts.Time
+		}
+		if code >= 400 {
+			s.Errors++
+			s.RunErrors++
+		}
+		s.LastSeen = ts.Time
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	for i := range students {
+		students[i].Status = classifyRosterStudent(students[i], opts, now)
+	}
+
+	sort.SliceStable(students, func(i, j int) bool {
+		return rosterOrder[students[i].Status] < rosterOrder[students[j].Status]
+	})
+
+	return students, nil
+}
+
+func classifyRosterStudent(s RosterStudent, opts RosterOptions, now time.Time) RosterStatus {
+	switch {
+	case s.Requests == 0:
+		return RosterAbsent
+	case s.Errors == s.Requests:
+		return RosterFailing
+	case opts.StuckRequests > 0 && s.RunLength >= opts.StuckRequests &&
+		now.Sub(s.RunSince) >= opts.StuckAfter && 2*s.RunErrors >= s.RunLength:
+		return RosterStuck
+	}
+	return RosterOK
+}
+
+func rosterKey(name string) string {
+	return strings.ToLower(strings.TrimSpace(name))
+}
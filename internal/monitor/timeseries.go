@@ -0,0 +1,231 @@
+package monitor
+
+import (
+	"context"
+	"database/sql"
+	"math"
+	"sort"
+	"time"
+)
+
+// MinuteBucket is the traffic logged in a bucket of Minutes minutes
+// starting at Minute. Buckets are one minute wide unless the range is too
+// long to plot minute by minute.
+type MinuteBucket struct {
+	Minute   time.Time `json:"minute"`
+	Minutes  int       `json:"minutes"`
+	Requests int       `json:"requests"`
+	Errors   int       `json:"errors"`
+}
+
+// MaxBuckets is the most buckets RequestsPerMinute returns. Longer ranges
+// are counted in wider buckets, so a range of months costs no more to
+// chart than a day.
+const MaxBuckets = 1440
+
+// bucketWidths are the bucket widths RequestsPerMinute steps through, in
+// minutes, until the range fits in MaxBuckets.
+var bucketWidths = []int{1, 5, 15, 60, 360, 1440}
+
+// bucketWidth returns the narrowest bucket width, in minutes, that covers
+// start to end in at most MaxBuckets buckets. Ranges beyond MaxBuckets days
+// use a whole number of days.
+func bucketWidth(start, end time.Time) int {
+	minutes := int(end.Sub(start)/time.Minute) + 1
+	for _, w := range bucketWidths {
+		if (minutes+w-1)/w <= MaxBuckets {
+			return w
+		}
+	}
+	days := (minutes + 1440*MaxBuckets - 1) / (1440 * MaxBuckets)
+	return days * 1440
+}
+
+// ErrorRate is the percentage of the bucket's requests that failed.
+func (b MinuteBucket) ErrorRate() float64 {
+	if b.Requests == 0 {
+		return 0
+	}
+	return float64(b.Errors) / float64(b.Requests) * 100
+}
+
+// RequestsPerMinute counts requests and errors per minute in the range.
+// Quiet minutes are included with zero counts, from Since (or the first
+// request) up to Until (or the current minute), so a stalled class shows
+// as a flat line rather than a gap. Ranges longer than MaxBuckets minutes
+// are counted in wider buckets; see bucketWidth.
+func RequestsPerMinute(ctx context.Context, db *sql.DB, r Range) ([]MinuteBucket, error) {
+	rangeClause, args := r.where("timestamp")
+
+	rows, err := db.QueryContext(ctx, `
+        SELECT
+            strftime('%Y-%m-%d %H:%M:00', timestamp) as minute,
+            COUNT(*),
+            SUM(CASE WHEN response_code >= 400 THEN 1 ELSE 0 END)
+        FROM activity_log
+        WHERE 1=1`+rangeClause+`
+        GROUP BY minute
+        ORDER BY minute
+    `, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	counts := map[time.Time]MinuteBucket{}
+	var first time.Time
+	for rows.Next() {
+		var b MinuteBucket
+		var minute scanTime
+		if err := rows.Scan(&minute, &b.Requests, &b.Errors); err != nil {
+			return nil, err
+		}
+		b.Minute = minute.Time
+		counts[b.Minute] = b
+		if first.IsZero() {
+			first = b.Minute
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	start, end := first, time.Now()
+	if !r.Since.IsZero() {
+		start = r.Since
+	}
+	if !r.Until.IsZero() {
+		end = r.Until.Add(-time.Nanosecond)
+	}
+	buckets := []MinuteBucket{}
+	if start.IsZero() {
+		return buckets, nil
+	}
+	start, end = start.UTC().Truncate(time.Minute), end.UTC().Truncate(time.Minute)
+	if end.Before(start) {
+		return buckets, nil
+	}
+
+	minutes := bucketWidth(start, end)
+	step := time.Duration(minutes) * time.Minute
+	start = start.Truncate(step)
+	index := map[time.Time]int{}
+	for m := start; !m.After(end); m = m.Add(step) {
+		index[m] = len(buckets)
+		buckets = append(buckets, MinuteBucket{Minute: m, Minutes: minutes})
+	}
+	for m, c := range counts {
+		if i, ok := index[m.Truncate(step)]; ok {
+			buckets[i].Requests += c.Requests
+			buckets[i].Errors += c.Errors
+		}
+	}
+	return buckets, nil
+}
+
+// LatencyBucket counts the requests that took up to UpperMs milliseconds
+// and more than the previous bucket's bound. The last bucket has no upper
+// bound and an UpperMs of zero.
+type LatencyBucket struct {
+	UpperMs int `json:"upper_ms"`
+	Count   int `json:"count"`
+}
+
+// latencyBounds are the upper bounds of the histogram buckets in
+// milliseconds. CGI requests normally finish well inside 50ms; the long
+// tail is SQLite waiting on a lock.
+var latencyBounds = []int{5, 10, 25, 50, 100, 250, 500, 1000}
+
+// LatencyStats are the percentiles of response_time_ms for a set of
+// requests.
+type LatencyStats struct {
+	Count int `json:"count"`
+	P50   int `json:"p50_ms"`
+	P95   int `json:"p95_ms"`
+	P99   int `json:"p99_ms"`
+	Max   int `json:"max_ms"`
+}
+
+// Latency is LatencyStats plus a histogram.
+type Latency struct {
+	LatencyStats
+	Buckets []LatencyBucket `json:"buckets"`
+}
+
+// LoadLatency builds a latency histogram for the requests in the range.
+func LoadLatency(ctx context.Context, db *sql.DB, r Range) (Latency, error) {
+	rangeClause, args := r.where("timestamp")
+
+	rows, err := db.QueryContext(ctx, `
+        SELECT response_time_ms
+        FROM activity_log
+        WHERE response_time_ms IS NOT NULL`+rangeClause+`
+        ORDER BY response_time_ms
+    `, args...)
+	if err != nil {
+		return Latency{}, err
+	}
+	defer rows.Close()
+
+	var times []int
+	for rows.Next() {
+		var ms int
+		if err := rows.Scan(&ms); err != nil {
+			return Latency{}, err
+		}
+		times = append(times, ms)
+	}
+	if err := rows.Err(); err != nil {
+		return Latency{}, err
+	}
+
+	return latencyOf(times), nil
+}
+
+// statsOf computes the percentiles of response times, which must be
+// sorted.
+func statsOf(sorted []int) LatencyStats {
+	s := LatencyStats{
+		Count: len(sorted),
+		P50:   percentile(sorted, 50),
+		P95:   percentile(sorted, 95),
+		P99:   percentile(sorted, 99),
+	}
+	if len(sorted) > 0 {
+		s.Max = sorted[len(sorted)-1]
+	}
+	return s
+}
+
+// latencyOf summarises response times, which must be sorted.
+func latencyOf(sorted []int) Latency {
+	l := Latency{
+		LatencyStats: statsOf(sorted),
+		Buckets:      make([]LatencyBucket, len(latencyBounds)+1),
+	}
+
+	for i, bound := range latencyBounds {
+		l.Buckets[i].UpperMs = bound
+	}
+	for _, ms := range sorted {
+		i := sort.SearchInts(latencyBounds, ms)
+		l.Buckets[i].Count++
+	}
+	return l
+}
+
+// percentile returns the nearest-rank p-th percentile of sorted values, or
+// zero when there are none.
+func percentile(sorted []int, p float64) int {
+	if len(sorted) == 0 {
+		return 0
+	}
+	rank := int(math.Ceil(p/100*float64(len(sorted)))) - 1
+	if rank < 0 {
+		rank = 0
+	}
+	if rank >= len(sorted) {
+		rank = len(sorted) - 1
+	}
+	return sorted[rank]
+}
@@ -0,0 +1,212 @@
+package report
+
+import (
+	"html/template"
+	"io"
+	"time"
+
+	"github.com/industrial-linguistics/happy-api/internal/chart"
+)
+
+// htmlData is what the page template draws.
+type htmlData struct {
+	Report
+	Span           string
+	RequestChart   chart.Chart
+	ErrorRateChart chart.Chart
+	LatencyChart   chart.Chart
+}
+
+// WriteHTML writes the report as a single HTML page with its styles and
+// charts inline, so it can be mailed or archived on its own.
+func WriteHTML(w io.Writer, rep Report) error {
+	return htmlTemplate.Execute(w, htmlData{
+		Report:         rep,
+		Span:           formatSpan(rep.Start, rep.End, rep.Location),
+		RequestChart:   chart.Requests(rep.PerMinute, rep.Location),
+		ErrorRateChart: chart.ErrorRate(rep.PerMinute, rep.Location),
+		LatencyChart:   chart.Latency(rep.Latency),
+	})
+}
+
+var htmlTemplate = template.Must(template.New("report").Funcs(template.FuncMap{
+	"formatTime": formatTime,
+	"formatTimestamp": func(t time.Time, loc *time.Location) string {
+		return t.In(loc).Format("2006-01-02 15:04")
+	},
+	"percent": func(n, total int) float64 {
+		if total == 0 {
+			return 0
+		}
+		return float64(n) / float64(total) * 100
+	},
+}).Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+    <meta charset="utf-8">
+    <title>Session report: {{ .Session }}</title>
+    <style>
+        body { font-family: system-ui, sans-serif; margin: 2rem auto; max-width: 60rem; padding: 0 1rem; background: #f4f6f8; color: #222; }
+        h1 { margin-bottom: 0.2rem; }
+        h2 { margin-top: 2rem; }
+        table { border-collapse: collapse; width: 100%; background: #fff; box-shadow: 0 1px 3px rgba(0,0,0,0.1); margin-top: 1rem; }
+        th, td { border: 1px solid #d8dee4; padding: 0.5rem 0.75rem; text-align: left; }
+        th { background: #e9eef3; }
+        tbody tr:nth-child(even) { background: #f7f9fb; }
+        td.num { text-align: right; }
+        .muted { color: #555; font-size: 0.9rem; }
+        .error { color: #b42323; font-weight: bold; }
+        .done { color: #1a7f37; font-weight: bold; }
+        .pending { color: #999; }
+        .card { background: #fff; padding: 1rem; border-radius: 0.5rem; box-shadow: 0 1px 3px rgba(0,0,0,0.1); margin-top: 1rem; }
+        ul { padding-left: 1.25rem; }` + chart.CSS + `
+        @media print { body { background: #fff; } table, .card { box-shadow: none; } }
+    </style>
+</head>
+<body>
+    <h1>Session report: {{ .Session }}</h1>
+    <p class="muted">{{ .Span }} &middot; generated {{ formatTimestamp .GeneratedAt .Location }}</p>
+
+    <div class="card">
+        <p><strong>Requests:</strong> {{ .Summary.TotalRequests }} from {{ .Summary.Students }} students</p>
+        <p><strong>Error Rate:</strong> {{ printf "%.1f" .Summary.ErrorRate }}% ({{ .Summary.ErrorCount }} errors)</p>
+        {{ if .Latency.Count }}<p><strong>Response time:</strong> p50 {{ .Latency.P50 }}ms &middot; p95 {{ .Latency.P95 }}ms &middot; p99 {{ .Latency.P99 }}ms &middot; max {{ .Latency.Max }}ms</p>{{ end }}
+    </div>
+
+    <h2>Timeline</h2>
+    <div class="card">
+        <p><strong>Requests per minute</strong> <span class="muted">(errors in red)</span></p>
+        {{ template "chart" .RequestChart }}
+        <p><strong>Error rate per minute</strong></p>
+        {{ template "chart" .ErrorRateChart }}
+        {{ if .Latency.Count }}
+        <p><strong>Response time histogram</strong></p>
+        {{ template "chart" .LatencyChart }}
+        {{ end }}
+    </div>
+
+    <h2>Exercise Progress</h2>
+    {{ if .Progress }}
+    <table>
+        <thead>
+            <tr>
+                <th>Student</th>
+                {{ range .Milestones }}<th title="{{ .Label }}">{{ .ID }}{{ if .Exercise }}<br><span class="muted">{{ .Exercise }}</span>{{ end }}</th>{{ end }}
+                <th>Done</th>
+            </tr>
+        </thead>
+        <tbody>
+        {{ $total := len .Milestones }}
+        {{ range .Progress }}
+            <tr>
+                <td>{{ .Name }}</td>
+                {{ range .Reached }}<td>{{ if .IsZero }}<span class="pending">&middot;</span>{{ else }}<span class="done">&#10003; {{ formatTime . $.Location }}</span>{{ end }}</td>{{ end }}
+                <td>{{ .Done }}/{{ $total }}</td>
+            </tr>
+        {{ end }}
+        </tbody>
+    </table>
+    {{ $students := len .Progress }}
+    <ul class="muted">
+        {{ range $i, $m := .Milestones }}<li><strong>{{ $m.ID }}</strong>: {{ if $m.Exercise }}{{ $m.Exercise }} &ndash; {{ end }}{{ $m.Label }} &mdash; {{ index $.Reached $i }} of {{ $students }} students</li>{{ end }}
+    </ul>
+    {{ else }}
+    <div class="card">No named students in this session.</div>
+    {{ end }}
+
+    <h2>Students</h2>
+    {{ if .Students }}
+    <table>
+        <thead>
+            <tr>
+                <th>Student</th>
+                <th>Requests</th>
+                <th>First Seen</th>
+                <th>Last Seen</th>
+            </tr>
+        </thead>
+        <tbody>
+        {{ range .Students }}
+            <tr>
+                <td>{{ .Name }}</td>
+                <td class="num">{{ .TotalRequests }}</td>
+                <td>{{ formatTime .FirstSeen $.Location }}</td>
+                <td>{{ formatTime .LastSeen $.Location }}</td>
+            </tr>
+        {{ end }}
+        </tbody>
+    </table>
+    {{ else }}
+    <div class="card">No named students in this session.</div>
+    {{ end }}
+
+    <h2>Endpoints</h2>
+    <table>
+        <thead>
+            <tr>
+                <th>Endpoint</th>
+                <th>Requests</th>
+                <th>Share</th>
+            </tr>
+        </thead>
+        <tbody>
+        {{ range .Summary.Endpoints }}
+            <tr>
+                <td>{{ .Endpoint }}</td>
+                <td class="num">{{ .Count }}</td>
+                <td class="num">{{ printf "%.1f" (percent .Count $.Summary.TotalRequests) }}%</td>
+            </tr>
+        {{ end }}
+        </tbody>
+    </table>
+
+    <h2>Errors</h2>
+    {{ if .Errors }}
+    <table>
+        <thead>
+            <tr>
+                <th>Endpoint</th>
+                <th>Status</th>
+                <th>Count</th>
+            </tr>
+        </thead>
+        <tbody>
+        {{ range .Errors }}
+            <tr>
+                <td>{{ .Endpoint }}</td>
+                <td class="error">{{ .Status }}</td>
+                <td class="num">{{ .Count }}</td>
+            </tr>
+        {{ end }}
+        </tbody>
+    </table>
+    {{ else }}
+    <div class="card">No errors.</div>
+    {{ end }}
+
+    <h2>Most-Sent Peer Messages</h2>
+    {{ if .Messages }}
+    <table>
+        <thead>
+            <tr>
+                <th>Message</th>
+                <th>Times Sent</th>
+                <th>Senders</th>
+            </tr>
+        </thead>
+        <tbody>
+        {{ range .Messages }}
+            <tr>
+                <td>{{ .Message }}</td>
+                <td class="num">{{ .Count }}</td>
+                <td class="num">{{ .Senders }}</td>
+            </tr>
+        {{ end }}
+        </tbody>
+    </table>
+    {{ else }}
+    <div class="card">No peer messages were sent during the session.</div>
+    {{ end }}
+</body>
+</html>
+` + chart.Template))
@@ -0,0 +1,146 @@
+package report
+
+import (
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/industrial-linguistics/happy-api/internal/chart"
+)
+
+// sparkWidth fits the timeline inside a code block on most screens.
+const sparkWidth = 72
+
+// WriteMarkdown writes the report as Markdown, with the timeline drawn as
+// sparklines.
+func WriteMarkdown(w io.Writer, rep Report) error {
+	var b strings.Builder
+
+	fmt.Fprintf(&b, "# Session report: %s\n\n", rep.Session)
+	fmt.Fprintf(&b, "- **When:** %s\n", formatSpan(rep.Start, rep.End, rep.Location))
+	fmt.Fprintf(&b, "- **Requests:** %d from %d students\n", rep.Summary.TotalRequests, rep.Summary.Students)
+	fmt.Fprintf(&b, "- **Error rate:** %.1f%% (%d errors)\n", rep.Summary.ErrorRate, rep.Summary.ErrorCount)
+	if l := rep.Latency; l.Count > 0 {
+		fmt.Fprintf(&b, "- **Response time:** p50 %dms, p95 %dms, p99 %dms, max %dms\n", l.P50, l.P95, l.P99, l.Max)
+	}
+
+	if len(rep.PerMinute) > 0 {
+		requests := make([]int, len(rep.PerMinute))
+		errors := make([]int, len(rep.PerMinute))
+		for i, m := range rep.PerMinute {
+			requests[i], errors[i] = m.Requests, m.Errors
+		}
+		requestLine, per := chart.Sparkline(requests, sparkWidth)
+		errorLine, _ := chart.Sparkline(errors, sparkWidth)
+		minutes := rep.PerMinute[0].Minutes
+		if minutes < 1 {
+			minutes = 1
+		}
+		step := chart.Step(per * minutes)
+
+		b.WriteString("\n## Timeline\n\n```text\n")
+		fmt.Fprintf(&b, "Requests, one column per %s (%s-%s)\n", step,
+			formatTime(rep.PerMinute[0].Minute, rep.Location), formatTime(rep.PerMinute[len(rep.PerMinute)-1].Minute, rep.Location))
+		fmt.Fprintf(&b, "%s\nErrors\n%s\n```\n", requestLine, errorLine)
+	}
+
+	b.WriteString("\n## Exercise progress\n\n")
+	if len(rep.Progress) == 0 {
+		b.WriteString("No named students in this session.\n")
+	} else {
+		header := []string{"Student"}
+		for _, m := range rep.Milestones {
+			header = append(header, m.ID)
+		}
+		var rows [][]string
+		for _, p := range rep.Progress {
+			row := []string{p.Name}
+			for _, t := range p.Reached {
+				if t.IsZero() {
+					row = append(row, "·")
+				} else {
+					row = append(row, "✓ "+formatTime(t, rep.Location))
+				}
+			}
+			rows = append(rows, append(row, fmt.Sprintf("%d/%d", p.Done(), len(rep.Milestones))))
+		}
+		writeTable(&b, append(header, "Done"), rows)
+
+		b.WriteString("\n")
+		for i, m := range rep.Milestones {
+			label := m.Label
+			if m.Exercise != "" {
+				label = m.Exercise + ": " + label
+			}
+			fmt.Fprintf(&b, "- **%s** %s — %d of %d students\n", m.ID, label, rep.Reached[i], len(rep.Progress))
+		}
+	}
+
+	b.WriteString("\n## Students\n\n")
+	if len(rep.Students) == 0 {
+		b.WriteString("No named students in this session.\n")
+	} else {
+		var rows [][]string
+		for _, s := range rep.Students {
+			rows = append(rows, []string{s.Name, strconv.Itoa(s.TotalRequests), formatTime(s.FirstSeen, rep.Location), formatTime(s.LastSeen, rep.Location)})
+		}
+		writeTable(&b, []string{"Student", "Requests", "First seen", "Last seen"}, rows)
+	}
+
+	b.WriteString("\n## Endpoints\n\n")
+	var rows [][]string
+	for _, e := range rep.Summary.Endpoints {
+		share := float64(e.Count) / float64(rep.Summary.TotalRequests) * 100
+		rows = append(rows, []string{e.Endpoint, strconv.Itoa(e.Count), fmt.Sprintf("%.1f%%", share)})
+	}
+	writeTable(&b, []string{"Endpoint", "Requests", "Share"}, rows)
+
+	b.WriteString("\n## Errors\n\n")
+	if len(rep.Errors) == 0 {
+		b.WriteString("No errors.\n")
+	} else {
+		rows = nil
+		for _, e := range rep.Errors {
+			rows = append(rows, []string{e.Endpoint, strconv.Itoa(e.Status), strconv.Itoa(e.Count)})
+		}
+		writeTable(&b, []string{"Endpoint", "Status", "Count"}, rows)
+	}
+
+	b.WriteString("\n## Most-sent peer messages\n\n")
+	if len(rep.Messages) == 0 {
+		b.WriteString("No peer messages were sent during the session.\n")
+	} else {
+		rows = nil
+		for _, m := range rep.Messages {
+			rows = append(rows, []string{m.Message, strconv.Itoa(m.Count), strconv.Itoa(m.Senders)})
+		}
+		writeTable(&b, []string{"Message", "Times sent", "Senders"}, rows)
+	}
+
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// writeTable writes a Markdown table.
+func writeTable(b *strings.Builder, header []string, rows [][]string) {
+	writeRow := func(cells []string) {
+		b.WriteString("|")
+		for _, c := range cells {
+			b.WriteString(" " + markdownCell(c) + " |")
+		}
+		b.WriteString("\n")
+	}
+
+	writeRow(header)
+	b.WriteString("|" + strings.Repeat(" --- |", len(header)) + "\n")
+	for _, row := range rows {
+		writeRow(row)
+	}
+}
+
+// markdownCell keeps student names and messages from breaking the table.
+func markdownCell(s string) string {
+	s = strings.ReplaceAll(s, "|", `\|`)
+	return strings.Join(strings.Fields(s), " ")
+}
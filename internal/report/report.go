@@ -0,0 +1,119 @@
+// Package report builds the after-course summary of one training session
+// as a standalone HTML page and as Markdown.
+package report
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/industrial-linguistics/happy-api/internal/monitor"
+)
+
+// topMessages is how many of the most-sent peer messages are listed.
+const topMessages = 10
+
+// Report is everything known about one session.
+type Report struct {
+	Session     string
+	GeneratedAt time.Time
+	// Location is the zone times are written in.
+	Location *time.Location
+	// Start and End are the session's first and last requests.
+	Start, End time.Time
+	Summary    monitor.Summary
+	PerMinute  []monitor.MinuteBucket
+	Latency    monitor.Latency
+	Errors     []monitor.EndpointError
+	Students   []monitor.StudentProgress
+	Milestones []monitor.Milestone
+	Progress   []monitor.MilestoneProgress
+	// Reached counts the students who reached each milestone.
+	Reached  []int
+	Messages []monitor.MessageCount
+}
+
+// Load gathers the report for session, judging exercise progress against
+// milestones, with times to be written in loc. Peer messages are not
+// tagged with a session, so those sent while the session was running are
+// used.
+func Load(ctx context.Context, db *sql.DB, session string, milestones []monitor.Milestone, loc *time.Location) (Report, error) {
+	r, err := monitor.SessionRange(ctx, db, session)
+	if err != nil {
+		return Report{}, err
+	}
+	if r.Since.IsZero() {
+		return Report{}, fmt.Errorf("no activity recorded for session %q", session)
+	}
+
+	rep := Report{
+		Session:     session,
+		GeneratedAt: time.Now(),
+		Location:    loc,
+		Start:       r.Since,
+		End:         r.Until.Add(-time.Second),
+		Milestones:  milestones,
+	}
+
+	if rep.Summary, err = monitor.LoadSummary(ctx, db, r); err != nil {
+		return Report{}, fmt.Errorf("failed to load summary: %w", err)
+	}
+	if rep.PerMinute, err = monitor.RequestsPerMinute(ctx, db, r); err != nil {
+		return Report{}, fmt.Errorf("failed to load requests per minute: %w", err)
+	}
+	if rep.Latency, err = monitor.LoadLatency(ctx, db, r); err != nil {
+		return Report{}, fmt.Errorf("failed to load latency: %w", err)
+	}
+	if rep.Errors, err = monitor.LoadErrors(ctx, db, r); err != nil {
+		return Report{}, fmt.Errorf("failed to load errors: %w", err)
+	}
+	if rep.Students, err = monitor.LoadStudentProgress(ctx, db, r); err != nil {
+		return Report{}, fmt.Errorf("failed to load student progress: %w", err)
+	}
+	if rep.Progress, err = monitor.ExerciseProgress(ctx, db, milestones, session, monitor.Range{}); err != nil {
+		return Report{}, fmt.Errorf("failed to load exercise progress: %w", err)
+	}
+	if rep.Messages, err = monitor.TopMessages(ctx, db, r, topMessages); err != nil {
+		return Report{}, fmt.Errorf("failed to load peer messages: %w", err)
+	}
+
+	rep.Reached = make([]int, len(milestones))
+	for _, p := range rep.Progress {
+		for i, t := range p.Reached {
+			if !t.IsZero() {
+				rep.Reached[i]++
+			}
+		}
+	}
+
+	return rep, nil
+}
+
+// formatSpan describes when the session ran, e.g.
+// "Tue 14 Oct 2025, 09:02–12:31 (3h29m)", in loc.
+func formatSpan(start, end time.Time, loc *time.Location) string {
+	start, end = start.In(loc), end.In(loc)
+	to := end.Format("15:04")
+	if end.YearDay() != start.YearDay() || end.Year() != start.Year() {
+		to = end.Format("Mon 2 Jan 2006, 15:04")
+	}
+	d := end.Sub(start).Round(time.Minute)
+	return fmt.Sprintf("%s–%s (%s)", start.Format("Mon 2 Jan 2006, 15:04"), to, formatDuration(d))
+}
+
+// formatDuration writes d in hours and minutes, e.g. "3h29m" or "45m".
+func formatDuration(d time.Duration) string {
+	h, m := int(d.Hours()), int(d.Minutes())%60
+	if h == 0 {
+		return fmt.Sprintf("%dm", m)
+	}
+	return fmt.Sprintf("%dh%02dm", h, m)
+}
+
+func formatTime(t time.Time, loc *time.Location) string {
+	if t.IsZero() {
+		return "-"
+	}
+	return t.In(loc).Format("15:04")
+}
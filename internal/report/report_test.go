@@ -0,0 +1,180 @@
+package report
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/industrial-linguistics/happy-api/internal/monitor"
+	_ "github.com/mattn/go-sqlite3"
+)
+
+const fixtureSchema = `
+CREATE TABLE activity_log (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    timestamp DATETIME DEFAULT CURRENT_TIMESTAMP,
+    endpoint TEXT NOT NULL,
+    name TEXT,
+    session_id TEXT,
+    ip_address TEXT,
+    user_agent TEXT,
+    response_code INTEGER,
+    response_time_ms INTEGER
+);
+
+CREATE TABLE user_messages (
+    message_id TEXT PRIMARY KEY,
+    from_user TEXT NOT NULL,
+    to_user TEXT NOT NULL,
+    message TEXT NOT NULL,
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    ip_address TEXT
+);
+`
+
+var sessionStart = time.Date(2025, 10, 14, 1, 0, 0, 0, time.UTC)
+
+// openFixture returns an empty in-memory database on a single connection.
+func openFixture(t *testing.T) *sql.DB {
+	t.Helper()
+
+	db, err := sql.Open("sqlite3", ":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	db.SetMaxOpenConns(1)
+	t.Cleanup(func() { db.Close() })
+	if _, err := db.Exec(fixtureSchema); err != nil {
+		t.Fatal(err)
+	}
+	return db
+}
+
+// loadFixture logs a short session for two students, one of them with a
+// name that needs escaping, plus a request from another session.
+func loadFixture(t *testing.T) Report {
+	t.Helper()
+
+	db := openFixture(t)
+	log := func(minute int, name, session, endpoint string, code int) {
+		_, err := db.Exec(`
+            INSERT INTO activity_log (timestamp, endpoint, name, session_id, response_code, response_time_ms)
+            VALUES (?, ?, ?, ?, ?, 7)
+        `, sessionStart.Add(time.Duration(minute)*time.Minute).Format("2006-01-02 15:04:05"), endpoint, name, session, code)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	log(0, "Alice", "java", "/automessage", 200)
+	log(2, "<b>Bob</b> | x", "java", "/automessage", 400)
+	log(3, "<b>Bob</b> | x", "java", "/automessage", 200)
+	log(5, "Alice", "java", "/message", 201)
+	log(4, "Carol", "python", "/automessage", 200)
+
+	for i, m := range []string{"You can do it!", "Great work", "You can do it!"} {
+		_, err := db.Exec(`
+            INSERT INTO user_messages (message_id, from_user, to_user, message, created_at)
+            VALUES (?, 'Alice', 'Bob', ?, ?)
+        `, string(rune('a'+i)), m, sessionStart.Add(time.Duration(i+1)*time.Minute).Format("2006-01-02 15:04:05"))
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	rep, err := Load(context.Background(), db, "java", monitor.DefaultMilestones, time.UTC)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return rep
+}
+
+func TestLoad(t *testing.T) {
+	rep := loadFixture(t)
+
+	if !rep.Start.Equal(sessionStart) || !rep.End.Equal(sessionStart.Add(5*time.Minute)) {
+		t.Errorf("session ran %v to %v", rep.Start, rep.End)
+	}
+	if rep.Summary.TotalRequests != 4 || rep.Summary.Students != 2 {
+		t.Errorf("summary = %+v, want 4 requests from 2 students", rep.Summary)
+	}
+	if len(rep.PerMinute) != 6 {
+		t.Errorf("got %d minutes, want 6", len(rep.PerMinute))
+	}
+	if len(rep.Errors) != 1 || rep.Errors[0].Status != 400 {
+		t.Errorf("errors = %+v", rep.Errors)
+	}
+	// fetch and retry are reached by both students, send by Alice
+	if rep.Reached[0] != 2 || rep.Reached[2] != 1 || rep.Reached[4] != 1 {
+		t.Errorf("reached = %v", rep.Reached)
+	}
+	if len(rep.Messages) != 2 || rep.Messages[0].Count != 2 {
+		t.Errorf("messages = %+v", rep.Messages)
+	}
+
+	if _, err := Load(context.Background(), openFixture(t), "java", nil, time.UTC); err == nil {
+		t.Error("Load succeeded for a session with no activity")
+	}
+}
+
+func TestWriteHTML(t *testing.T) {
+	var buf bytes.Buffer
+	if err := WriteHTML(&buf, loadFixture(t)); err != nil {
+		t.Fatal(err)
+	}
+	page := buf.String()
+
+	for _, want := range []string{
+		"<title>Session report: java</title>",
+		`<svg class="chart"`,
+		"&lt;b&gt;Bob&lt;/b&gt; | x",
+		"You can do it!",
+		"of 2 students",
+	} {
+		if !strings.Contains(page, want) {
+			t.Errorf("page is missing %q", want)
+		}
+	}
+	// Self-contained: nothing to fetch
+	for _, external := range []string{"<script", "<link", "src=", "href="} {
+		if strings.Contains(page, external) {
+			t.Errorf("page contains %q", external)
+		}
+	}
+}
+
+func TestWriteMarkdown(t *testing.T) {
+	var buf bytes.Buffer
+	if err := WriteMarkdown(&buf, loadFixture(t)); err != nil {
+		t.Fatal(err)
+	}
+	md := buf.String()
+
+	for _, want := range []string{
+		"# Session report: java\n",
+		"- **Requests:** 4 from 2 students\n",
+		"| Student | fetch | history | send | inbox | retry | refresh | Done |\n",
+		`| <b>Bob</b> \| x |`,
+		"| /automessage | 400 | 1 |\n",
+		"| You can do it! | 2 | 1 |\n",
+		"- **fetch** Exercise 1: First 200 on /automessage — 2 of 2 students\n",
+		"- **When:** Tue 14 Oct 2025, 01:00–01:05 (5m)\n",
+	} {
+		if !strings.Contains(md, want) {
+			t.Errorf("markdown is missing %q:\n%s", want, md)
+		}
+	}
+
+	// Times follow the report's location
+	rep := loadFixture(t)
+	rep.Location = time.FixedZone("AWST", 8*60*60)
+	buf.Reset()
+	if err := WriteMarkdown(&buf, rep); err != nil {
+		t.Fatal(err)
+	}
+	if want := "- **When:** Tue 14 Oct 2025, 09:00–09:05 (5m)\n"; !strings.Contains(buf.String(), want) {
+		t.Errorf("markdown in AWST is missing %q:\n%s", want, buf.String())
+	}
+}
@@ -13,6 +13,7 @@ echo "Installing happy-api to $VHOST_DIR..."
 # Create directories
 mkdir -p ${VHOST_DIR}/data
 mkdir -p ${VHOST_DIR}/v1
+mkdir -p ${VHOST_DIR}/v2
 mkdir -p ${VHOST_DIR}/bin
 mkdir -p ${VHOST_DIR}/htdocs
 
@@ -27,6 +28,16 @@ if [ -f /tmp/message-api ]; then
     ln -sf message-api messages
     ln -sf message-api automessage
     ln -sf message-api status
+    ln -sf message-api metrics
+    ln -sf message-api openapi.json
+
+    # /v2 is served by the same binary
+    cd ${VHOST_DIR}/v2
+    ln -sf ../v1/message-api message
+    ln -sf ../v1/message-api messages
+    ln -sf ../v1/message-api automessage
+    ln -sf ../v1/message-api status
+    ln -sf ../v1/message-api openapi.json
     echo "Created symlinks for API endpoints"
 fi
 
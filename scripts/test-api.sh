@@ -14,15 +14,15 @@ curl -s "$BASE_URL/status" | jq . || echo "FAILED"
 echo ""
 
 # Test 2: Get a message
-echo "Test 2: GET /message?name=TestUser"
-echo "-----------------------------------"
-curl -s "$BASE_URL/message?name=TestUser&session_id=test_session" | jq . || echo "FAILED"
+echo "Test 2: GET /automessage?name=TestUser"
+echo "---------------------------------------"
+curl -s "$BASE_URL/automessage?name=TestUser&session_id=test_session" | jq . || echo "FAILED"
 echo ""
 
 # Test 3: Get another message (check sequence)
-echo "Test 3: GET /message again (check sequence)"
-echo "-------------------------------------------"
-curl -s "$BASE_URL/message?name=TestUser&session_id=test_session" | jq . || echo "FAILED"
+echo "Test 3: GET /automessage again (check sequence)"
+echo "-----------------------------------------------"
+curl -s "$BASE_URL/automessage?name=TestUser&session_id=test_session" | jq . || echo "FAILED"
 echo ""
 
 # Test 4: Post a message
@@ -44,10 +44,17 @@ echo "------------------------------------"
 curl -s "$BASE_URL/messages?recipient=Bob&limit=10" | jq . || echo "FAILED"
 echo ""
 
+# Test 5b: Revalidate messages with the ETag
+echo "Test 5b: GET /messages with If-None-Match (expect 304)"
+echo "------------------------------------------------------"
+ETAG=$(curl -s -D - -o /dev/null "$BASE_URL/messages?recipient=Bob&limit=10" | tr -d '\r' | awk 'tolower($1) == "etag:" { print $2 }')
+curl -s -o /dev/null -w "%{http_code}\n" -H "If-None-Match: $ETAG" "$BASE_URL/messages?recipient=Bob&limit=10" | grep 304 || echo "FAILED"
+echo ""
+
 # Test 6: Error handling - missing name
 echo "Test 6: Error handling (missing name)"
 echo "--------------------------------------"
-curl -s "$BASE_URL/message" | jq . || echo "FAILED"
+curl -s "$BASE_URL/automessage" | jq . || echo "FAILED"
 echo ""
 
 # Test 7: Error handling - negative message
@@ -63,6 +70,21 @@ curl -s -X POST "$BASE_URL/message" \
   }' | jq . || echo "FAILED"
 echo ""
 
+# Test 8: Deprecated alias
+echo "Test 8: GET /message (deprecated alias of /automessage)"
+echo "-------------------------------------------------------"
+curl -s -D - -o /dev/null "$BASE_URL/message?name=TestUser&session_id=test_session" | grep -i '^\(deprecation\|sunset\|link\):' || echo "FAILED"
+echo ""
+
+# Test 9: CORS preflight, as a browser sends before POSTing JSON
+echo "Test 9: OPTIONS /message (CORS preflight)"
+echo "-----------------------------------------"
+curl -s -D - -o /dev/null -X OPTIONS "$BASE_URL/message" \
+  -H "Origin: http://localhost:8000" \
+  -H "Access-Control-Request-Method: POST" \
+  -H "Access-Control-Request-Headers: Content-Type" | grep -i '^access-control-' || echo "FAILED"
+echo ""
+
 echo "========================================"
 echo "Tests complete!"
 echo ""